@@ -0,0 +1,527 @@
+// Package cassette records the HTTP traffic of a test against real S3 to a
+// file and serves it back later, so a test that needs AWS credentials can
+// be recorded once and then run offline, in CI, with none:
+//
+//	rec := cassette.New(t, "testdata/Test_createS3Bucket.json", cassette.ModeFromEnv(path))
+//	bucket := rec.Value("bucket", func() string { return newName() })
+//	client := s3.NewFromConfig(cfg, func(o *s3.Options) { o.HTTPClient = rec.Client(cfg.HTTPClient) })
+//
+// Credentials and signatures are scrubbed before anything is written, and
+// request IDs are replaced with fixed values so re-recording a cassette
+// gives a small diff. A replayed request that matches nothing in the
+// cassette fails the test with a diff against the request that was expected,
+// and gets a CassetteMismatch error back.
+package cassette
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+)
+
+// ModeEnv names the environment variable ModeFromEnv reads: "record",
+// "replay" or "off".
+const ModeEnv = "S3_CASSETTE"
+
+// Mode says what a Recorder does with requests.
+type Mode int
+
+const (
+	// ModeOff sends every request to the real backend and records nothing.
+	ModeOff Mode = iota
+	// ModeRecord sends every request to the real backend and writes the
+	// exchanges to the cassette when the test ends, replacing the file.
+	ModeRecord
+	// ModeReplay answers every request from the cassette and sends nothing.
+	ModeReplay
+)
+
+func (m Mode) String() string {
+	switch m {
+	case ModeOff:
+		return "off"
+	case ModeRecord:
+		return "record"
+	case ModeReplay:
+		return "replay"
+	}
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+// ModeFromEnv returns the mode S3_CASSETTE asks for. When it is unset the
+// cassette at path is replayed if it exists, and otherwise the test runs
+// live.
+func ModeFromEnv(path string) Mode {
+	switch os.Getenv(ModeEnv) {
+	case "record":
+		return ModeRecord
+	case "replay":
+		return ModeReplay
+	case "off":
+		return ModeOff
+	}
+	if _, err := os.Stat(path); err == nil {
+		return ModeReplay
+	}
+	return ModeOff
+}
+
+// Doer sends an HTTP request. *http.Client and the AWS SDK's HTTP clients
+// implement it.
+type Doer interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// Placeholders written in place of secrets and per-request identifiers.
+const (
+	Redacted  = "REDACTED"
+	RequestID = "REQUESTID"
+	HostID    = "HOSTID"
+)
+
+// scrubbedHeaders carry credentials or signatures and are never written.
+var scrubbedHeaders = []string{"Authorization", "X-Amz-Security-Token"}
+
+// scrubbedQuery are the presigned URL parameters that carry credentials or
+// signatures.
+var scrubbedQuery = []string{"X-Amz-Credential", "X-Amz-Security-Token", "X-Amz-Signature"}
+
+// Headers and error body elements that differ on every request. The SDK's
+// invocation ID is the client side's request ID.
+var (
+	requestIDHeaders = map[string]string{"X-Amz-Request-Id": RequestID, "X-Amz-Id-2": HostID, "Amz-Sdk-Invocation-Id": RequestID}
+	requestIDBody    = regexp.MustCompile(`<(RequestId|HostId)>[^<]*</(RequestId|HostId)>`)
+)
+
+// File is the on-disk form of a cassette.
+type File struct {
+	// Values are the named values the test generated while recording, such
+	// as bucket names, which replay has to reuse for its requests to match.
+	Values       map[string]string `json:"values,omitempty"`
+	Interactions []Interaction     `json:"interactions"`
+}
+
+// Interaction is one request and the response it got.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a recorded request. Only Method, URL and Body are matched on
+// replay; the headers are kept for whoever reads the cassette.
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   Body        `json:"body,omitempty"`
+}
+
+// Response is a recorded response.
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       Body        `json:"body,omitempty"`
+}
+
+// Body is a message body. It is written as a string when it is UTF-8, as S3
+// bodies almost always are, and as base64 otherwise.
+type Body []byte
+
+// MarshalJSON implements json.Marshaler.
+func (b Body) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(string(b)); err != nil {
+			return nil, err
+		}
+		return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+	}
+	return json.Marshal(map[string]string{"base64": base64.StdEncoding.EncodeToString(b)})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (b *Body) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*b = Body(s)
+		return nil
+	}
+	var encoded struct {
+		Base64 string `json:"base64"`
+	}
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded.Base64)
+	*b = decoded
+	return err
+}
+
+// Recorder records or replays one test's HTTP traffic. It is safe for
+// concurrent use.
+type Recorder struct {
+	t    testing.TB
+	path string
+	mode Mode
+
+	mu       sync.Mutex
+	file     File
+	used     []bool
+	reported map[string]bool
+}
+
+// New returns a Recorder for the cassette at path. In ModeReplay the
+// cassette is read straight away and t fails if it cannot be; in ModeRecord
+// it is written when t finishes. In ModeReplay t also fails at the end if
+// any recorded request was never sent.
+func New(t testing.TB, path string, mode Mode) *Recorder {
+	t.Helper()
+	r := &Recorder{t: t, path: path, mode: mode, reported: map[string]bool{}}
+	switch mode {
+	case ModeReplay:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("cassette: %v", err)
+		}
+		if err := json.Unmarshal(data, &r.file); err != nil {
+			t.Fatalf("cassette: parse %s: %v", path, err)
+		}
+		r.used = make([]bool, len(r.file.Interactions))
+		t.Cleanup(r.checkUsed)
+	case ModeRecord:
+		t.Cleanup(r.save)
+	}
+	return r
+}
+
+// Mode returns the Recorder's mode.
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// Value returns the value named name. When recording, or running live, it
+// calls generate and, when recording, saves the result in the cassette; on
+// replay it returns the saved value instead, so names that were random when
+// the cassette was recorded come out the same.
+func (r *Recorder) Value(name string, generate func() string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.mode == ModeReplay {
+		v, ok := r.file.Values[name]
+		if !ok {
+			r.t.Fatalf("cassette: %s has no value %q; record it again", r.path, name)
+		}
+		return v
+	}
+	v := generate()
+	if r.mode == ModeRecord {
+		if r.file.Values == nil {
+			r.file.Values = map[string]string{}
+		}
+		r.file.Values[name] = v
+	}
+	return v
+}
+
+// Client returns an HTTP client that sends requests through real, recording
+// them, or answers them from the cassette, depending on the mode. real is
+// not used on replay and may be nil then.
+func (r *Recorder) Client(real Doer) Doer {
+	var send sendFunc
+	if real != nil {
+		send = real.Do
+	}
+	return doerFunc(func(req *http.Request) (*http.Response, error) {
+		return r.do(send, req)
+	})
+}
+
+// Transport is Client for code that takes an http.RoundTripper.
+func (r *Recorder) Transport(real http.RoundTripper) http.RoundTripper {
+	var send sendFunc
+	if real != nil {
+		send = real.RoundTrip
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return r.do(send, req)
+	})
+}
+
+type doerFunc func(*http.Request) (*http.Response, error)
+
+func (f doerFunc) Do(req *http.Request) (*http.Response, error) { return f(req) }
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// sendFunc sends a request to the real backend.
+type sendFunc func(*http.Request) (*http.Response, error)
+
+func (r *Recorder) do(send sendFunc, req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, fmt.Errorf("cassette: read request body: %w", err)
+	}
+	switch r.mode {
+	case ModeReplay:
+		return r.replay(req, body)
+	case ModeRecord:
+		return r.record(send, req, body)
+	}
+	return send(req)
+}
+
+func (r *Recorder) record(send sendFunc, req *http.Request, reqBody []byte) (*http.Response, error) {
+	resp, err := send(req)
+	if err != nil {
+		// Transport errors are not recorded: replay could not reproduce them
+		// faithfully, and the SDK retries them anyway.
+		return resp, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("cassette: read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.file.Interactions = append(r.file.Interactions, Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    scrubURL(req.URL),
+			Header: normalizeHeader(scrubHeader(req.Header)),
+			Body:   reqBody,
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     normalizeHeader(resp.Header),
+			Body:       requestIDBody.ReplaceAllFunc(respBody, normalizeIDElement),
+		},
+	})
+	return resp, nil
+}
+
+// replay answers req with the first unused interaction that matches it. The
+// search is not strictly in order, so concurrent requests replay too.
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	got := Request{Method: req.Method, URL: scrubURL(req.URL), Body: body}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	next := -1
+	for i, in := range r.file.Interactions {
+		if r.used[i] {
+			continue
+		}
+		if next < 0 {
+			next = i
+		}
+		if matches(in.Request, got) {
+			r.used[i] = true
+			return in.Response.httpResponse(req), nil
+		}
+	}
+
+	var msg string
+	if next < 0 {
+		msg = fmt.Sprintf("cassette %s: unexpected request after every recorded one was used:\n%s", r.path, got)
+	} else {
+		msg = fmt.Sprintf("cassette %s: request does not match the next recorded one (-recorded +sent):\n%s",
+			r.path, Diff(r.file.Interactions[next].Request.String(), got.String()))
+	}
+	// Code that retries may send the same request again, so report each
+	// mismatch to the test once rather than once per attempt.
+	if !r.reported[msg] {
+		r.reported[msg] = true
+		r.t.Error(msg)
+	}
+	return mismatchResponse(req, msg), nil
+}
+
+// MismatchCode is the S3 error code replay answers an unrecorded request
+// with. The response is a 400, which neither the SDK nor createS3Bucket
+// retries, so the test fails straight away rather than backing off against
+// a cassette that will never match.
+const MismatchCode = "CassetteMismatch"
+
+func mismatchResponse(req *http.Request, msg string) *http.Response {
+	var body bytes.Buffer
+	body.WriteString("<Error><Code>" + MismatchCode + "</Code><Message>")
+	xml.EscapeText(&body, []byte(msg))
+	body.WriteString("</Message></Error>")
+	resp := Response{
+		StatusCode: http.StatusBadRequest,
+		Header:     http.Header{"Content-Type": {"application/xml"}},
+		Body:       body.Bytes(),
+	}
+	return resp.httpResponse(req)
+}
+
+func matches(want, got Request) bool {
+	return want.Method == got.Method && want.URL == got.URL && bytes.Equal(want.Body, got.Body)
+}
+
+// String formats the parts of the request that replay matches, a query
+// parameter per line so that a diff points at the one that changed.
+func (req Request) String() string {
+	var sb strings.Builder
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		fmt.Fprintf(&sb, "%s %s\n", req.Method, req.URL)
+	} else {
+		query := u.Query()
+		u.RawQuery = ""
+		fmt.Fprintf(&sb, "%s %s\n", req.Method, u)
+		keys := make([]string, 0, len(query))
+		for k := range query {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			for _, v := range query[k] {
+				fmt.Fprintf(&sb, "  %s=%s\n", k, v)
+			}
+		}
+	}
+	if len(req.Body) > 0 {
+		// Put each XML element on its own line for the same reason.
+		sb.WriteString(strings.ReplaceAll(string(req.Body), "><", ">\n<"))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func (resp Response) httpResponse(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode)),
+		StatusCode:    resp.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        resp.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(resp.Body)),
+		ContentLength: int64(len(resp.Body)),
+		Request:       req,
+	}
+}
+
+// checkUsed fails the test if replay left interactions unused, which means
+// the code under test no longer makes a call it used to.
+func (r *Recorder) checkUsed() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var unused []string
+	for i, used := range r.used {
+		if !used {
+			in := r.file.Interactions[i].Request
+			unused = append(unused, in.Method+" "+in.URL)
+		}
+	}
+	if len(unused) > 0 {
+		r.t.Errorf("cassette %s: %d recorded request(s) were never sent:\n%s",
+			r.path, len(unused), strings.Join(unused, "\n"))
+	}
+}
+
+func (r *Recorder) save() {
+	if r.t.Failed() {
+		r.t.Logf("cassette: not writing %s because the test failed", r.path)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// S3 bodies are XML, which is unreadable with < and > escaped.
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r.file); err != nil {
+		r.t.Errorf("cassette: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		r.t.Errorf("cassette: %v", err)
+		return
+	}
+	if err := os.WriteFile(r.path, buf.Bytes(), 0o644); err != nil {
+		r.t.Errorf("cassette: %v", err)
+	}
+}
+
+// readBody reads req's body and puts back a copy, so it can still be sent.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return body, nil
+}
+
+func scrubURL(u *url.URL) string {
+	scrubbed := *u
+	query := scrubbed.Query()
+	changed := false
+	for _, k := range scrubbedQuery {
+		if query.Has(k) {
+			query.Set(k, Redacted)
+			changed = true
+		}
+	}
+	if changed {
+		scrubbed.RawQuery = query.Encode()
+	}
+	return scrubbed.String()
+}
+
+func scrubHeader(h http.Header) http.Header {
+	h = h.Clone()
+	for _, k := range scrubbedHeaders {
+		if h.Get(k) != "" {
+			h.Set(k, Redacted)
+		}
+	}
+	return h
+}
+
+func normalizeHeader(h http.Header) http.Header {
+	h = h.Clone()
+	for k, placeholder := range requestIDHeaders {
+		if h.Get(k) != "" {
+			h.Set(k, placeholder)
+		}
+	}
+	return h
+}
+
+func normalizeIDElement(element []byte) []byte {
+	if bytes.HasPrefix(element, []byte("<RequestId>")) {
+		return []byte("<RequestId>" + RequestID + "</RequestId>")
+	}
+	return []byte("<HostId>" + HostID + "</HostId>")
+}
@@ -0,0 +1,235 @@
+package cassette
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingTB captures what a Recorder reports instead of failing the test.
+type recordingTB struct {
+	testing.TB
+	mu     sync.Mutex
+	errors []string
+}
+
+func (tb *recordingTB) Error(args ...any) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.errors = append(tb.errors, fmt.Sprint(args...))
+}
+
+func (tb *recordingTB) Errorf(format string, args ...any) {
+	tb.Error(fmt.Sprintf(format, args...))
+}
+
+func (tb *recordingTB) Failed() bool {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return len(tb.errors) > 0
+}
+
+// newServer answers like S3: an empty 200 for PUT and a NoSuchBucket error,
+// with fresh request IDs, for anything else.
+func newServer(t *testing.T) (*httptest.Server, *int) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("X-Amz-Request-Id", fmt.Sprintf("id-%d", calls))
+		w.Header().Set("X-Amz-Id-2", fmt.Sprintf("host-%d", calls))
+		if r.Method == http.MethodPut {
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "<Error><Code>NoSuchBucket</Code><RequestId>id-%d</RequestId><HostId>host-%d</HostId></Error>", calls, calls)
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &calls
+}
+
+func send(t *testing.T, client Doer, method, url, body string) (*http.Response, string, error) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential=AKIDSECRET/20250101/eu-west-2/s3/aws4_request, Signature=abc")
+	req.Header.Set("X-Amz-Security-Token", "session-secret")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(data), nil
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	ts, calls := newServer(t)
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	createBody := "<CreateBucketConfiguration><LocationConstraint>eu-west-2</LocationConstraint></CreateBucketConfiguration>"
+	presigned := ts.URL + "/my-bucket?X-Amz-Credential=AKIDSECRET&X-Amz-Signature=abc"
+
+	t.Run("record", func(t *testing.T) {
+		rec := New(t, path, ModeRecord)
+		if got := rec.Value("bucket", func() string { return "my-bucket" }); got != "my-bucket" {
+			t.Errorf("Value() = %q, want my-bucket", got)
+		}
+		client := rec.Client(http.DefaultClient)
+		if _, _, err := send(t, client, http.MethodPut, ts.URL+"/my-bucket", createBody); err != nil {
+			t.Fatalf("PUT error = %v", err)
+		}
+		resp, body, err := send(t, client, http.MethodGet, presigned, "")
+		if err != nil {
+			t.Fatalf("GET error = %v", err)
+		}
+		if resp.StatusCode != http.StatusNotFound || !strings.Contains(body, "<RequestId>id-2</RequestId>") {
+			t.Errorf("recording changed the live response: %d %s", resp.StatusCode, body)
+		}
+	})
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("cassette was not written: %v", err)
+	}
+	for _, secret := range []string{"AKIDSECRET", "session-secret", "Signature=abc", "id-1", "host-2"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("cassette contains %q:\n%s", secret, data)
+		}
+	}
+
+	ts.Close()
+	t.Run("replay", func(t *testing.T) {
+		rec := New(t, path, ModeReplay)
+		if got := rec.Value("bucket", func() string { return "other-bucket" }); got != "my-bucket" {
+			t.Errorf("Value() = %q, want the recorded my-bucket", got)
+		}
+		client := rec.Client(nil)
+		resp, _, err := send(t, client, http.MethodPut, ts.URL+"/my-bucket", createBody)
+		if err != nil {
+			t.Fatalf("PUT error = %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("PUT status = %d, want 200", resp.StatusCode)
+		}
+		// A fresh signature on replay still matches.
+		resp, body, err := send(t, client, http.MethodGet, ts.URL+"/my-bucket?X-Amz-Credential=AKIDOTHER&X-Amz-Signature=def", "")
+		if err != nil {
+			t.Fatalf("GET error = %v", err)
+		}
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET status = %d, want 404", resp.StatusCode)
+		}
+		if got := resp.Header.Get("X-Amz-Request-Id"); got != RequestID {
+			t.Errorf("X-Amz-Request-Id = %q, want %q", got, RequestID)
+		}
+		if want := "<Error><Code>NoSuchBucket</Code><RequestId>REQUESTID</RequestId><HostId>HOSTID</HostId></Error>"; body != want {
+			t.Errorf("GET body = %q, want %q", body, want)
+		}
+	})
+	if *calls != 2 {
+		t.Errorf("server saw %d requests, want 2 from recording and none from replay", *calls)
+	}
+}
+
+func TestReplayMismatch(t *testing.T) {
+	ts, _ := newServer(t)
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	t.Run("record", func(t *testing.T) {
+		client := New(t, path, ModeRecord).Client(http.DefaultClient)
+		send(t, client, http.MethodPut, ts.URL+"/my-bucket?tagging", "<Tagging><TagSet><Tag><Key>run</Key><Value>1</Value></Tag></TagSet></Tagging>")
+	})
+
+	tb := &recordingTB{TB: t}
+	client := New(tb, path, ModeReplay).Client(nil)
+	resp, body, err := send(t, client, http.MethodPut, ts.URL+"/my-bucket?tagging", "<Tagging><TagSet><Tag><Key>run</Key><Value>2</Value></Tag></TagSet></Tagging>")
+	if err != nil {
+		t.Fatalf("PUT error = %v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, "<Code>"+MismatchCode+"</Code>") {
+		t.Errorf("replaying a different body = %d %s, want a 400 %s", resp.StatusCode, body, MismatchCode)
+	}
+	// Retries of the same request are reported once.
+	send(t, client, http.MethodPut, ts.URL+"/my-bucket?tagging", "<Tagging><TagSet><Tag><Key>run</Key><Value>2</Value></Tag></TagSet></Tagging>")
+	if len(tb.errors) != 1 {
+		t.Fatalf("reported %d errors, want 1: %q", len(tb.errors), tb.errors)
+	}
+	for _, want := range []string{"- <Value>1</Value>", "+ <Value>2</Value>", "  <Key>run</Key>", "  tagging="} {
+		if !strings.Contains(tb.errors[0], want) {
+			t.Errorf("mismatch report does not contain %q:\n%s", want, tb.errors[0])
+		}
+	}
+}
+
+func TestReplayUnused(t *testing.T) {
+	ts, _ := newServer(t)
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	t.Run("record", func(t *testing.T) {
+		client := New(t, path, ModeRecord).Client(http.DefaultClient)
+		send(t, client, http.MethodPut, ts.URL+"/a", "")
+		send(t, client, http.MethodPut, ts.URL+"/b", "")
+	})
+
+	tb := &recordingTB{TB: t}
+	t.Run("replay", func(t *testing.T) {
+		tb.TB = t
+		client := New(tb, path, ModeReplay).Client(nil)
+		// Out of order is fine.
+		if _, _, err := send(t, client, http.MethodPut, ts.URL+"/b", ""); err != nil {
+			t.Errorf("PUT /b error = %v", err)
+		}
+	})
+	if len(tb.errors) != 1 || !strings.Contains(tb.errors[0], "PUT "+ts.URL+"/a") {
+		t.Errorf("errors = %q, want one naming the unsent PUT /a", tb.errors)
+	}
+}
+
+func TestModeFromEnv(t *testing.T) {
+	existing := filepath.Join(t.TempDir(), "cassette.json")
+	if err := os.WriteFile(existing, []byte(`{"interactions":[]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(t.TempDir(), "missing.json")
+	tests := []struct {
+		env  string
+		path string
+		want Mode
+	}{
+		{"", existing, ModeReplay},
+		{"", missing, ModeOff},
+		{"record", existing, ModeRecord},
+		{"replay", missing, ModeReplay},
+		{"off", existing, ModeOff},
+	}
+	for _, tt := range tests {
+		t.Setenv(ModeEnv, tt.env)
+		if got := ModeFromEnv(tt.path); got != tt.want {
+			t.Errorf("ModeFromEnv(%s) with %s=%q = %v, want %v", filepath.Base(tt.path), ModeEnv, tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestBodyJSON(t *testing.T) {
+	for _, body := range []Body{Body("<a/>"), {0xff, 0x00, 0xfe}} {
+		data, err := body.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Body
+		if err := got.UnmarshalJSON(data); err != nil {
+			t.Fatalf("UnmarshalJSON(%s) error = %v", data, err)
+		}
+		if string(got) != string(body) {
+			t.Errorf("round trip of %q = %q", body, got)
+		}
+	}
+}
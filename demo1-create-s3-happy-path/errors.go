@@ -0,0 +1,150 @@
+package s3
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+var (
+	// ErrRetriesExhausted matches a *RetryError for an operation that was
+	// still failing with retryable errors when its RetryPolicy ran out of
+	// attempts or time.
+	ErrRetriesExhausted = errors.New("retries exhausted")
+	// ErrBucketOwnedByOtherAccount matches a *RetryError whose last attempt
+	// found the bucket name taken by another account: BucketAlreadyExists
+	// from CreateBucket, or 403 Forbidden from HeadBucket.
+	ErrBucketOwnedByOtherAccount = errors.New("bucket is owned by another account")
+	// ErrInvalidBucketName is returned, wrapped, for a name S3 would
+	// reject.
+	ErrInvalidBucketName = errors.New("invalid bucket name")
+	// ErrInvalidRegion is returned, wrapped, for a region S3 cannot create
+	// buckets in.
+	ErrInvalidRegion = errors.New("invalid region")
+	// ErrRegionMismatch is returned, wrapped, when the client is configured
+	// for a different region from the one the bucket is to be created in.
+	ErrRegionMismatch = errors.New("client region does not match bucket region")
+)
+
+// CanceledError reports that the caller's context was cancelled or hit its
+// deadline before a bucket operation finished. errors.Is matches it against
+// context.Canceled or context.DeadlineExceeded, and against the error of the
+// last attempt if there was one.
+type CanceledError struct {
+	Op      string
+	Bucket  string
+	Attempt int // attempts made before giving up
+	Err     error
+	LastErr error
+}
+
+func (e *CanceledError) Error() string {
+	if e.LastErr != nil {
+		return fmt.Sprintf("%s %s: stopped after %d attempt(s): %v (last error: %v)", e.Op, e.Bucket, e.Attempt, e.Err, e.LastErr)
+	}
+	return fmt.Sprintf("%s %s: stopped after %d attempt(s): %v", e.Op, e.Bucket, e.Attempt, e.Err)
+}
+
+func (e *CanceledError) Unwrap() []error {
+	if e.LastErr == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Err, e.LastErr}
+}
+
+// TimeoutError reports that one phase of creating a bucket ran out of the
+// time it was given: PhaseCreateBucket, PhaseWait or PhaseOperation.
+// errors.Is matches it against context.DeadlineExceeded.
+type TimeoutError struct {
+	Bucket  string
+	Phase   string
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s %s: timed out after %v: %v", e.Phase, e.Bucket, e.Timeout, e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// AttemptError is one failed attempt recorded in a RetryError.
+type AttemptError struct {
+	Attempt  int
+	Phase    string
+	Start    time.Time
+	Duration time.Duration
+	// WireAttempts is the number of requests the attempt sent, SDK retries
+	// and its HeadBucket checks included. It is zero for clients whose
+	// requests cannot be counted, such as mocks.
+	WireAttempts int
+	Err          error
+}
+
+func (e AttemptError) Error() string {
+	return fmt.Sprintf("attempt %d (%s, %v): %v", e.Attempt, e.Phase, e.Duration, e.Err)
+}
+
+func (e AttemptError) Unwrap() error {
+	return e.Err
+}
+
+// RetryError reports that an operation gave up without succeeding, with
+// every failed attempt in order. errors.Is and errors.As look through the
+// attempts' errors, most recent first, so they find the smithy and S3
+// error types behind them, and errors.Is also matches ErrRetriesExhausted
+// and ErrBucketOwnedByOtherAccount where they apply.
+type RetryError struct {
+	Op       string
+	Bucket   string
+	Reason   GiveUpReason
+	Attempts []AttemptError
+	// WireAttempts is the number of requests sent across all attempts,
+	// counted as for AttemptError.
+	WireAttempts int
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("%s %s: gave up after %d failed attempt(s) (%s): %v", e.Op, e.Bucket, len(e.Attempts), e.Reason, e.Last())
+}
+
+// Last returns the error of the last attempt.
+func (e *RetryError) Last() error {
+	if len(e.Attempts) == 0 {
+		return nil
+	}
+	return e.Attempts[len(e.Attempts)-1].Err
+}
+
+func (e *RetryError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Attempts))
+	for i := len(e.Attempts) - 1; i >= 0; i-- {
+		errs = append(errs, e.Attempts[i].Err)
+	}
+	return errs
+}
+
+func (e *RetryError) Is(target error) bool {
+	switch target {
+	case ErrRetriesExhausted:
+		return e.Reason == GiveUpAttempts || e.Reason == GiveUpElapsed
+	case ErrBucketOwnedByOtherAccount:
+		return len(e.Attempts) > 0 && ownedByOtherAccount(e.Attempts[len(e.Attempts)-1])
+	}
+	return false
+}
+
+func ownedByOtherAccount(a AttemptError) bool {
+	var alreadyExists *types.BucketAlreadyExists
+	if errors.As(a.Err, &alreadyExists) {
+		return true
+	}
+	var statusErr interface{ HTTPStatusCode() int }
+	return (a.Phase == PhaseHeadBucket || a.Phase == PhaseWait) &&
+		errors.As(a.Err, &statusErr) && statusErr.HTTPStatusCode() == http.StatusForbidden
+}
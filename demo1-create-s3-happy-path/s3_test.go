@@ -2,31 +2,34 @@ package s3
 
 import (
 	"context"
-	"log/slog"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/golangbot/s3/cassette"
+	"github.com/golangbot/testkit/testrun"
 )
 
+// Test_createS3Bucket replays testdata/Test_createS3Bucket.json when it
+// exists and otherwise runs against the backend. No cassette is committed
+// yet, so in CI, where CI is set, it is skipped unless S3_CASSETTE asks for
+// a mode. Record one with
+//
+//	S3_CASSETTE=record go test -run Test_createS3Bucket
 func Test_createS3Bucket(t *testing.T) {
 	region := "eu-west-2"
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
-	if err != nil {
-		slog.Error("Failed to create AWS config", "error", err)
-		return
-	}
-
-	s3Client := s3.NewFromConfig(cfg)
-	bucketName := "gopherconuk-2025-my-new-bucket"
+	s3Client, rec := newCassetteClient(t, region)
+	bucketName := rec.Value("bucket", func() string { return testrun.BucketName(t, newBucketName) })
+	runID := rec.Value("run-id", testrun.ID)
 	wantErr := false
 
 	defer deleteBucket(s3Client, bucketName, region)
-	if err := createS3Bucket(s3Client, bucketName, region); (err != nil) != wantErr {
+	if err := createS3Bucket(s3Client, bucketName, region, testRunTags(runID)); (err != nil) != wantErr {
 		t.Errorf("createS3Bucket() error = %v, wantErr %v", err, wantErr)
 	}
 
@@ -37,3 +40,87 @@ func Test_createS3Bucket(t *testing.T) {
 	}
 
 }
+
+// testRunTags tags a test bucket with the run that made it, so
+// Test_reapLeakedBuckets can find it if cleanup never runs.
+func testRunTags(runID string) Option {
+	return WithBucketTags(map[string]string{TestRunTag: runID})
+}
+
+// Test_reapLeakedBuckets deletes test buckets that earlier runs left behind.
+// It only runs when S3_REAP_TTL is set, as a positive duration, and only
+// reports what it would delete unless S3_REAP_DELETE=1:
+//
+//	S3_REAP_TTL=2h S3_REAP_DELETE=1 go test -run Test_reapLeakedBuckets -v
+func Test_reapLeakedBuckets(t *testing.T) {
+	ttl, err := time.ParseDuration(os.Getenv("S3_REAP_TTL"))
+	if err != nil {
+		t.Skip("S3_REAP_TTL is not set to a duration")
+	}
+	report, err := ReapBuckets(context.Background(), newBackendClient(t, "eu-west-2"), ReapPolicy{
+		Prefix: testrun.BucketPrefix + "-",
+		Tags:   map[string]string{TestRunTag: ""},
+		TTL:    ttl,
+		DryRun: os.Getenv("S3_REAP_DELETE") != "1",
+	})
+	if err != nil {
+		t.Fatalf("ReapBuckets() error = %v", err)
+	}
+	t.Log(report)
+	if err := report.Err(); err != nil {
+		t.Errorf("Some buckets could not be reaped: %v", err)
+	}
+}
+
+// newBackendClient returns a client in region for the backend S3_BACKEND
+// names, real AWS by default, so these tests can run against LocalStack with
+// S3_BACKEND=localstack.
+func newBackendClient(t *testing.T, region string) *s3.Client {
+	t.Helper()
+	bc, err := BackendConfigFromEnv()
+	if err != nil {
+		t.Fatalf("Failed to read backend config: %v", err)
+	}
+	if os.Getenv(RegionEnv) == "" {
+		bc.Region = region
+	}
+	s3Client, err := bc.NewClient(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to create S3 client: %v", err)
+	}
+	return s3Client
+}
+
+// newCassetteClient is newBackendClient with the client's traffic recorded
+// to, or replayed from, testdata/<test name>.json as S3_CASSETTE says. A
+// replayed test needs no credentials and sends nothing. In CI a test with
+// no cassette is skipped rather than run live, unless S3_CASSETTE is set.
+func newCassetteClient(t *testing.T, region string) (*s3.Client, *cassette.Recorder) {
+	t.Helper()
+	path := filepath.Join("testdata", t.Name()+".json")
+	mode := cassette.ModeFromEnv(path)
+	if mode == cassette.ModeOff && os.Getenv(cassette.ModeEnv) == "" && os.Getenv("CI") != "" {
+		t.Skipf("No cassette at %s to replay in CI; record one with %s=record, or run live with %s=off",
+			path, cassette.ModeEnv, cassette.ModeEnv)
+	}
+	rec := cassette.New(t, path, mode)
+	bc, err := BackendConfigFromEnv()
+	if err != nil {
+		t.Fatalf("Failed to read backend config: %v", err)
+	}
+	if os.Getenv(RegionEnv) == "" {
+		bc.Region = region
+	}
+	var loadOpts []func(*config.LoadOptions) error
+	if rec.Mode() == cassette.ModeReplay {
+		loadOpts = append(loadOpts, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider("AKIDREPLAY", "replay", "")))
+	}
+	cfg, err := bc.Load(context.Background(), loadOpts...)
+	if err != nil {
+		t.Fatalf("Failed to load AWS config: %v", err)
+	}
+	return s3.NewFromConfig(cfg, bc.S3Options, func(o *s3.Options) {
+		o.HTTPClient = rec.Client(o.HTTPClient)
+	}), rec
+}
@@ -0,0 +1,226 @@
+package s3
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Backend names something that speaks S3.
+type Backend string
+
+const (
+	// BackendAWS is real S3 with the default credential chain.
+	BackendAWS Backend = "aws"
+	// BackendLocalStack is LocalStack, addressed path style with test
+	// credentials.
+	BackendLocalStack Backend = "localstack"
+	// BackendFake is an in-process fake such as s3fake behind httptest. Its
+	// Endpoint must be set.
+	BackendFake Backend = "fake"
+	// BackendProxy is real S3 reached through a proxy such as Toxiproxy:
+	// connections for *.amazonaws.com are dialled at ProxyAddr instead.
+	BackendProxy Backend = "proxy"
+)
+
+// Environment variables read by BackendConfigFromEnv. Each overrides the
+// matching field of the file named by BackendConfigEnv, if there is one.
+const (
+	BackendEnv       = "S3_BACKEND"
+	BackendConfigEnv = "S3_BACKEND_CONFIG"
+	RegionEnv        = "S3_REGION"
+	EndpointEnv      = "S3_ENDPOINT"
+	ProxyAddrEnv     = "S3_PROXY_ADDR"
+	CABundleEnv      = "S3_CA_BUNDLE"
+)
+
+// Defaults for the fields of BackendConfig.
+const (
+	defaultBackendRegion      = "eu-west-2"
+	defaultLocalStackEndpoint = "https://localhost.localstack.cloud:4566"
+	defaultProxyAddr          = "localhost:8443"
+)
+
+// BackendConfig describes how to reach a backend. The zero value is real
+// AWS in eu-west-2. It can be read from the environment or a small JSON
+// file with BackendConfigFromEnv:
+//
+//	{"backend": "localstack", "region": "eu-west-2"}
+type BackendConfig struct {
+	Backend Backend `json:"backend"`
+	Region  string  `json:"region"`
+	// Endpoint is the base URL for BackendLocalStack, which defaults to
+	// https://localhost.localstack.cloud:4566, and BackendFake.
+	Endpoint string `json:"endpoint"`
+	// ProxyAddr is the host:port BackendProxy dials, localhost:8443 by
+	// default.
+	ProxyAddr string `json:"proxy_addr"`
+	// ProxyServerName is the TLS server name BackendProxy verifies, for an
+	// upstream whose certificate is not for *.amazonaws.com.
+	ProxyServerName string `json:"proxy_server_name"`
+	// CABundle is a PEM file of extra certificates to trust.
+	CABundle string `json:"ca_bundle"`
+	// RootCAs are extra certificates to trust, such as an httptest.Server's.
+	RootCAs []*x509.Certificate `json:"-"`
+}
+
+// BackendConfigFromEnv reads the file named by S3_BACKEND_CONFIG, if set,
+// and then applies S3_BACKEND, S3_REGION, S3_ENDPOINT, S3_PROXY_ADDR and
+// S3_CA_BUNDLE on top.
+func BackendConfigFromEnv() (BackendConfig, error) {
+	var c BackendConfig
+	if path := os.Getenv(BackendConfigEnv); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return c, fmt.Errorf("read backend config: %w", err)
+		}
+		if err := json.Unmarshal(data, &c); err != nil {
+			return c, fmt.Errorf("parse backend config %s: %w", path, err)
+		}
+	}
+	for env, field := range map[string]*string{
+		RegionEnv:    &c.Region,
+		EndpointEnv:  &c.Endpoint,
+		ProxyAddrEnv: &c.ProxyAddr,
+		CABundleEnv:  &c.CABundle,
+	} {
+		if v := os.Getenv(env); v != "" {
+			*field = v
+		}
+	}
+	if v := os.Getenv(BackendEnv); v != "" {
+		c.Backend = Backend(v)
+	}
+	return c, c.withDefaults().validate()
+}
+
+func (c BackendConfig) withDefaults() BackendConfig {
+	if c.Backend == "" {
+		c.Backend = BackendAWS
+	}
+	if c.Region == "" {
+		c.Region = defaultBackendRegion
+	}
+	if c.Backend == BackendLocalStack && c.Endpoint == "" {
+		c.Endpoint = defaultLocalStackEndpoint
+	}
+	if c.Backend == BackendProxy && c.ProxyAddr == "" {
+		c.ProxyAddr = defaultProxyAddr
+	}
+	return c
+}
+
+func (c BackendConfig) validate() error {
+	switch c.Backend {
+	case BackendAWS, BackendLocalStack, BackendProxy:
+		return nil
+	case BackendFake:
+		if c.Endpoint == "" {
+			return fmt.Errorf("backend %s: endpoint is not set", c.Backend)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown backend %q: want aws, localstack, fake or proxy", c.Backend)
+}
+
+// Load builds an aws.Config for the backend with config.LoadDefaultConfig.
+// optFns are applied last, so they can override anything Load sets.
+func (c BackendConfig) Load(ctx context.Context, optFns ...func(*config.LoadOptions) error) (aws.Config, error) {
+	c = c.withDefaults()
+	if err := c.validate(); err != nil {
+		return aws.Config{}, err
+	}
+	httpClient, err := c.httpClient()
+	if err != nil {
+		return aws.Config{}, err
+	}
+	opts := []func(*config.LoadOptions) error{
+		config.WithRegion(c.Region),
+		config.WithHTTPClient(httpClient),
+	}
+	if c.Backend == BackendLocalStack || c.Backend == BackendFake {
+		opts = append(opts,
+			config.WithBaseEndpoint(c.Endpoint),
+			config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider("test", "test", "")),
+		)
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, append(opts, optFns...)...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("load config for backend %s: %w", c.Backend, err)
+	}
+	return cfg, nil
+}
+
+// S3Options sets the client options the backend needs, for use with
+// s3.NewFromConfig. LocalStack and fakes are addressed path style.
+func (c BackendConfig) S3Options(o *s3.Options) {
+	switch c.withDefaults().Backend {
+	case BackendLocalStack, BackendFake:
+		o.UsePathStyle = true
+	}
+}
+
+// NewClient is Load followed by s3.NewFromConfig with S3Options.
+func (c BackendConfig) NewClient(ctx context.Context, optFns ...func(*s3.Options)) (*s3.Client, error) {
+	cfg, err := c.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s3.NewFromConfig(cfg, append([]func(*s3.Options){c.S3Options}, optFns...)...), nil
+}
+
+// httpClient returns the SDK's buildable client, with the extra trusted
+// certificates and, for BackendProxy, the redirect. It stays buildable so
+// that LoadDefaultConfig can still apply AWS_CA_BUNDLE on top.
+func (c BackendConfig) httpClient() (*awshttp.BuildableClient, error) {
+	client := awshttp.NewBuildableClient()
+	var pool *x509.CertPool
+	if c.CABundle != "" || len(c.RootCAs) > 0 {
+		var err error
+		if pool, err = x509.SystemCertPool(); err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, cert := range c.RootCAs {
+			pool.AddCert(cert)
+		}
+	}
+	if c.CABundle != "" {
+		pem, err := os.ReadFile(c.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("read CA bundle: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA bundle %s has no PEM certificates", c.CABundle)
+		}
+	}
+	if pool == nil && c.Backend != BackendProxy {
+		return client, nil
+	}
+	return client.WithTransportOptions(func(tr *http.Transport) {
+		// ConfigureRedirect keeps this tls.Config, so RootCAs added to it
+		// later, for AWS_CA_BUNDLE, still apply.
+		if tr.TLSClientConfig == nil {
+			tr.TLSClientConfig = &tls.Config{}
+		}
+		if pool != nil {
+			tr.TLSClientConfig.RootCAs = pool
+		}
+		if c.Backend == BackendProxy {
+			opts := []RedirectOption{RedirectHost("*.amazonaws.com", c.ProxyAddr)}
+			if c.ProxyServerName != "" {
+				opts = append(opts, RedirectServerName("*.amazonaws.com", c.ProxyServerName))
+			}
+			ConfigureRedirect(tr, opts...)
+		}
+	}), nil
+}
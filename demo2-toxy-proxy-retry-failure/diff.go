@@ -0,0 +1,470 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// Names of the BucketSpec fields that Diff compares. They appear in
+// BucketChange.Field.
+const (
+	FieldObjectOwnership   = "ObjectOwnership"
+	FieldPublicAccessBlock = "PublicAccessBlock"
+	FieldEncryption        = "Encryption"
+	FieldVersioning        = "Versioning"
+	FieldTags              = "Tags"
+	FieldLifecycleRules    = "LifecycleRules"
+	FieldPolicy            = "Policy"
+)
+
+// BucketReaderAPI is the part of the S3 API that Diff uses to read a
+// bucket's live configuration. *s3.Client implements it.
+type BucketReaderAPI interface {
+	GetBucketOwnershipControls(ctx context.Context, params *s3.GetBucketOwnershipControlsInput, optFns ...func(*s3.Options)) (*s3.GetBucketOwnershipControlsOutput, error)
+	GetPublicAccessBlock(ctx context.Context, params *s3.GetPublicAccessBlockInput, optFns ...func(*s3.Options)) (*s3.GetPublicAccessBlockOutput, error)
+	GetBucketEncryption(ctx context.Context, params *s3.GetBucketEncryptionInput, optFns ...func(*s3.Options)) (*s3.GetBucketEncryptionOutput, error)
+	GetBucketVersioning(ctx context.Context, params *s3.GetBucketVersioningInput, optFns ...func(*s3.Options)) (*s3.GetBucketVersioningOutput, error)
+	GetBucketTagging(ctx context.Context, params *s3.GetBucketTaggingInput, optFns ...func(*s3.Options)) (*s3.GetBucketTaggingOutput, error)
+	GetBucketLifecycleConfiguration(ctx context.Context, params *s3.GetBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLifecycleConfigurationOutput, error)
+	GetBucketPolicy(ctx context.Context, params *s3.GetBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.GetBucketPolicyOutput, error)
+}
+
+// BucketReconcilerAPI is what Reconcile needs: reading the live
+// configuration and writing the parts that drifted.
+type BucketReconcilerAPI interface {
+	BucketAPI
+	BucketReaderAPI
+}
+
+// BucketChange is one setting whose live value differs from the spec. Want
+// and Got hold the values in their S3 types; Got is nil when the setting is
+// not configured on the bucket.
+type BucketChange struct {
+	Field string
+	Want  any
+	Got   any
+}
+
+// BucketDiff is the result of comparing a bucket with a BucketSpec.
+type BucketDiff struct {
+	Bucket  string
+	Changes []BucketChange
+}
+
+// Empty reports whether the bucket matches the spec.
+func (d BucketDiff) Empty() bool {
+	return len(d.Changes) == 0
+}
+
+// Fields returns the names of the fields that differ, in the order
+// EnsureBucket would apply them.
+func (d BucketDiff) Fields() []string {
+	fields := make([]string, 0, len(d.Changes))
+	for _, c := range d.Changes {
+		fields = append(fields, c.Field)
+	}
+	return fields
+}
+
+func (d BucketDiff) String() string {
+	if d.Empty() {
+		return fmt.Sprintf("bucket %s: no changes", d.Bucket)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "bucket %s:", d.Bucket)
+	for _, c := range d.Changes {
+		fmt.Fprintf(&b, "\n  %s: want %s, got %s", c.Field, describe(c.Want), describe(c.Got))
+	}
+	return b.String()
+}
+
+func describe(v any) string {
+	if v == nil || reflect.ValueOf(v).Kind() == reflect.Pointer && reflect.ValueOf(v).IsNil() {
+		return "<unset>"
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(out)
+}
+
+// notConfiguredCodes are the error codes S3 uses to say a bucket has no
+// configuration of a given kind, rather than that the request failed.
+var notConfiguredCodes = map[string]bool{
+	"OwnershipControlsNotFoundError":                 true,
+	"NoSuchPublicAccessBlockConfiguration":           true,
+	"ServerSideEncryptionConfigurationNotFoundError": true,
+	"NoSuchTagSet":                 true,
+	"NoSuchLifecycleConfiguration": true,
+	"NoSuchBucketPolicy":           true,
+}
+
+func isNotConfigured(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && notConfiguredCodes[apiErr.ErrorCode()]
+}
+
+// Diff reads the live configuration of spec.Name and reports every field of
+// spec that does not match. Fields left at their zero value in spec are not
+// compared.
+func Diff(ctx context.Context, client BucketReaderAPI, spec BucketSpec, opts ...Option) (BucketDiff, error) {
+	o := newOptions(opts)
+	diff := BucketDiff{Bucket: spec.Name}
+	for _, check := range specChecks(spec) {
+		var live any
+		err := retry(ctx, o, check.op, spec.Name, func(ctx context.Context, _ int) error {
+			var err error
+			live, err = check.read(ctx, client, spec.Name)
+			if isNotConfigured(err) {
+				live, err = nil, nil
+			}
+			return err
+		})
+		if err != nil {
+			o.logger.Error("Failed to read S3 bucket configuration", "bucket", spec.Name, "op", check.op, "error", err)
+			return BucketDiff{}, fmt.Errorf("diff bucket %s: %s: %w", spec.Name, check.op, err)
+		}
+		if !check.equal(live) {
+			diff.Changes = append(diff.Changes, BucketChange{Field: check.field, Want: check.want, Got: live})
+		}
+	}
+	return diff, nil
+}
+
+// Reconcile compares spec.Name with spec and applies only the fields that
+// differ, using the same Put* calls as EnsureBucket. It returns the diff it
+// acted on. The bucket must already exist; use EnsureBucket to create it.
+func Reconcile(ctx context.Context, client BucketReconcilerAPI, spec BucketSpec, opts ...Option) (BucketDiff, error) {
+	o := newOptions(opts)
+	diff, err := Diff(ctx, client, spec, opts...)
+	if err != nil {
+		return BucketDiff{}, err
+	}
+	if diff.Empty() {
+		o.logger.Info("S3 bucket matches spec", "bucket", spec.Name)
+		return diff, nil
+	}
+	changed := diff.Fields()
+	for _, step := range specSteps(spec) {
+		if !slices.Contains(changed, step.field) {
+			continue
+		}
+		err := retry(ctx, o, step.name, spec.Name, func(ctx context.Context, _ int) error {
+			return step.apply(ctx, client, spec.Name)
+		})
+		if err != nil {
+			o.logger.Error("Failed to reconcile S3 bucket", "bucket", spec.Name, "step", step.name, "error", err)
+			return diff, &EnsureBucketError{Bucket: spec.Name, Step: step.name, Err: err}
+		}
+		o.logger.Info("Reconciled S3 bucket configuration", "bucket", spec.Name, "field", step.field)
+	}
+	return diff, nil
+}
+
+// specCheck reads one live setting and compares it with the spec. read
+// returns the value in the same type as want, or an error S3 uses for an
+// unconfigured setting.
+type specCheck struct {
+	field string
+	op    string
+	want  any
+	read  func(ctx context.Context, client BucketReaderAPI, bucket string) (any, error)
+	equal func(live any) bool
+}
+
+func specChecks(spec BucketSpec) []specCheck {
+	var checks []specCheck
+	if spec.ObjectOwnership != "" {
+		checks = append(checks, specCheck{
+			field: FieldObjectOwnership,
+			op:    "GetBucketOwnershipControls",
+			want:  spec.ObjectOwnership,
+			read: func(ctx context.Context, client BucketReaderAPI, bucket string) (any, error) {
+				out, err := client.GetBucketOwnershipControls(ctx, &s3.GetBucketOwnershipControlsInput{Bucket: aws.String(bucket)}, sdkCallOptions(ctx)...)
+				if err != nil {
+					return nil, err
+				}
+				if out.OwnershipControls == nil || len(out.OwnershipControls.Rules) == 0 {
+					return nil, nil
+				}
+				return out.OwnershipControls.Rules[0].ObjectOwnership, nil
+			},
+			equal: func(live any) bool { return live == any(spec.ObjectOwnership) },
+		})
+	}
+	if spec.PublicAccessBlock != nil {
+		checks = append(checks, specCheck{
+			field: FieldPublicAccessBlock,
+			op:    "GetPublicAccessBlock",
+			want:  spec.PublicAccessBlock,
+			read: func(ctx context.Context, client BucketReaderAPI, bucket string) (any, error) {
+				out, err := client.GetPublicAccessBlock(ctx, &s3.GetPublicAccessBlockInput{Bucket: aws.String(bucket)}, sdkCallOptions(ctx)...)
+				if err != nil {
+					return nil, err
+				}
+				return out.PublicAccessBlockConfiguration, nil
+			},
+			equal: func(live any) bool {
+				got, _ := live.(*types.PublicAccessBlockConfiguration)
+				return publicAccessBlockEqual(spec.PublicAccessBlock, got)
+			},
+		})
+	}
+	if spec.Encryption != nil {
+		checks = append(checks, specCheck{
+			field: FieldEncryption,
+			op:    "GetBucketEncryption",
+			want:  spec.Encryption,
+			read: func(ctx context.Context, client BucketReaderAPI, bucket string) (any, error) {
+				out, err := client.GetBucketEncryption(ctx, &s3.GetBucketEncryptionInput{Bucket: aws.String(bucket)}, sdkCallOptions(ctx)...)
+				if err != nil {
+					return nil, err
+				}
+				if out.ServerSideEncryptionConfiguration == nil || len(out.ServerSideEncryptionConfiguration.Rules) == 0 {
+					return nil, nil
+				}
+				return &out.ServerSideEncryptionConfiguration.Rules[0], nil
+			},
+			equal: func(live any) bool {
+				got, _ := live.(*types.ServerSideEncryptionRule)
+				return encryptionRuleEqual(spec.Encryption, got)
+			},
+		})
+	}
+	if spec.Versioning != "" {
+		checks = append(checks, specCheck{
+			field: FieldVersioning,
+			op:    "GetBucketVersioning",
+			want:  spec.Versioning,
+			read: func(ctx context.Context, client BucketReaderAPI, bucket string) (any, error) {
+				out, err := client.GetBucketVersioning(ctx, &s3.GetBucketVersioningInput{Bucket: aws.String(bucket)}, sdkCallOptions(ctx)...)
+				if err != nil {
+					return nil, err
+				}
+				return out.Status, nil
+			},
+			equal: func(live any) bool { return live == any(spec.Versioning) },
+		})
+	}
+	if len(spec.Tags) > 0 {
+		checks = append(checks, specCheck{
+			field: FieldTags,
+			op:    "GetBucketTagging",
+			want:  spec.Tags,
+			read: func(ctx context.Context, client BucketReaderAPI, bucket string) (any, error) {
+				return bucketTags(ctx, client, bucket)
+			},
+			// Tags the spec does not mention are not drift: EnsureBucket
+			// keeps them.
+			equal: func(live any) bool {
+				got, _ := live.(map[string]string)
+				for key, value := range spec.Tags {
+					if v, ok := got[key]; !ok || v != value {
+						return false
+					}
+				}
+				return true
+			},
+		})
+	}
+	if len(spec.LifecycleRules) > 0 {
+		checks = append(checks, specCheck{
+			field: FieldLifecycleRules,
+			op:    "GetBucketLifecycleConfiguration",
+			want:  spec.LifecycleRules,
+			read: func(ctx context.Context, client BucketReaderAPI, bucket string) (any, error) {
+				out, err := client.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String(bucket)}, sdkCallOptions(ctx)...)
+				if err != nil {
+					return nil, err
+				}
+				return out.Rules, nil
+			},
+			equal: func(live any) bool {
+				got, _ := live.([]types.LifecycleRule)
+				return lifecycleRulesEqual(spec.LifecycleRules, got)
+			},
+		})
+	}
+	if spec.Policy != "" {
+		checks = append(checks, specCheck{
+			field: FieldPolicy,
+			op:    "GetBucketPolicy",
+			want:  spec.Policy,
+			read: func(ctx context.Context, client BucketReaderAPI, bucket string) (any, error) {
+				out, err := client.GetBucketPolicy(ctx, &s3.GetBucketPolicyInput{Bucket: aws.String(bucket)}, sdkCallOptions(ctx)...)
+				if err != nil {
+					return nil, err
+				}
+				return aws.ToString(out.Policy), nil
+			},
+			equal: func(live any) bool {
+				got, _ := live.(string)
+				return policyEqual(spec.Policy, got)
+			},
+		})
+	}
+	return checks
+}
+
+func publicAccessBlockEqual(want, got *types.PublicAccessBlockConfiguration) bool {
+	if got == nil {
+		got = &types.PublicAccessBlockConfiguration{}
+	}
+	return aws.ToBool(want.BlockPublicAcls) == aws.ToBool(got.BlockPublicAcls) &&
+		aws.ToBool(want.BlockPublicPolicy) == aws.ToBool(got.BlockPublicPolicy) &&
+		aws.ToBool(want.IgnorePublicAcls) == aws.ToBool(got.IgnorePublicAcls) &&
+		aws.ToBool(want.RestrictPublicBuckets) == aws.ToBool(got.RestrictPublicBuckets)
+}
+
+func encryptionRuleEqual(want, got *types.ServerSideEncryptionRule) bool {
+	if got == nil {
+		return false
+	}
+	wantDefault, gotDefault := want.ApplyServerSideEncryptionByDefault, got.ApplyServerSideEncryptionByDefault
+	if wantDefault == nil || gotDefault == nil {
+		return wantDefault == gotDefault
+	}
+	return wantDefault.SSEAlgorithm == gotDefault.SSEAlgorithm &&
+		aws.ToString(wantDefault.KMSMasterKeyID) == aws.ToString(gotDefault.KMSMasterKeyID) &&
+		aws.ToBool(want.BucketKeyEnabled) == aws.ToBool(got.BucketKeyEnabled)
+}
+
+// lifecycleRulesEqual compares rules by ID, ignoring the order S3 returns
+// them in, after normalising each one the way S3 does when it stores it. A
+// rule put without an ID gets one from S3, so it matches any live rule with
+// the same content.
+func lifecycleRulesEqual(want, got []types.LifecycleRule) bool {
+	if len(want) != len(got) {
+		return false
+	}
+	live := make(map[string]lifecycleRule, len(got))
+	for _, rule := range got {
+		live[aws.ToString(rule.ID)] = normalizeLifecycleRule(rule)
+	}
+	var unnamed []lifecycleRule
+	for _, rule := range want {
+		id := aws.ToString(rule.ID)
+		if id == "" {
+			unnamed = append(unnamed, normalizeLifecycleRule(rule))
+			continue
+		}
+		if g, ok := live[id]; !ok || g != normalizeLifecycleRule(rule) {
+			return false
+		}
+		delete(live, id)
+	}
+	for _, rule := range unnamed {
+		matched := false
+		for id, g := range live {
+			if g == rule {
+				delete(live, id)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// lifecycleRule is a types.LifecycleRule reduced to what it means, so that
+// the forms S3 treats alike compare equal: the legacy Prefix and a filter
+// prefix, a single filter tag and an And with one tag, a nil pointer and its
+// zero value, and lists in any order.
+type lifecycleRule struct {
+	status                    types.ExpirationStatus
+	prefix                    string
+	tags                      string
+	sizeGreaterThan           int64
+	sizeLessThan              int64
+	expirationDays            int32
+	expirationDate            string
+	expiredObjectDeleteMarker bool
+	abortAfterDays            int32
+	noncurrentDays            int32
+	newerNoncurrentVersions   int32
+	transitions               string
+	noncurrentTransitions     string
+}
+
+func normalizeLifecycleRule(rule types.LifecycleRule) lifecycleRule {
+	n := lifecycleRule{status: rule.Status, prefix: aws.ToString(rule.Prefix)}
+	var tags []string
+	// A filter holds its conditions either directly or under And, never
+	// both, so adding the two up picks whichever is set.
+	if f := rule.Filter; f != nil {
+		n.prefix += aws.ToString(f.Prefix)
+		n.sizeGreaterThan = aws.ToInt64(f.ObjectSizeGreaterThan)
+		n.sizeLessThan = aws.ToInt64(f.ObjectSizeLessThan)
+		if f.Tag != nil {
+			tags = append(tags, aws.ToString(f.Tag.Key)+"="+aws.ToString(f.Tag.Value))
+		}
+		if and := f.And; and != nil {
+			n.prefix += aws.ToString(and.Prefix)
+			n.sizeGreaterThan += aws.ToInt64(and.ObjectSizeGreaterThan)
+			n.sizeLessThan += aws.ToInt64(and.ObjectSizeLessThan)
+			for _, tag := range and.Tags {
+				tags = append(tags, aws.ToString(tag.Key)+"="+aws.ToString(tag.Value))
+			}
+		}
+	}
+	slices.Sort(tags)
+	n.tags = strings.Join(tags, "&")
+	if e := rule.Expiration; e != nil {
+		n.expirationDays = aws.ToInt32(e.Days)
+		n.expirationDate = lifecycleDate(e.Date)
+		n.expiredObjectDeleteMarker = aws.ToBool(e.ExpiredObjectDeleteMarker)
+	}
+	if a := rule.AbortIncompleteMultipartUpload; a != nil {
+		n.abortAfterDays = aws.ToInt32(a.DaysAfterInitiation)
+	}
+	if e := rule.NoncurrentVersionExpiration; e != nil {
+		n.noncurrentDays = aws.ToInt32(e.NoncurrentDays)
+		n.newerNoncurrentVersions = aws.ToInt32(e.NewerNoncurrentVersions)
+	}
+	var transitions []string
+	for _, t := range rule.Transitions {
+		transitions = append(transitions, fmt.Sprintf("%d/%s/%s", aws.ToInt32(t.Days), lifecycleDate(t.Date), t.StorageClass))
+	}
+	slices.Sort(transitions)
+	n.transitions = strings.Join(transitions, ",")
+	var noncurrent []string
+	for _, t := range rule.NoncurrentVersionTransitions {
+		noncurrent = append(noncurrent, fmt.Sprintf("%d/%d/%s", aws.ToInt32(t.NoncurrentDays), aws.ToInt32(t.NewerNoncurrentVersions), t.StorageClass))
+	}
+	slices.Sort(noncurrent)
+	n.noncurrentTransitions = strings.Join(noncurrent, ",")
+	return n
+}
+
+// lifecycleDate formats a lifecycle date in UTC, or "" for none.
+func lifecycleDate(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// policyEqual compares two policy documents as JSON values, so whitespace
+// and key order do not count as drift.
+func policyEqual(want, got string) bool {
+	var wantDoc, gotDoc any
+	if json.Unmarshal([]byte(want), &wantDoc) != nil || json.Unmarshal([]byte(got), &gotDoc) != nil {
+		return want == got
+	}
+	return reflect.DeepEqual(wantDoc, gotDoc)
+}
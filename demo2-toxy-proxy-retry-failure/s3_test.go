@@ -2,71 +2,35 @@ package s3
 
 import (
 	"context"
-	"crypto/tls"
-	"log/slog"
-	"net"
+	"errors"
 	"net/http"
+	"net/http/httptest"
+	"slices"
 	"testing"
 	"time"
 
-	toxiproxy "github.com/Shopify/toxiproxy/client"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/golangbot/testkit/faultinject"
+	"github.com/golangbot/testkit/s3fake"
+	"github.com/golangbot/testkit/testrun"
+	"github.com/golangbot/testkit/toxitest"
 )
 
 func Test_createS3BucketRetryFailure(t *testing.T) {
-	toxiClient := toxiproxy.NewClient("localhost:8474")
-	_, err := toxiClient.Populate([]toxiproxy.Proxy{{
-		Name:     "s3_proxy",
-		Listen:   "localhost:8443",
-		Upstream: "s3.eu-west-2.amazonaws.com:443",
-		Enabled:  true,
-	}})
-	if err != nil {
-		t.Fatalf("Failed to create Toxiproxy with error %s", err)
-	}
-
-	s3Proxy, err := toxiClient.Proxy("s3_proxy")
-	if err != nil {
-		t.Fatalf("Failed to get s3_proxy: %s", err)
-	}
-	latencyToxic, err := s3Proxy.AddToxic("latency", "latency", "upstream", 1.0, toxiproxy.Attributes{
-		"latency": 30000,
-	})
-	if err != nil {
-		t.Fatalf("Failed to add toxic: %s", err)
-	}
-	t.Logf("Added %s toxic to s3_proxy", latencyToxic.Name)
+	proxy := toxitest.New(t, "s3.eu-west-2.amazonaws.com:443")
+	proxy.AddToxic(toxitest.Latency(30 * time.Second).Upstream())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	region := "eu-west-2"
-	cfg, err := config.LoadDefaultConfig(ctx,
-		config.WithRegion(region),
-		config.WithHTTPClient(&http.Client{
-			Transport: &http.Transport{
-				DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-					var d net.Dialer
-					conn, err := d.DialContext(ctx, network, "localhost:8443")
-					if err != nil {
-						return nil, err
-					}
-					return tls.Client(conn, &tls.Config{
-						ServerName: "s3.eu-west-2.amazonaws.com",
-					}), nil
-				},
-			},
-		}),
-	)
+	s3Client, err := BackendConfig{Backend: BackendProxy, Region: region, ProxyAddr: proxy.Listen}.NewClient(ctx)
 	if err != nil {
-		slog.Error("Failed to load AWS config", "error", err)
-		return
+		t.Fatalf("Failed to create S3 client: %v", err)
 	}
-	s3Client := s3.NewFromConfig(cfg)
 
-	bucketName := "gopherconuk-2025-my-new-bucket"
+	bucketName := testrun.BucketName(t, newBucketName)
 	wantErr := false
 	defer deleteBucket(s3Client, bucketName, region)
 	if err := createS3Bucket(s3Client, bucketName, region); (err != nil) != wantErr {
@@ -78,3 +42,59 @@ func Test_createS3BucketRetryFailure(t *testing.T) {
 		t.Errorf("Failed to get S3 bucket: %v", err)
 	}
 }
+
+func Test_createS3BucketInjectedFaultsExhausted(t *testing.T) {
+	fake := s3fake.NewHandler()
+	ts := httptest.NewTLSServer(fake)
+	defer ts.Close()
+	s3Client, transport := s3fake.NewFaultyClient(ts, "eu-west-2",
+		faultinject.S3Error(http.StatusInternalServerError, "InternalError"),
+		faultinject.S3Error(http.StatusInternalServerError, "InternalError"),
+		faultinject.S3Error(http.StatusInternalServerError, "InternalError"),
+	)
+
+	bucketName := "gopherconuk-2025-my-new-bucket"
+	err := createS3Bucket(s3Client, bucketName, "eu-west-2", WithRetryPolicy(RetryPolicy{MaxAttempts: 3}))
+	if !errors.Is(err, ErrRetriesExhausted) {
+		t.Fatalf("createS3Bucket() error = %v, want ErrRetriesExhausted", err)
+	}
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) || len(retryErr.Attempts) != 3 {
+		t.Errorf("createS3Bucket() error = %v, want a *RetryError with 3 attempts", err)
+	}
+	if got := transport.Calls(); got != 3 {
+		t.Errorf("CreateBucket sent %d times, want 3", got)
+	}
+	if slices.Contains(fake.Buckets(), bucketName) {
+		t.Errorf("bucket %q was created, want every CreateBucket to fail", bucketName)
+	}
+}
+
+func Test_createS3BucketInjectedTimeouts(t *testing.T) {
+	ts := httptest.NewTLSServer(s3fake.NewHandler())
+	defer ts.Close()
+	s3Client, transport := s3fake.NewFaultyClient(ts, "eu-west-2",
+		faultinject.Timeout(),
+		faultinject.Timeout(),
+		faultinject.Timeout(),
+	)
+
+	err := createS3Bucket(s3Client, "gopherconuk-2025-my-new-bucket", "eu-west-2",
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3}), WithCreateTimeout(50*time.Millisecond))
+	if !errors.Is(err, ErrRetriesExhausted) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("createS3Bucket() error = %v, want it to match ErrRetriesExhausted and context.DeadlineExceeded", err)
+	}
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) || len(retryErr.Attempts) != 3 {
+		t.Fatalf("createS3Bucket() error = %v, want a *RetryError with 3 attempts", err)
+	}
+	for _, a := range retryErr.Attempts {
+		var timeoutErr *TimeoutError
+		if !errors.As(a.Err, &timeoutErr) || timeoutErr.Phase != PhaseCreateBucket {
+			t.Errorf("attempt %d error = %v, want a CreateBucket *TimeoutError", a.Attempt, a.Err)
+		}
+	}
+	if got := transport.Calls(); got != 3 {
+		t.Errorf("CreateBucket sent %d times, want 3", got)
+	}
+}
@@ -2,92 +2,59 @@ package s3
 
 import (
 	"context"
-	"crypto/tls"
-	"io"
-	"log/slog"
-	"net"
 	"net/http"
-	"os"
-	"strings"
+	"net/http/httptest"
+	"slices"
 	"testing"
 	"time"
 
-	toxiproxy "github.com/Shopify/toxiproxy/client"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/golangbot/testkit/clocktest"
+	"github.com/golangbot/testkit/faultinject"
+	"github.com/golangbot/testkit/logtest"
+	"github.com/golangbot/testkit/s3fake"
+	"github.com/golangbot/testkit/testrun"
+	"github.com/golangbot/testkit/toxitest"
 )
 
-func Test_createS3BucketSuccessfulRetry(t *testing.T) {
-	toxiClient := toxiproxy.NewClient("localhost:8474")
-	_, err := toxiClient.Populate([]toxiproxy.Proxy{{
-		Name:     "s3_proxy",
-		Listen:   "localhost:8443",
-		Upstream: "s3.eu-west-2.amazonaws.com:443",
-		Enabled:  true,
-	}})
-	if err != nil {
-		t.Fatalf("Failed to create Toxiproxy: %s", err)
-	}
-
-	s3Proxy, err := toxiClient.Proxy("s3_proxy")
-	if err != nil {
-		t.Fatalf("Failed to get s3_proxy: %s", err)
-	}
-	latencyToxic, err := s3Proxy.AddToxic("latency", "latency", "upstream", 1.0, toxiproxy.Attributes{
-		"latency": 30000,
+// createPastLatency runs create with proxy.DrivePastLatency, on its clock
+// and reporting attempts and retries to it.
+func createPastLatency(t *testing.T, proxy *toxitest.Proxy, create func(opts ...Option) error) error {
+	t.Helper()
+	return proxy.DrivePastLatency(defaultCreateTimeout, func(clock *clocktest.Fake, hooks toxitest.RetryHooks) error {
+		return create(WithClock(clock), WithRetryObserver(RetryObserverFuncs{
+			Attempt: func(e RetryEvent) {
+				if e.Err != nil {
+					hooks.Failed(e.Attempt)
+				}
+			},
+			Retry: func(e RetryEvent) { hooks.Retrying(e.Delay) },
+		}))
 	})
-	if err != nil {
-		t.Fatalf("Failed to add toxic: %s", err)
-	}
-	t.Logf("Added %s toxic to s3_proxy", latencyToxic.Name)
-
-	removeToxicErr := make(chan error)
-	go func() {
-		<-time.After(7 * time.Second)
-		err := s3Proxy.RemoveToxic("latency")
-		removeToxicErr <- err
-
-	}()
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+func Test_createS3BucketSuccessfulRetry(t *testing.T) {
+	proxy := toxitest.New(t, "s3.eu-west-2.amazonaws.com:443")
 
 	region := "eu-west-2"
-	cfg, err := config.LoadDefaultConfig(ctx,
-		config.WithRegion(region),
-		config.WithHTTPClient(&http.Client{
-			Transport: &http.Transport{
-				DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-					var d net.Dialer
-					conn, err := d.DialContext(ctx, network, "localhost:8443")
-					if err != nil {
-						return nil, err
-					}
-					return tls.Client(conn, &tls.Config{
-						ServerName: "s3.eu-west-2.amazonaws.com",
-					}), nil
-				},
-			},
-		}),
-	)
+	s3Client, err := BackendConfig{Backend: BackendProxy, Region: region, ProxyAddr: proxy.Listen}.NewClient(context.TODO())
 	if err != nil {
-		slog.Error("Failed to load AWS config", "error", err)
-		return
+		t.Fatalf("Failed to create S3 client: %v", err)
 	}
-	s3Client := s3.NewFromConfig(cfg)
 
 	// Capture logs to confirm retry behavior
-	var testLogs strings.Builder
-	w := io.MultiWriter(os.Stderr, &testLogs)
-	h := slog.NewTextHandler(w, nil)
-	slog.SetDefault(slog.New(h))
+	logger, logs := logtest.New()
 
-	bucketName := "gopherconuk-2025-my-new-bucket"
+	bucketName := testrun.BucketName(t, newBucketName)
 	wantErr := false
 
 	defer deleteBucket(s3Client, bucketName, region)
-	if err := createS3Bucket(s3Client, bucketName, region); (err != nil) != wantErr {
+	err = createPastLatency(t, proxy, func(opts ...Option) error {
+		return createS3Bucket(s3Client, bucketName, region,
+			append(opts, WithRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: ExponentialBackoff{Base: 250 * time.Millisecond}}), WithLogger(logger))...)
+	})
+	if (err != nil) != wantErr {
 		t.Errorf("createS3Bucket() error = %v, wantErr %v", err, wantErr)
 	}
 	if _, err := s3Client.HeadBucket(context.TODO(), &s3.HeadBucketInput{
@@ -95,11 +62,78 @@ func Test_createS3BucketSuccessfulRetry(t *testing.T) {
 	}); err != nil {
 		t.Errorf("Failed to get S3 bucket: %v", err)
 	}
-	// Wait for the toxic removal goroutine and check for errors
-	if err := <-removeToxicErr; err != nil {
-		t.Errorf("Failed to remove toxic: %v", err)
+	// Every retry must have waited exactly as the exponential schedule says
+	retries := logs.Find("Retrying S3 request")
+	if len(retries) == 0 {
+		t.Errorf("Expected at least one retry but did not find it in logs:\n%s", logs.Messages())
 	}
-	if !strings.Contains(testLogs.String(), "Failed to create S3 bucket") {
-		t.Errorf("Expected s3 bucket failure but did not find it in logs")
+	for i, r := range retries {
+		if got, want := r.Duration("delay"), 250*time.Millisecond<<i; got != want {
+			t.Errorf("retry %d waited %v, want %v", i+1, got, want)
+		}
+	}
+	if failures := logs.Find("Failed to create S3 bucket"); len(failures) == 0 {
+		t.Errorf("Expected s3 bucket failure but did not find it in logs:\n%s", logs.Messages())
+	} else if got := failures[0]; got.String("bucket") != bucketName || got.Int("attempt") != 1 || got.Err("error") == nil {
+		t.Errorf("first failure logged bucket=%q attempt=%d error=%v, want bucket=%q attempt=1 and an error",
+			got.String("bucket"), got.Int("attempt"), got.Err("error"), bucketName)
+	}
+}
+
+func Test_createS3BucketInjectedTimeoutRecovers(t *testing.T) {
+	fake := s3fake.NewHandler()
+	ts := httptest.NewTLSServer(fake)
+	defer ts.Close()
+	s3Client, transport := s3fake.NewFaultyClient(ts, "eu-west-2", faultinject.Timeout())
+
+	logger, logs := logtest.New()
+
+	bucketName := "gopherconuk-2025-my-new-bucket"
+	if err := createS3Bucket(s3Client, bucketName, "eu-west-2",
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3}), WithCreateTimeout(50*time.Millisecond), WithLogger(logger)); err != nil {
+		t.Fatalf("createS3Bucket() error = %v", err)
+	}
+	if got := transport.Calls(); got != 2 {
+		t.Errorf("CreateBucket sent %d times, want 2", got)
+	}
+	if !slices.Contains(fake.Buckets(), bucketName) {
+		t.Errorf("bucket %q was not created", bucketName)
+	}
+	if retries := logs.Find("Retrying S3 request"); len(retries) != 1 {
+		t.Errorf("logged %d retries, want 1:\n%s", len(retries), logs.Messages())
+	}
+}
+
+func Test_createS3BucketInjectedFaultsRecover(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule []faultinject.Fault
+		// wantCreates is the number of CreateBucket requests sent. A reset
+		// after the request reached the server needs no second one, as the
+		// retry finds the bucket with HeadBucket.
+		wantCreates int
+	}{
+		{"slow down", []faultinject.Fault{faultinject.S3Error(http.StatusServiceUnavailable, "SlowDown")}, 2},
+		{"connection reset", []faultinject.Fault{faultinject.ConnReset(), faultinject.ConnReset()}, 3},
+		{"reset after send", []faultinject.Fault{faultinject.ResetAfterSend()}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := s3fake.NewHandler()
+			ts := httptest.NewTLSServer(fake)
+			defer ts.Close()
+			s3Client, transport := s3fake.NewFaultyClient(ts, "eu-west-2", tt.schedule...)
+
+			bucketName := "gopherconuk-2025-my-new-bucket"
+			if err := createS3Bucket(s3Client, bucketName, "eu-west-2", WithRetryPolicy(RetryPolicy{MaxAttempts: 3})); err != nil {
+				t.Fatalf("createS3Bucket() error = %v", err)
+			}
+			if got := transport.Calls(); got != tt.wantCreates {
+				t.Errorf("CreateBucket sent %d times, want %d", got, tt.wantCreates)
+			}
+			if !slices.Contains(fake.Buckets(), bucketName) {
+				t.Errorf("bucket %q was not created", bucketName)
+			}
+		})
 	}
 }
@@ -0,0 +1,161 @@
+package s3
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"path"
+	"time"
+)
+
+// redirectRule sends connections for hosts matching pattern to target.
+type redirectRule struct {
+	pattern    string
+	target     string
+	serverName string
+}
+
+type redirectOptions struct {
+	rules       []redirectRule
+	serverNames []redirectRule
+	rootCAs     []*x509.Certificate
+}
+
+// RedirectOption configures NewRedirectTransport.
+type RedirectOption func(*redirectOptions)
+
+// RedirectHost sends connections for hosts matching pattern to target
+// instead. pattern uses path.Match syntax against the bare hostname, so
+// "*.s3.eu-west-2.amazonaws.com" covers virtual-hosted bucket names. target
+// is a host:port, or a host alone to keep the original port. Rules are
+// tried in the order given; hosts that match none are dialled as usual.
+func RedirectHost(pattern, target string) RedirectOption {
+	return func(o *redirectOptions) {
+		o.rules = append(o.rules, redirectRule{pattern: pattern, target: target})
+	}
+}
+
+// RedirectServerName makes TLS connections for hosts matching pattern
+// present and verify name instead of the hostname, for upstreams whose
+// certificate was issued for a different name, such as LocalStack behind a
+// proxy.
+func RedirectServerName(pattern, name string) RedirectOption {
+	return func(o *redirectOptions) {
+		o.serverNames = append(o.serverNames, redirectRule{pattern: pattern, serverName: name})
+	}
+}
+
+// RedirectRootCAs trusts certs, such as an httptest.Server's certificate, in
+// addition to the system roots.
+func RedirectRootCAs(certs ...*x509.Certificate) RedirectOption {
+	return func(o *redirectOptions) {
+		o.rootCAs = append(o.rootCAs, certs...)
+	}
+}
+
+// NewRedirectTransport returns a copy of http.DefaultTransport that dials
+// redirected hosts at their target. Everything above the dial is left to
+// net/http, so connection pooling stays keyed by the original host, HTTP/2
+// is still negotiated and SNI carries the original hostname unless
+// RedirectServerName says otherwise. Use it with Toxiproxy, LocalStack or an
+// httptest.Server:
+//
+//	transport := NewRedirectTransport(
+//		RedirectHost("*.amazonaws.com", "localhost:8443"),
+//		RedirectRootCAs(ts.Certificate()),
+//	)
+//	cfg, err := config.LoadDefaultConfig(ctx,
+//		config.WithHTTPClient(&http.Client{Transport: transport}))
+func NewRedirectTransport(opts ...RedirectOption) *http.Transport {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	ConfigureRedirect(tr, opts...)
+	return tr
+}
+
+// ConfigureRedirect applies opts to an existing transport, for callers that
+// build theirs another way, such as awshttp.BuildableClient's
+// WithTransportOptions.
+func ConfigureRedirect(tr *http.Transport, opts ...RedirectOption) {
+	var o redirectOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	var rootCAs *x509.CertPool
+	if len(o.rootCAs) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, cert := range o.rootCAs {
+			pool.AddCert(cert)
+		}
+		rootCAs = pool
+	}
+	tlsConfig := tr.TLSClientConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	if rootCAs != nil {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, o.target(addr))
+	}
+	tr.DialContext = dial
+	tr.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		config := tlsConfig.Clone()
+		if config.ServerName == "" {
+			config.ServerName = o.serverName(addr)
+		}
+		if len(config.NextProtos) == 0 && tr.ForceAttemptHTTP2 {
+			config.NextProtos = []string{"h2", "http/1.1"}
+		}
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+}
+
+// target returns where to dial for addr.
+func (o *redirectOptions) target(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	for _, rule := range o.rules {
+		if ok, _ := path.Match(rule.pattern, host); !ok {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(rule.target); err == nil {
+			return rule.target
+		}
+		return net.JoinHostPort(rule.target, port)
+	}
+	return addr
+}
+
+// serverName returns the TLS server name for addr.
+func (o *redirectOptions) serverName(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	for _, rule := range o.serverNames {
+		if ok, _ := path.Match(rule.pattern, host); ok {
+			return rule.serverName
+		}
+	}
+	return host
+}
@@ -0,0 +1,151 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// ErrorClass says what the retry loop should do with an error.
+type ErrorClass int
+
+const (
+	// Retryable errors are transient: timeouts, 5xx responses, throttling
+	// and dropped connections.
+	Retryable ErrorClass = iota
+	// Terminal errors will not go away by trying again, such as an invalid
+	// bucket name or a name taken by another account.
+	Terminal
+	// SuccessEquivalent errors mean the desired state already holds, such as
+	// BucketAlreadyOwnedByYou after an earlier attempt went through.
+	SuccessEquivalent
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case Retryable:
+		return "retryable"
+	case Terminal:
+		return "terminal"
+	case SuccessEquivalent:
+		return "success-equivalent"
+	}
+	return "unknown"
+}
+
+// ClassifierRule inspects err and reports its class. Returning ok == false
+// defers to the next rule.
+type ClassifierRule func(err error) (class ErrorClass, ok bool)
+
+// Classifier sorts errors into ErrorClass values. Its Rules are tried in
+// order before DefaultClassifierRules; the first rule that recognises an
+// error wins. Errors that no rule recognises are treated as Retryable, which
+// matches how createS3Bucket behaved before errors were classified.
+type Classifier struct {
+	Rules []ClassifierRule
+}
+
+// Classify returns the class of err.
+func (c Classifier) Classify(err error) ErrorClass {
+	for _, rule := range c.Rules {
+		if class, ok := rule(err); ok {
+			return class
+		}
+	}
+	for _, rule := range DefaultClassifierRules() {
+		if class, ok := rule(err); ok {
+			return class
+		}
+	}
+	return Retryable
+}
+
+// WithClassifierRules adds rules that run ahead of the default ones, so they
+// can override how a particular error is handled.
+func WithClassifierRules(rules ...ClassifierRule) Option {
+	return func(o *options) {
+		o.classifier.Rules = append(o.classifier.Rules, rules...)
+	}
+}
+
+// DefaultClassifierRules returns the built-in rules: S3 error codes first,
+// then the HTTP status code, then transport-level failures.
+func DefaultClassifierRules() []ClassifierRule {
+	return []ClassifierRule{classifyAPIError, classifyHTTPStatus, classifyTransportError}
+}
+
+var (
+	retryableErrorCodes = map[string]bool{
+		"SlowDown":             true,
+		"Throttling":           true,
+		"ThrottlingException":  true,
+		"RequestTimeout":       true,
+		"RequestTimeTooSkewed": true,
+		"InternalError":        true,
+		"ServiceUnavailable":   true,
+		"OperationAborted":     true,
+	}
+	terminalErrorCodes = map[string]bool{
+		(&types.BucketAlreadyExists{}).ErrorCode(): true,
+		"InvalidBucketName":                        true,
+		"AccessDenied":                             true,
+		"AllAccessDisabled":                        true,
+		"InvalidAccessKeyId":                       true,
+		"SignatureDoesNotMatch":                    true,
+		"InvalidLocationConstraint":                true,
+		"IllegalLocationConstraintException":       true,
+		"TooManyBuckets":                           true,
+	}
+)
+
+func classifyAPIError(err error) (ErrorClass, bool) {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return 0, false
+	}
+	switch code := apiErr.ErrorCode(); {
+	case code == (&types.BucketAlreadyOwnedByYou{}).ErrorCode():
+		return SuccessEquivalent, true
+	case retryableErrorCodes[code]:
+		return Retryable, true
+	case terminalErrorCodes[code]:
+		return Terminal, true
+	}
+	return 0, false
+}
+
+func classifyHTTPStatus(err error) (ErrorClass, bool) {
+	var statusErr interface{ HTTPStatusCode() int }
+	if !errors.As(err, &statusErr) {
+		return 0, false
+	}
+	switch status := statusErr.HTTPStatusCode(); {
+	case status == http.StatusTooManyRequests, status >= 500:
+		return Retryable, true
+	case status >= 400:
+		return Terminal, true
+	}
+	return 0, false
+}
+
+func classifyTransportError(err error) (ErrorClass, bool) {
+	var sendErr *smithyhttp.RequestSendError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.As(err, &sendErr),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return Retryable, true
+	}
+	return 0, false
+}
@@ -2,92 +2,63 @@ package s3
 
 import (
 	"context"
-	"crypto/tls"
-	"io"
-	"log/slog"
-	"net"
-	"net/http"
-	"os"
-	"strings"
+	"crypto/x509"
+	"net/http/httptest"
+	"slices"
 	"testing"
 	"time"
 
-	toxiproxy "github.com/Shopify/toxiproxy/client"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/golangbot/testkit/clocktest"
+	"github.com/golangbot/testkit/logtest"
+	"github.com/golangbot/testkit/s3fake"
+	"github.com/golangbot/testkit/testrun"
+	"github.com/golangbot/testkit/toxitest"
 )
 
-func configureToxiProxy(t *testing.T, removeToxicErrCh chan error) {
-	toxiClient := toxiproxy.NewClient("localhost:8474")
-	_, err := toxiClient.Populate([]toxiproxy.Proxy{{
-		Name:     "s3_proxy",
-		Listen:   "localhost:8443",
-		Upstream: "localhost.localstack.cloud:4566",
-		Enabled:  true,
-	}})
-	if err != nil {
-		t.Fatalf("Failed to create toxy proxy: %s", err)
-	}
-
-	s3Proxy, err := toxiClient.Proxy("s3_proxy")
-	if err != nil {
-		t.Fatalf("Failed to get s3_proxy: %s", err)
-	}
-
-	_, err = s3Proxy.AddToxic("latency", "latency", "upstream", 1.0, toxiproxy.Attributes{
-		"latency": 30000,
+// createPastLatency runs create with proxy.DrivePastLatency, on its clock
+// and reporting attempts and retries to it.
+func createPastLatency(t *testing.T, proxy *toxitest.Proxy, create func(opts ...Option) error) error {
+	t.Helper()
+	return proxy.DrivePastLatency(defaultCreateTimeout, func(clock *clocktest.Fake, hooks toxitest.RetryHooks) error {
+		return create(WithClock(clock), WithRetryObserver(RetryObserverFuncs{
+			Attempt: func(e RetryEvent) {
+				if e.Err != nil {
+					hooks.Failed(e.Attempt)
+				}
+			},
+			Retry: func(e RetryEvent) { hooks.Retrying(e.Delay) },
+		}))
 	})
-	if err != nil {
-		t.Fatalf("Failed to add toxic: %s", err)
-	}
-
-	go func() {
-		<-time.After(7 * time.Second)
-		err := s3Proxy.RemoveToxic("latency")
-		removeToxicErrCh <- err
-
-	}()
 }
 
 func Test_createS3BucketSuccessfulRetry(t *testing.T) {
-	removeToxicErr := make(chan error)
-	configureToxiProxy(t, removeToxicErr)
+	proxy := toxitest.New(t, "localhost.localstack.cloud:4566")
 
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion("eu-west-2"),
-		config.WithHTTPClient(&http.Client{
-			Transport: &http.Transport{
-				DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-					var d net.Dialer
-					conn, err := d.DialContext(ctx, network, "localhost:8443")
-					if err != nil {
-						return nil, err
-					}
-					return tls.Client(conn, &tls.Config{
-						ServerName: "localhost.localstack.cloud",
-					}), nil
-				},
-			},
-		}),
-	)
+	// Requests for S3 go to LocalStack through the proxy, which presents
+	// LocalStack's certificate.
+	s3Client, err := BackendConfig{
+		Backend:         BackendProxy,
+		Region:          "eu-west-2",
+		ProxyAddr:       proxy.Listen,
+		ProxyServerName: "localhost.localstack.cloud",
+	}.NewClient(context.TODO())
 	if err != nil {
-		slog.Error("Failed to create AWS session", "error", err)
-		return
+		t.Fatalf("Failed to create S3 client: %v", err)
 	}
-
-	s3Client := s3.NewFromConfig(cfg)
-	bucketName := "gopherconuk-2025-my-new-bucket"
+	bucketName := testrun.BucketName(t, newBucketName)
 	region := "eu-west-2"
 	wantErr := false
 
-	var testLogs strings.Builder
-	w := io.MultiWriter(os.Stdout, &testLogs)
-	h := slog.NewTextHandler(w, nil)
-	slog.SetDefault(slog.New(h))
+	logger, logs := logtest.New()
 
 	defer deleteBucket(s3Client, bucketName, "eu-west-2")
-	if err := createS3Bucket(s3Client, bucketName, region); (err != nil) != wantErr {
+	err = createPastLatency(t, proxy, func(opts ...Option) error {
+		return createS3Bucket(s3Client, bucketName, region,
+			append(opts, WithRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: ExponentialBackoff{Base: 250 * time.Millisecond}}), WithLogger(logger))...)
+	})
+	if (err != nil) != wantErr {
 		t.Errorf("createS3Bucket() error = %v, wantErr %v", err, wantErr)
 	}
 	if _, err := s3Client.HeadBucket(context.TODO(), &s3.HeadBucketInput{
@@ -95,11 +66,62 @@ func Test_createS3BucketSuccessfulRetry(t *testing.T) {
 	}); err != nil {
 		t.Errorf("Failed to get S3 bucket: %v", err)
 	}
-	// Wait for the toxic removal goroutine and check for errors
-	if err := <-removeToxicErr; err != nil {
-		t.Errorf("Failed to remove toxic: %v", err)
+	// Every retry must have waited exactly as the exponential schedule says
+	retries := logs.Find("Retrying S3 request")
+	if len(retries) == 0 {
+		t.Errorf("Expected at least one retry but did not find it in logs:\n%s", logs.Messages())
+	}
+	for i, r := range retries {
+		if got, want := r.Duration("delay"), 250*time.Millisecond<<i; got != want {
+			t.Errorf("retry %d waited %v, want %v", i+1, got, want)
+		}
+	}
+	if failures := logs.Find("Failed to create S3 bucket"); len(failures) == 0 {
+		t.Errorf("Expected s3 bucket failure but did not find it in logs:\n%s", logs.Messages())
+	} else if got := failures[0]; got.String("bucket") != bucketName || got.Int("attempt") != 1 || got.Err("error") == nil {
+		t.Errorf("first failure logged bucket=%q attempt=%d error=%v, want bucket=%q attempt=1 and an error",
+			got.String("bucket"), got.Int("attempt"), got.Err("error"), bucketName)
+	}
+}
+
+func Test_createS3BucketThroughEmbeddedProxy(t *testing.T) {
+	fake := s3fake.NewHandler()
+	ts := httptest.NewTLSServer(fake)
+	defer ts.Close()
+
+	proxy := toxitest.New(t, ts.Listener.Addr().String())
+	// The fake behind the proxy does not check signatures.
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "SECRETEXAMPLE")
+
+	s3Client, err := BackendConfig{
+		Backend:         BackendProxy,
+		Region:          "eu-west-2",
+		ProxyAddr:       proxy.Listen,
+		ProxyServerName: "127.0.0.1",
+		RootCAs:         []*x509.Certificate{ts.Certificate()},
+	}.NewClient(context.Background(), func(o *s3.Options) {
+		// s3fake only serves path-style requests.
+		o.UsePathStyle = true
+	})
+	if err != nil {
+		t.Fatalf("Failed to create S3 client: %v", err)
+	}
+
+	logger, logs := logtest.New()
+
+	bucketName := "gopherconuk-2025-my-new-bucket"
+	err = createPastLatency(t, proxy, func(opts ...Option) error {
+		return createS3Bucket(s3Client, bucketName, "eu-west-2",
+			append(opts, WithRetryPolicy(RetryPolicy{MaxAttempts: 3}), WithLogger(logger))...)
+	})
+	if err != nil {
+		t.Fatalf("createS3Bucket() error = %v", err)
+	}
+	if failures := logs.Find("Failed to create S3 bucket"); len(failures) == 0 || failures[0].Int("attempt") != 1 {
+		t.Errorf("Expected the first attempt to time out but did not find it in logs:\n%s", logs.Messages())
 	}
-	if !strings.Contains(testLogs.String(), "Failed to create S3 bucket") {
-		t.Errorf("Expected s3 bucket failure but did not find it in logs")
+	if !slices.Contains(fake.Buckets(), bucketName) {
+		t.Errorf("bucket %s was not created", bucketName)
 	}
 }
@@ -0,0 +1,257 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// BucketSpec describes a bucket and the configuration it should carry. Zero
+// values leave the matching setting alone, so a spec only needs to mention
+// what it cares about.
+type BucketSpec struct {
+	Name   string
+	Region string
+
+	// Versioning is Enabled or Suspended. Versioning cannot be turned off
+	// again once enabled, only suspended.
+	Versioning types.BucketVersioningStatus
+	// Encryption is the default server-side encryption rule.
+	Encryption *types.ServerSideEncryptionRule
+	// PublicAccessBlock is applied as a whole; unset fields mean false.
+	PublicAccessBlock *types.PublicAccessBlockConfiguration
+	// Tags are set on the bucket. Tags it already has under other keys are
+	// kept, such as the TestRunTag that WithBucketTags put there.
+	Tags map[string]string
+	// ObjectOwnership is the bucket's object ownership setting.
+	ObjectOwnership types.ObjectOwnership
+	// LifecycleRules replace the bucket's lifecycle configuration.
+	LifecycleRules []types.LifecycleRule
+	// Policy is the bucket policy as a JSON document.
+	Policy string
+}
+
+// BucketAPI is the part of the S3 API that EnsureBucket uses. *s3.Client
+// implements it.
+type BucketAPI interface {
+	bucketCreatorAPI
+	DeleteBucket(ctx context.Context, params *s3.DeleteBucketInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketOutput, error)
+	PutBucketOwnershipControls(ctx context.Context, params *s3.PutBucketOwnershipControlsInput, optFns ...func(*s3.Options)) (*s3.PutBucketOwnershipControlsOutput, error)
+	PutPublicAccessBlock(ctx context.Context, params *s3.PutPublicAccessBlockInput, optFns ...func(*s3.Options)) (*s3.PutPublicAccessBlockOutput, error)
+	PutBucketEncryption(ctx context.Context, params *s3.PutBucketEncryptionInput, optFns ...func(*s3.Options)) (*s3.PutBucketEncryptionOutput, error)
+	PutBucketVersioning(ctx context.Context, params *s3.PutBucketVersioningInput, optFns ...func(*s3.Options)) (*s3.PutBucketVersioningOutput, error)
+	GetBucketTagging(ctx context.Context, params *s3.GetBucketTaggingInput, optFns ...func(*s3.Options)) (*s3.GetBucketTaggingOutput, error)
+	PutBucketTagging(ctx context.Context, params *s3.PutBucketTaggingInput, optFns ...func(*s3.Options)) (*s3.PutBucketTaggingOutput, error)
+	PutBucketLifecycleConfiguration(ctx context.Context, params *s3.PutBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketLifecycleConfigurationOutput, error)
+	PutBucketPolicy(ctx context.Context, params *s3.PutBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.PutBucketPolicyOutput, error)
+}
+
+// EnsureBucketError reports the EnsureBucket step that failed. If the bucket
+// was created by the same call it is deleted again, and RolledBack says
+// whether that worked.
+type EnsureBucketError struct {
+	Bucket      string
+	Step        string
+	Err         error
+	RolledBack  bool
+	RollbackErr error
+}
+
+func (e *EnsureBucketError) Error() string {
+	msg := fmt.Sprintf("ensure bucket %s: %s: %v", e.Bucket, e.Step, e.Err)
+	if e.RollbackErr != nil {
+		msg += fmt.Sprintf(" (rollback failed: %v)", e.RollbackErr)
+	}
+	return msg
+}
+
+func (e *EnsureBucketError) Unwrap() error {
+	return e.Err
+}
+
+// rollbackTimeout bounds the cleanup after a failed EnsureBucket. It is
+// detached from the caller's context, which may already be cancelled.
+const rollbackTimeout = 30 * time.Second
+
+// EnsureBucket creates spec.Name if it does not exist and then applies each
+// part of spec with the matching Put* call, retrying each one under the
+// configured RetryPolicy. If a step fails on a bucket that this call
+// created, the bucket is deleted so a later run starts clean. A bucket that
+// already existed is never deleted.
+func EnsureBucket(ctx context.Context, client BucketAPI, spec BucketSpec, opts ...Option) error {
+	o := newOptions(opts)
+	name := spec.Name
+
+	exists, err := bucketExists(ctx, o, o.attemptTimeout, client, name)
+	if err != nil {
+		return &EnsureBucketError{Bucket: name, Step: "HeadBucket", Err: err}
+	}
+	created := false
+	if !exists {
+		if err := createS3BucketWithContext(ctx, client, name, spec.Region, opts...); err != nil {
+			return &EnsureBucketError{Bucket: name, Step: "CreateBucket", Err: err}
+		}
+		created = true
+	}
+
+	for _, step := range specSteps(spec) {
+		err := retry(ctx, o, step.name, name, func(ctx context.Context, _ int) error {
+			return step.apply(ctx, client, name)
+		})
+		if err == nil {
+			o.logger.Info("Applied S3 bucket configuration", "bucket", name, "step", step.name)
+			continue
+		}
+		o.logger.Error("Failed to apply S3 bucket configuration", "bucket", name, "step", step.name, "error", err)
+		ensureErr := &EnsureBucketError{Bucket: name, Step: step.name, Err: err}
+		if created {
+			ensureErr.RollbackErr = rollbackBucket(ctx, client, name, o)
+			ensureErr.RolledBack = ensureErr.RollbackErr == nil
+		}
+		return ensureErr
+	}
+	return nil
+}
+
+func rollbackBucket(ctx context.Context, client BucketAPI, name string, o options) error {
+	ctx, cancel := withTimeout(context.WithoutCancel(ctx), o.clock, rollbackTimeout)
+	defer cancel()
+	err := retry(ctx, o, "DeleteBucket", name, func(ctx context.Context, _ int) error {
+		_, err := client.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: aws.String(name)}, sdkCallOptions(ctx)...)
+		return err
+	})
+	if err != nil {
+		o.logger.Error("Failed to roll back S3 bucket", "bucket", name, "error", err)
+		return err
+	}
+	o.logger.Info("Rolled back S3 bucket", "bucket", name)
+	return nil
+}
+
+// specStep is one Put* call that EnsureBucket makes. field is the
+// BucketSpec field it applies, as reported by Diff.
+type specStep struct {
+	name  string
+	field string
+	apply func(ctx context.Context, client BucketAPI, bucket string) error
+}
+
+// specSteps lists the calls needed for spec. Ownership controls come first
+// because S3 rejects ACL-related settings that conflict with them, and the
+// public access block comes before anything that could expose data,
+// including the policy, which goes last.
+func specSteps(spec BucketSpec) []specStep {
+	var steps []specStep
+	if spec.ObjectOwnership != "" {
+		steps = append(steps, specStep{"PutBucketOwnershipControls", FieldObjectOwnership, func(ctx context.Context, client BucketAPI, bucket string) error {
+			_, err := client.PutBucketOwnershipControls(ctx, &s3.PutBucketOwnershipControlsInput{
+				Bucket: aws.String(bucket),
+				OwnershipControls: &types.OwnershipControls{
+					Rules: []types.OwnershipControlsRule{{ObjectOwnership: spec.ObjectOwnership}},
+				},
+			}, sdkCallOptions(ctx)...)
+			return err
+		}})
+	}
+	if spec.PublicAccessBlock != nil {
+		steps = append(steps, specStep{"PutPublicAccessBlock", FieldPublicAccessBlock, func(ctx context.Context, client BucketAPI, bucket string) error {
+			_, err := client.PutPublicAccessBlock(ctx, &s3.PutPublicAccessBlockInput{
+				Bucket:                         aws.String(bucket),
+				PublicAccessBlockConfiguration: spec.PublicAccessBlock,
+			}, sdkCallOptions(ctx)...)
+			return err
+		}})
+	}
+	if spec.Encryption != nil {
+		steps = append(steps, specStep{"PutBucketEncryption", FieldEncryption, func(ctx context.Context, client BucketAPI, bucket string) error {
+			_, err := client.PutBucketEncryption(ctx, &s3.PutBucketEncryptionInput{
+				Bucket: aws.String(bucket),
+				ServerSideEncryptionConfiguration: &types.ServerSideEncryptionConfiguration{
+					Rules: []types.ServerSideEncryptionRule{*spec.Encryption},
+				},
+			}, sdkCallOptions(ctx)...)
+			return err
+		}})
+	}
+	if spec.Versioning != "" {
+		steps = append(steps, specStep{"PutBucketVersioning", FieldVersioning, func(ctx context.Context, client BucketAPI, bucket string) error {
+			_, err := client.PutBucketVersioning(ctx, &s3.PutBucketVersioningInput{
+				Bucket:                  aws.String(bucket),
+				VersioningConfiguration: &types.VersioningConfiguration{Status: spec.Versioning},
+			}, sdkCallOptions(ctx)...)
+			return err
+		}})
+	}
+	if len(spec.Tags) > 0 {
+		// PutBucketTagging replaces the whole tag set, so the live tags are
+		// read first and spec.Tags merged into them.
+		steps = append(steps, specStep{"PutBucketTagging", FieldTags, func(ctx context.Context, client BucketAPI, bucket string) error {
+			tags, err := bucketTags(ctx, client, bucket)
+			if isNotConfigured(err) {
+				tags, err = map[string]string{}, nil
+			}
+			if err != nil {
+				return err
+			}
+			maps.Copy(tags, spec.Tags)
+			_, err = client.PutBucketTagging(ctx, &s3.PutBucketTaggingInput{
+				Bucket:  aws.String(bucket),
+				Tagging: &types.Tagging{TagSet: tagSet(tags)},
+			}, sdkCallOptions(ctx)...)
+			return err
+		}})
+	}
+	if len(spec.LifecycleRules) > 0 {
+		steps = append(steps, specStep{"PutBucketLifecycleConfiguration", FieldLifecycleRules, func(ctx context.Context, client BucketAPI, bucket string) error {
+			_, err := client.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+				Bucket:                 aws.String(bucket),
+				LifecycleConfiguration: &types.BucketLifecycleConfiguration{Rules: spec.LifecycleRules},
+			}, sdkCallOptions(ctx)...)
+			return err
+		}})
+	}
+	if spec.Policy != "" {
+		steps = append(steps, specStep{"PutBucketPolicy", FieldPolicy, func(ctx context.Context, client BucketAPI, bucket string) error {
+			_, err := client.PutBucketPolicy(ctx, &s3.PutBucketPolicyInput{
+				Bucket: aws.String(bucket),
+				Policy: aws.String(spec.Policy),
+			}, sdkCallOptions(ctx)...)
+			return err
+		}})
+	}
+	return steps
+}
+
+// bucketTagsAPI is the part of the S3 API that bucketTags needs.
+type bucketTagsAPI interface {
+	GetBucketTagging(ctx context.Context, params *s3.GetBucketTaggingInput, optFns ...func(*s3.Options)) (*s3.GetBucketTaggingOutput, error)
+}
+
+// bucketTags returns the bucket's tags. A bucket without any fails with
+// NoSuchTagSet.
+func bucketTags(ctx context.Context, client bucketTagsAPI, bucket string) (map[string]string, error) {
+	out, err := client.GetBucketTagging(ctx, &s3.GetBucketTaggingInput{Bucket: aws.String(bucket)}, sdkCallOptions(ctx)...)
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string, len(out.TagSet))
+	for _, tag := range out.TagSet {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return tags, nil
+}
+
+// tagSet converts tags to the S3 form, sorted by key so requests are stable.
+func tagSet(tags map[string]string) []types.Tag {
+	var set []types.Tag
+	for _, key := range slices.Sorted(maps.Keys(tags)) {
+		set = append(set, types.Tag{Key: aws.String(key), Value: aws.String(tags[key])})
+	}
+	return set
+}
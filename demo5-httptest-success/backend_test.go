@@ -0,0 +1,144 @@
+package s3
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/golangbot/testkit/s3fake"
+)
+
+func TestBackendConfigFromEnv(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "backend.json")
+	if err := os.WriteFile(file, []byte(`{"backend": "localstack", "region": "eu-west-1"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name          string
+		env           map[string]string
+		wantErr       bool
+		wantRegion    string
+		wantEndpoint  string
+		wantPathStyle bool
+		wantStatic    bool
+	}{
+		{
+			name:       "default is aws",
+			wantRegion: "eu-west-2",
+		},
+		{
+			name:          "localstack",
+			env:           map[string]string{BackendEnv: "localstack"},
+			wantRegion:    "eu-west-2",
+			wantEndpoint:  "https://localhost.localstack.cloud:4566",
+			wantPathStyle: true,
+			wantStatic:    true,
+		},
+		{
+			name:          "fake",
+			env:           map[string]string{BackendEnv: "fake", EndpointEnv: "https://127.0.0.1:8443", RegionEnv: "us-east-1"},
+			wantRegion:    "us-east-1",
+			wantEndpoint:  "https://127.0.0.1:8443",
+			wantPathStyle: true,
+			wantStatic:    true,
+		},
+		{
+			name:       "proxy",
+			env:        map[string]string{BackendEnv: "proxy"},
+			wantRegion: "eu-west-2",
+		},
+		{
+			name:          "config file",
+			env:           map[string]string{BackendConfigEnv: file},
+			wantRegion:    "eu-west-1",
+			wantEndpoint:  "https://localhost.localstack.cloud:4566",
+			wantPathStyle: true,
+			wantStatic:    true,
+		},
+		{
+			name:       "environment overrides config file",
+			env:        map[string]string{BackendConfigEnv: file, BackendEnv: "aws"},
+			wantRegion: "eu-west-1",
+		},
+		{
+			name:    "fake without endpoint",
+			env:     map[string]string{BackendEnv: "fake"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown backend",
+			env:     map[string]string{BackendEnv: "minio"},
+			wantErr: true,
+		},
+		{
+			name:    "missing config file",
+			env:     map[string]string{BackendConfigEnv: filepath.Join(t.TempDir(), "missing.json")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, env := range []string{BackendEnv, BackendConfigEnv, RegionEnv, EndpointEnv, ProxyAddrEnv, CABundleEnv} {
+				t.Setenv(env, tt.env[env])
+			}
+			bc, err := BackendConfigFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("BackendConfigFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			cfg, err := bc.Load(context.Background())
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if cfg.Region != tt.wantRegion {
+				t.Errorf("Region = %q, want %q", cfg.Region, tt.wantRegion)
+			}
+			if got := aws.ToString(cfg.BaseEndpoint); got != tt.wantEndpoint {
+				t.Errorf("BaseEndpoint = %q, want %q", got, tt.wantEndpoint)
+			}
+			var opts s3.Options
+			bc.S3Options(&opts)
+			if opts.UsePathStyle != tt.wantPathStyle {
+				t.Errorf("UsePathStyle = %v, want %v", opts.UsePathStyle, tt.wantPathStyle)
+			}
+			if tt.wantStatic {
+				creds, err := cfg.Credentials.Retrieve(context.Background())
+				if err != nil || creds.Source != credentials.StaticCredentialsName {
+					t.Errorf("credentials = %v from %q, want static test credentials", err, creds.Source)
+				}
+			}
+		})
+	}
+}
+
+func TestBackendConfigProxy(t *testing.T) {
+	fake := s3fake.NewHandler()
+	ts := httptest.NewTLSServer(fake)
+	defer ts.Close()
+
+	// The httptest certificate is issued for example.com, not amazonaws.com.
+	bc := BackendConfig{
+		Backend:         BackendProxy,
+		ProxyAddr:       ts.Listener.Addr().String(),
+		ProxyServerName: "example.com",
+		RootCAs:         []*x509.Certificate{ts.Certificate()},
+	}
+	cfg, err := bc.Load(context.Background(),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider("AKIDEXAMPLE", "SECRETEXAMPLE", "")))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	s3Client := s3.NewFromConfig(cfg, bc.S3Options)
+	if _, err := s3Client.ListBuckets(context.Background(), &s3.ListBucketsInput{}); err != nil {
+		t.Errorf("ListBuckets() through the proxy error = %v", err)
+	}
+}
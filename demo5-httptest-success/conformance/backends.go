@@ -0,0 +1,61 @@
+package conformance
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/golangbot/testkit/faultinject"
+)
+
+// Backend is somewhere that speaks S3. Each call to Client gets a client
+// for region; anything started for it is stopped by t.Cleanup.
+type Backend interface {
+	Name() string
+	Client(t testing.TB, region string) *s3.Client
+}
+
+// NewBackend returns a backend called name whose clients come from client,
+// such as one built from the demo's BackendConfig.
+func NewBackend(name string, client func(t testing.TB, region string) *s3.Client) Backend {
+	return funcBackend{name: name, client: client}
+}
+
+type funcBackend struct {
+	name   string
+	client func(t testing.TB, region string) *s3.Client
+}
+
+func (b funcBackend) Name() string { return b.name }
+
+func (b funcBackend) Client(t testing.TB, region string) *s3.Client {
+	t.Helper()
+	return b.client(t, region)
+}
+
+// faultyScheduleLen is how many CreateBucket requests a faulty client
+// scripts, far more than any scenario sends.
+const faultyScheduleLen = 100
+
+// Faulty returns a backend whose clients fail every other CreateBucket with
+// SlowDown before it reaches base, with the SDK's retries off. Every
+// scenario must still pass, which shows that Create's own retries cover
+// transient failures.
+func Faulty(base Backend) Backend {
+	return faultyBackend{base: base}
+}
+
+type faultyBackend struct {
+	base Backend
+}
+
+func (b faultyBackend) Name() string { return "faulty-" + b.base.Name() }
+
+func (b faultyBackend) Client(t testing.TB, region string) *s3.Client {
+	schedule := make([]faultinject.Fault, faultyScheduleLen)
+	for i := 0; i < len(schedule); i += 2 {
+		schedule[i] = faultinject.S3Error(http.StatusServiceUnavailable, "SlowDown")
+	}
+	client, _ := withFaults(b.base.Client(t, region), schedule...)
+	return client
+}
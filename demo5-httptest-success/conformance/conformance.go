@@ -0,0 +1,245 @@
+// Package conformance is one set of bucket tests that runs unchanged against
+// every backend the demos use: the in-memory fake, a LocalStack-compatible
+// endpoint, the fault-injected transport and real AWS. The code under test
+// is passed in as a Subject, so the package does not depend on it:
+//
+//	backend := conformance.NewBackend("localstack", newClient)
+//	for _, backend := range []conformance.Backend{backend, conformance.Faulty(backend)} {
+//		t.Run(backend.Name(), func(t *testing.T) {
+//			conformance.Run(t, backend, conformance.Subject{Create: ..., Delete: ..., NewName: ...})
+//		})
+//	}
+//
+// The caller builds the clients, so the demos pick the backend from
+// S3_BACKEND as their other tests do, and the same test moves from the fake
+// to LocalStack or AWS without code changes.
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/golangbot/testkit/faultinject"
+	"github.com/golangbot/testkit/testrun"
+)
+
+// Region is the region every scenario creates its buckets in.
+const Region = "eu-west-2"
+
+// scenarioTimeout bounds each scenario, so a hung backend fails the test
+// instead of stalling it.
+const scenarioTimeout = 2 * time.Minute
+
+// Subject is the code under test.
+type Subject struct {
+	// Create creates name in region and returns once it exists. It must
+	// treat a bucket the caller already owns as success, and retry a
+	// transient failure at least twice before giving up.
+	Create func(ctx context.Context, client *s3.Client, name, region string) error
+	// Delete deletes the empty bucket name.
+	Delete func(ctx context.Context, client *s3.Client, name, region string) error
+	// NewName makes the name of each bucket a scenario uses, from
+	// testrun.BucketPrefix and the run ID, as testrun.BucketName does for
+	// the demos' other tests. Create should tag what it makes with the run,
+	// so buckets a scenario leaks can be reaped with theirs.
+	NewName func(prefix, runID string) (string, error)
+}
+
+// Run runs every scenario against backend as a subtest of t.
+func Run(t *testing.T, backend Backend, subject Subject) {
+	scenarios := []struct {
+		name string
+		run  func(ctx context.Context, t *testing.T, client *s3.Client, subject Subject)
+	}{
+		{"Create", testCreate},
+		{"Head", testHead},
+		{"Delete", testDelete},
+		{"Idempotent", testIdempotent},
+		{"NotFound", testNotFound},
+		{"Retry", testRetry},
+		{"RetryExhausted", testRetryExhausted},
+	}
+	if subject.NewName == nil {
+		t.Fatal("conformance.Subject needs NewName")
+	}
+	for _, sc := range scenarios {
+		t.Run(sc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), scenarioTimeout)
+			defer cancel()
+			sc.run(ctx, t, backend.Client(t, Region), subject)
+		})
+	}
+}
+
+func testCreate(ctx context.Context, t *testing.T, client *s3.Client, subject Subject) {
+	name := newBucketName(t, client, subject)
+	if err := subject.Create(ctx, client, name, Region); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if _, err := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(name)}); err != nil {
+		t.Errorf("HeadBucket() after Create() error = %v", err)
+	}
+}
+
+func testHead(ctx context.Context, t *testing.T, client *s3.Client, subject Subject) {
+	name := newBucketName(t, client, subject)
+	if err := subject.Create(ctx, client, name, Region); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	head, err := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(name)})
+	if err != nil {
+		t.Fatalf("HeadBucket() error = %v", err)
+	}
+	if got := aws.ToString(head.BucketRegion); got != Region {
+		t.Errorf("HeadBucket() region = %q, want %q", got, Region)
+	}
+}
+
+func testDelete(ctx context.Context, t *testing.T, client *s3.Client, subject Subject) {
+	name := newBucketName(t, client, subject)
+	if err := subject.Create(ctx, client, name, Region); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := subject.Delete(ctx, client, name, Region); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := headMissing(ctx, client, name); err != nil {
+		t.Errorf("after Delete(): %v", err)
+	}
+}
+
+func testIdempotent(ctx context.Context, t *testing.T, client *s3.Client, subject Subject) {
+	name := newBucketName(t, client, subject)
+	if err := subject.Create(ctx, client, name, Region); err != nil {
+		t.Fatalf("first Create() error = %v", err)
+	}
+	if err := subject.Create(ctx, client, name, Region); err != nil {
+		t.Errorf("second Create() of an owned bucket error = %v, want nil", err)
+	}
+}
+
+func testNotFound(ctx context.Context, t *testing.T, client *s3.Client, subject Subject) {
+	name := newBucketName(t, client, subject)
+	if err := headMissing(ctx, client, name); err != nil {
+		t.Errorf("before Create(): %v", err)
+	}
+	err := subject.Delete(ctx, client, name, Region)
+	if code := errorCode(err); code != "NoSuchBucket" {
+		t.Errorf("Delete() of a missing bucket error = %v, want NoSuchBucket", err)
+	}
+}
+
+// testRetry fails the first CreateBucket before it leaves the client, so
+// Create has to retry. The backend never sees the failed attempt, which
+// makes the scenario safe against real AWS.
+func testRetry(ctx context.Context, t *testing.T, client *s3.Client, subject Subject) {
+	name := newBucketName(t, client, subject)
+	faulty, transport := withFaults(client, faultinject.S3Error(http.StatusServiceUnavailable, "SlowDown"))
+	if err := subject.Create(ctx, faulty, name, Region); err != nil {
+		t.Fatalf("Create() through one injected SlowDown error = %v", err)
+	}
+	if got := transport.Calls(); got < 2 {
+		t.Errorf("CreateBucket sent %d time(s), want a retry after the injected fault", got)
+	}
+	if _, err := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(name)}); err != nil {
+		t.Errorf("HeadBucket() after Create() error = %v", err)
+	}
+}
+
+// testRetryExhausted fails every CreateBucket, so Create has to give up
+// without the bucket ever being made.
+func testRetryExhausted(ctx context.Context, t *testing.T, client *s3.Client, subject Subject) {
+	name := newBucketName(t, client, subject)
+	var schedule []faultinject.Fault
+	for range 20 {
+		schedule = append(schedule, faultinject.S3Error(http.StatusInternalServerError, "InternalError"))
+	}
+	faulty, transport := withFaults(client, schedule...)
+	if err := subject.Create(ctx, faulty, name, Region); err == nil {
+		t.Fatalf("Create() succeeded with every CreateBucket failing, want an error")
+	}
+	if got := transport.Calls(); got < 2 {
+		t.Errorf("CreateBucket sent %d time(s), want retries before giving up", got)
+	}
+	if err := headMissing(ctx, client, name); err != nil {
+		t.Errorf("after giving up: %v", err)
+	}
+}
+
+// withFaults returns a copy of client whose CreateBucket requests go through
+// schedule before reaching the backend. The SDK's own retries are turned
+// off, so every attempt the transport counts is one Create made.
+func withFaults(client *s3.Client, schedule ...faultinject.Fault) (*s3.Client, *faultinject.Transport) {
+	transport := faultinject.New(httpClientTransport{client.Options().HTTPClient}, schedule...)
+	transport.Match = isCreateBucket
+	faulty := s3.New(client.Options(), func(o *s3.Options) {
+		o.Retryer = aws.NopRetryer{}
+		o.HTTPClient = &http.Client{
+			Transport: transport,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	})
+	return faulty, transport
+}
+
+// isCreateBucket matches a PUT with no subresource, which is CreateBucket as
+// long as no objects are uploaded, and the suite uploads none.
+func isCreateBucket(r *http.Request) bool {
+	query := r.URL.Query()
+	query.Del("x-id")
+	return r.Method == http.MethodPut && len(query) == 0
+}
+
+// httpClientTransport lets an SDK HTTP client, which only has Do, sit
+// underneath a faultinject.Transport.
+type httpClientTransport struct {
+	client s3.HTTPClient
+}
+
+func (t httpClientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.client.Do(req)
+}
+
+// newBucketName returns a fresh bucket name from subject.NewName and
+// registers a cleanup that deletes the bucket if a scenario left it behind.
+func newBucketName(t *testing.T, client *s3.Client, subject Subject) string {
+	t.Helper()
+	name := testrun.BucketName(t, subject.NewName)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		_, err := client.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: aws.String(name)})
+		if err != nil && errorCode(err) != "NoSuchBucket" {
+			t.Errorf("Failed to clean up bucket %s: %v", name, err)
+		}
+	})
+	return name
+}
+
+// headMissing checks that HeadBucket reports name as not found.
+func headMissing(ctx context.Context, client *s3.Client, name string) error {
+	_, err := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(name)})
+	var notFound *types.NotFound
+	if !errors.As(err, &notFound) {
+		return fmt.Errorf("HeadBucket() of %s error = %v, want NotFound", name, err)
+	}
+	return nil
+}
+
+func errorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return ""
+}
@@ -0,0 +1,71 @@
+package s3
+
+import (
+	"context"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/golangbot/s3/conformance"
+	"github.com/golangbot/testkit/s3fake"
+	"github.com/golangbot/testkit/testrun"
+)
+
+// conformanceBackend returns the backend described by BackendConfigFromEnv,
+// as for every other test, except that it is the fake when S3_BACKEND is not
+// set. A fake without an endpoint gets a fresh s3fake server for every
+// client, so scenarios cannot see each other's buckets.
+func conformanceBackend(t *testing.T) conformance.Backend {
+	t.Helper()
+	cfg, err := BackendConfigFromEnv()
+	if cfg.Backend == "" || cfg.Backend == BackendFake && cfg.Endpoint == "" {
+		return conformance.NewBackend(string(BackendFake), func(t testing.TB, region string) *s3.Client {
+			ts := httptest.NewTLSServer(s3fake.NewHandler())
+			t.Cleanup(ts.Close)
+			return newFakeClient(t, ts, region)
+		})
+	}
+	if err != nil {
+		t.Fatalf("Failed to read backend config: %v", err)
+	}
+	return conformance.NewBackend(string(cfg.Backend), func(t testing.TB, region string) *s3.Client {
+		t.Helper()
+		c := cfg
+		c.Region = region
+		s3Client, err := c.NewClient(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to create S3 client: %v", err)
+		}
+		return s3Client
+	})
+}
+
+// TestConformance runs the conformance suite against the backend picked by
+// S3_BACKEND, the fake by default, both as it is and with injected faults:
+//
+//	S3_BACKEND=localstack go test -run TestConformance
+func TestConformance(t *testing.T) {
+	opts := []Option{
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: ExponentialBackoff{Base: 10 * time.Millisecond}}),
+		WithWaiterDelay(100*time.Millisecond, time.Second),
+		WithLogger(slog.New(slog.DiscardHandler)),
+		WithBucketTags(map[string]string{TestRunTag: testrun.ID()}),
+	}
+	subject := conformance.Subject{
+		Create: func(ctx context.Context, client *s3.Client, name, region string) error {
+			return createS3BucketWithContext(ctx, client, name, region, opts...)
+		},
+		Delete: func(ctx context.Context, client *s3.Client, name, region string) error {
+			return deleteBucketWithContext(ctx, client, name, region, opts...)
+		},
+		NewName: newBucketName,
+	}
+	backend := conformanceBackend(t)
+	for _, backend := range []conformance.Backend{backend, conformance.Faulty(backend)} {
+		t.Run(backend.Name(), func(t *testing.T) {
+			conformance.Run(t, backend, subject)
+		})
+	}
+}
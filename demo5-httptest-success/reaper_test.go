@@ -0,0 +1,105 @@
+package s3
+
+import (
+	"context"
+	"log/slog"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/golangbot/testkit/s3fake"
+)
+
+func TestReapBuckets(t *testing.T) {
+	fake := s3fake.NewHandler()
+	ts := httptest.NewTLSServer(fake)
+	defer ts.Close()
+	s3Client := newFakeClient(t, ts, "eu-west-2")
+	ctx := context.Background()
+	quiet := WithLogger(slog.New(slog.DiscardHandler))
+
+	start := time.Now()
+	create := func(name string, age time.Duration, tags map[string]string) {
+		t.Helper()
+		fake.SetNow(func() time.Time { return start.Add(-age) })
+		opts := []Option{quiet}
+		if tags != nil {
+			opts = append(opts, WithBucketTags(tags))
+		}
+		if err := createS3Bucket(s3Client, name, "eu-west-2", opts...); err != nil {
+			t.Fatalf("createS3Bucket(%s) error = %v", name, err)
+		}
+	}
+	run := map[string]string{TestRunTag: "run-1234"}
+	create("gopherconuk-2025-leaked", 3*time.Hour, run)
+	create("gopherconuk-2025-untagged", 3*time.Hour, nil)
+	create("gopherconuk-2025-running", time.Minute, run)
+	create("production-data", 3*time.Hour, run)
+	if _, err := s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String("gopherconuk-2025-leaked"),
+		Key:    aws.String("a.txt"),
+		Body:   strings.NewReader("a"),
+	}); err != nil {
+		t.Fatalf("PutObject() error = %v", err)
+	}
+
+	policy := ReapPolicy{
+		Prefix: "gopherconuk-2025-",
+		Tags:   map[string]string{TestRunTag: ""},
+		TTL:    time.Hour,
+		DryRun: true,
+	}
+	report, err := ReapBuckets(ctx, s3Client, policy, quiet)
+	if err != nil {
+		t.Fatalf("ReapBuckets(dry run) error = %v", err)
+	}
+	if len(report.Expired) != 1 || report.Expired[0].Name != "gopherconuk-2025-leaked" {
+		t.Fatalf("ReapBuckets(dry run) expired = %v, want only gopherconuk-2025-leaked", report.Expired)
+	}
+	if got := report.Expired[0].Age; got < 3*time.Hour {
+		t.Errorf("ReapBuckets(dry run) age = %v, want at least 3h", got)
+	}
+	if got := report.Deleted(); len(got) != 0 {
+		t.Errorf("ReapBuckets(dry run) deleted %v, want none", got)
+	}
+	if got := len(fake.Buckets()); got != 4 {
+		t.Errorf("buckets after dry run = %d, want 4", got)
+	}
+	if !strings.Contains(report.String(), "gopherconuk-2025-leaked\teu-west-2\tage 3h0m") ||
+		!strings.Contains(report.String(), "would delete") {
+		t.Errorf("ReapReport.String() =\n%s\nwant a would-delete line for gopherconuk-2025-leaked", report)
+	}
+
+	policy.DryRun = false
+	report, err = ReapBuckets(ctx, s3Client, policy, quiet)
+	if err != nil {
+		t.Fatalf("ReapBuckets() error = %v", err)
+	}
+	if err := report.Err(); err != nil {
+		t.Errorf("ReapReport.Err() = %v", err)
+	}
+	if got := report.Deleted(); !slices.Equal(got, []string{"gopherconuk-2025-leaked"}) {
+		t.Errorf("ReapBuckets() deleted %v, want [gopherconuk-2025-leaked]", got)
+	}
+	want := []string{"gopherconuk-2025-running", "gopherconuk-2025-untagged", "production-data"}
+	if got := fake.Buckets(); !slices.Equal(got, want) {
+		t.Errorf("buckets after reaping = %v, want %v", got, want)
+	}
+
+	if _, err := ReapBuckets(ctx, s3Client, ReapPolicy{TTL: time.Hour}, quiet); err == nil {
+		t.Errorf("ReapBuckets() with no prefix or tags succeeded, want an error")
+	}
+	for _, ttl := range []time.Duration{0, -time.Hour} {
+		policy := ReapPolicy{Prefix: "gopherconuk-2025-", Tags: map[string]string{TestRunTag: ""}, TTL: ttl}
+		if _, err := ReapBuckets(ctx, s3Client, policy, quiet); err == nil {
+			t.Errorf("ReapBuckets() with TTL %v succeeded, want an error", ttl)
+		}
+		if !slices.Contains(fake.Buckets(), "gopherconuk-2025-running") {
+			t.Errorf("ReapBuckets() with TTL %v deleted a bucket in use", ttl)
+		}
+	}
+}
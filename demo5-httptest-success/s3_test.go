@@ -2,36 +2,29 @@ package s3
 
 import (
 	"context"
+	"crypto/x509"
+	"errors"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/golangbot/testkit/clocktest"
+	"github.com/golangbot/testkit/s3fake"
 )
 
 func Test_createS3BucketSuccessfulRetry(t *testing.T) {
-	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-	}))
+	ts := httptest.NewTLSServer(s3fake.NewHandler())
 	defer ts.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	cfg, err := config.LoadDefaultConfig(ctx,
-		config.WithRegion("eu-west-2"),
-		config.WithBaseEndpoint(ts.URL),
-		config.WithHTTPClient(ts.Client()),
-	)
-	if err != nil {
-		slog.Error("Failed to create AWS session", "error", err)
-		return
-	}
-
-	s3Client := s3.NewFromConfig(cfg)
+	s3Client := newFakeClient(t, ts, "eu-west-2")
 
 	bucketName := "gopherconuk-2025-my-new-bucket"
 	region := "eu-west-2"
@@ -48,3 +41,184 @@ func Test_createS3BucketSuccessfulRetry(t *testing.T) {
 	}
 
 }
+
+func Test_createS3BucketIdempotentAfterTimeout(t *testing.T) {
+	fake := s3fake.NewHandler()
+	var createRequests atomic.Int32
+	held := make(chan struct{})
+	done := make(chan struct{})
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		isCreate := r.Method == http.MethodPut && !strings.Contains(strings.Trim(r.URL.Path, "/"), "/")
+		if isCreate && createRequests.Add(1) == 1 {
+			// The bucket is created but the client times out before it sees the response
+			fake.ServeHTTP(httptest.NewRecorder(), r)
+			close(held)
+			select {
+			case <-r.Context().Done():
+			case <-done:
+			}
+			return
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	s3Client := newFakeClient(t, ts, "eu-west-2")
+
+	// The create timeout runs on a fake clock, moved past it once the first
+	// CreateBucket is held, so the test does not wait for it in real time.
+	clock := clocktest.New(time.Now())
+	bucketName := "gopherconuk-2025-my-new-bucket"
+	errc := make(chan error, 1)
+	go func() {
+		errc <- createS3Bucket(s3Client, bucketName, "eu-west-2",
+			WithClock(clock), WithRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: ConstantBackoff{}}))
+	}()
+	select {
+	case <-held:
+	case err := <-errc:
+		t.Fatalf("createS3Bucket() returned %v before CreateBucket was held", err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("CreateBucket never reached the server")
+	}
+	clock.Advance(defaultCreateTimeout)
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatalf("createS3Bucket() error = %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("createS3Bucket() did not return after the first attempt timed out")
+	}
+
+	if n := createRequests.Load(); n != 1 {
+		t.Errorf("CreateBucket sent %d times, want 1", n)
+	}
+	if got := fake.Buckets(); !slices.Equal(got, []string{bucketName}) {
+		t.Errorf("buckets = %v, want exactly %s", got, bucketName)
+	}
+}
+
+func Test_deleteBucketForceDelete(t *testing.T) {
+	fake := s3fake.NewHandler()
+	ts := httptest.NewTLSServer(fake)
+	defer ts.Close()
+	s3Client := newFakeClient(t, ts, "eu-west-2")
+
+	bucketName := "gopherconuk-2025-my-new-bucket"
+	if err := createS3Bucket(s3Client, bucketName, "eu-west-2"); err != nil {
+		t.Fatalf("createS3Bucket() error = %v", err)
+	}
+	for _, key := range []string{"a.txt", "b.txt"} {
+		if _, err := s3Client.PutObject(context.Background(), &s3.PutObjectInput{
+			Bucket: aws.String(bucketName),
+			Key:    aws.String(key),
+			Body:   strings.NewReader(key),
+		}); err != nil {
+			t.Fatalf("PutObject() error = %v", err)
+		}
+	}
+
+	if err := deleteBucket(s3Client, bucketName, "eu-west-2"); err == nil {
+		t.Fatalf("deleteBucket() of non-empty bucket succeeded, want BucketNotEmpty")
+	}
+	if err := deleteBucket(s3Client, bucketName, "eu-west-2", WithForceDelete()); err != nil {
+		t.Fatalf("deleteBucket(WithForceDelete()) error = %v", err)
+	}
+	if got := fake.Buckets(); len(got) != 0 {
+		t.Errorf("buckets = %v, want none", got)
+	}
+}
+
+// newFakeClient returns a client in region for the fake S3 server behind ts.
+func newFakeClient(t testing.TB, ts *httptest.Server, region string) *s3.Client {
+	t.Helper()
+	s3Client, err := BackendConfig{
+		Backend:  BackendFake,
+		Region:   region,
+		Endpoint: ts.URL,
+		RootCAs:  []*x509.Certificate{ts.Certificate()},
+	}.NewClient(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to create S3 client: %v", err)
+	}
+	return s3Client
+}
+
+func Test_createS3BucketLocationConstraint(t *testing.T) {
+	tests := []struct {
+		name         string
+		clientRegion string
+		region       string
+		wantBody     string
+		wantErr      error
+	}{
+		{
+			name:         "us-east-1 has no constraint",
+			clientRegion: "us-east-1",
+			region:       "us-east-1",
+			wantBody:     "",
+		},
+		{
+			name:         "eu-west-2",
+			clientRegion: "eu-west-2",
+			region:       "eu-west-2",
+			wantBody:     `<CreateBucketConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><LocationConstraint>eu-west-2</LocationConstraint></CreateBucketConfiguration>`,
+		},
+		{
+			name:         "legacy EU alias",
+			clientRegion: "eu-west-1",
+			region:       "EU",
+			wantBody:     `<CreateBucketConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><LocationConstraint>EU</LocationConstraint></CreateBucketConfiguration>`,
+		},
+		{
+			name:         "unknown region",
+			clientRegion: "eu-west-2",
+			region:       "eu-west-9",
+			wantErr:      ErrInvalidRegion,
+		},
+		{
+			name:         "empty region",
+			clientRegion: "eu-west-2",
+			region:       "",
+			wantErr:      ErrInvalidRegion,
+		},
+		{
+			name:         "client in another region",
+			clientRegion: "us-east-1",
+			region:       "eu-west-2",
+			wantErr:      ErrRegionMismatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var creates []string
+			ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPut {
+					body, _ := io.ReadAll(r.Body)
+					creates = append(creates, string(body))
+				}
+			}))
+			defer ts.Close()
+			s3Client := newFakeClient(t, ts, tt.clientRegion)
+
+			err := createS3Bucket(s3Client, "gopherconuk-2025-my-new-bucket", tt.region, WithLogger(slog.New(slog.DiscardHandler)))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("createS3Bucket() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if len(creates) != 0 {
+					t.Errorf("sent %d CreateBucket requests, want none", len(creates))
+				}
+				return
+			}
+			if len(creates) != 1 {
+				t.Fatalf("sent %d CreateBucket requests, want 1", len(creates))
+			}
+			if got := strings.TrimSpace(creates[0]); got != tt.wantBody {
+				t.Errorf("CreateBucket body = %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// TestRunTag is the tag key tests put on the buckets they create, with the
+// test run's ID as the value, so ReapBuckets can tell leaked test buckets
+// from everything else in the account.
+const TestRunTag = "created-by"
+
+// WithBucketTags makes createS3Bucket tag the bucket once it exists. The
+// client must also implement PutBucketTagging, as *s3.Client does.
+func WithBucketTags(tags map[string]string) Option {
+	return func(o *options) {
+		o.bucketTags = tags
+	}
+}
+
+// bucketTaggerAPI is the part of the S3 API that WithBucketTags needs.
+type bucketTaggerAPI interface {
+	PutBucketTagging(ctx context.Context, params *s3.PutBucketTaggingInput, optFns ...func(*s3.Options)) (*s3.PutBucketTaggingOutput, error)
+}
+
+// tagBucket applies o.bucketTags to a bucket createS3Bucket has just made.
+func tagBucket(ctx context.Context, client any, name string, o options) error {
+	tagger, ok := client.(bucketTaggerAPI)
+	if !ok {
+		return fmt.Errorf("tag bucket %s: client cannot tag buckets", name)
+	}
+	return retry(ctx, o, "PutBucketTagging", name, func(ctx context.Context, _ int) error {
+		_, err := tagger.PutBucketTagging(ctx, &s3.PutBucketTaggingInput{
+			Bucket:  aws.String(name),
+			Tagging: &types.Tagging{TagSet: tagSet(o.bucketTags)},
+		}, sdkCallOptions(ctx)...)
+		return err
+	})
+}
+
+// ReaperAPI is the part of the S3 API that ReapBuckets uses. *s3.Client
+// implements it.
+type ReaperAPI interface {
+	s3.ListBucketsAPIClient
+	bucketDeleterAPI
+	bucketEmptierAPI
+	GetBucketTagging(ctx context.Context, params *s3.GetBucketTaggingInput, optFns ...func(*s3.Options)) (*s3.GetBucketTaggingOutput, error)
+}
+
+// ReapPolicy says which buckets ReapBuckets deletes. A bucket is reaped only
+// if it matches Prefix, carries every one of Tags and was created more than
+// TTL ago. At least one of Prefix and Tags must be set, and TTL must be
+// positive so the buckets of runs still in progress are left alone.
+type ReapPolicy struct {
+	Prefix string
+	// Tags must all be present on the bucket. An empty value matches any
+	// value, so {TestRunTag: ""} matches buckets from every test run.
+	Tags map[string]string
+	TTL  time.Duration
+	// DryRun reports what would be deleted without deleting anything.
+	DryRun bool
+}
+
+// ReapedBucket is one bucket ReapBuckets found old enough to delete.
+type ReapedBucket struct {
+	Name    string
+	Region  string
+	Created time.Time
+	Age     time.Duration
+	// Deleted is false in a dry run or if Err is set.
+	Deleted bool
+	Err     error
+}
+
+// ReapReport says what ReapBuckets found and did.
+type ReapReport struct {
+	DryRun bool
+	// Scanned is the number of buckets listed.
+	Scanned int
+	// Expired are the matching buckets older than the TTL, including any
+	// whose tags could not be read.
+	Expired []ReapedBucket
+}
+
+// Deleted returns the names of the buckets that were deleted.
+func (r *ReapReport) Deleted() []string {
+	var names []string
+	for _, b := range r.Expired {
+		if b.Deleted {
+			names = append(names, b.Name)
+		}
+	}
+	return names
+}
+
+// Err joins the errors for buckets that could not be deleted, or returns
+// nil if there were none.
+func (r *ReapReport) Err() error {
+	var errs []error
+	for _, b := range r.Expired {
+		if b.Err != nil {
+			errs = append(errs, fmt.Errorf("bucket %s: %w", b.Name, b.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// String formats the report for a person, one line per expired bucket.
+func (r *ReapReport) String() string {
+	var sb strings.Builder
+	verb := "deleted"
+	if r.DryRun {
+		verb = "would delete"
+	}
+	fmt.Fprintf(&sb, "scanned %d bucket(s), %d expired", r.Scanned, len(r.Expired))
+	for _, b := range r.Expired {
+		status := verb
+		if b.Err != nil {
+			status = "failed: " + b.Err.Error()
+		}
+		fmt.Fprintf(&sb, "\n%s\t%s\tage %s\t%s", b.Name, b.Region, b.Age.Round(time.Second), status)
+	}
+	return sb.String()
+}
+
+// ReapBuckets force-deletes the buckets that policy matches, typically test
+// buckets left behind by runs that crashed or timed out before their
+// cleanup. It works the same against S3, LocalStack and s3fake. A bucket
+// that cannot be deleted is recorded in the report and the rest are still
+// tried; the error is only for failing to list buckets or an unusable
+// policy.
+func ReapBuckets(ctx context.Context, client ReaperAPI, policy ReapPolicy, opts ...Option) (*ReapReport, error) {
+	if policy.Prefix == "" && len(policy.Tags) == 0 {
+		return nil, errors.New("reap buckets: policy needs a prefix or tags to match")
+	}
+	if policy.TTL <= 0 {
+		return nil, fmt.Errorf("reap buckets: policy TTL is %v, want a positive age so buckets still in use are kept", policy.TTL)
+	}
+	o := newOptions(opts)
+	o.forceDelete = true
+	report := &ReapReport{DryRun: policy.DryRun}
+	now := o.clock.Now()
+
+	input := &s3.ListBucketsInput{}
+	if policy.Prefix != "" {
+		input.Prefix = aws.String(policy.Prefix)
+	}
+	paginator := s3.NewListBucketsPaginator(client, input)
+	for paginator.HasMorePages() {
+		var page *s3.ListBucketsOutput
+		err := retry(ctx, o, "ListBuckets", "", func(ctx context.Context, _ int) error {
+			var err error
+			page, err = paginator.NextPage(ctx, sdkCallOptions(ctx)...)
+			return err
+		})
+		if err != nil {
+			return report, err
+		}
+		for _, b := range page.Buckets {
+			report.Scanned++
+			name := aws.ToString(b.Name)
+			// Not every backend filters by prefix, so check again.
+			if !strings.HasPrefix(name, policy.Prefix) {
+				continue
+			}
+			created := aws.ToTime(b.CreationDate)
+			age := now.Sub(created)
+			if age <= policy.TTL {
+				continue
+			}
+			region := aws.ToString(b.BucketRegion)
+			reaped := ReapedBucket{Name: name, Region: region, Created: created, Age: age}
+			if len(policy.Tags) > 0 {
+				ok, err := bucketHasTags(ctx, client, name, region, policy.Tags, o)
+				if err != nil {
+					reaped.Err = err
+					report.Expired = append(report.Expired, reaped)
+					continue
+				}
+				if !ok {
+					continue
+				}
+			}
+			if !policy.DryRun {
+				reaped.Err = deleteBucketWithOptions(ctx, regionClient{client, region}, name, o)
+				reaped.Deleted = reaped.Err == nil
+			}
+			report.Expired = append(report.Expired, reaped)
+		}
+	}
+	o.logger.Info("Reaped S3 buckets", "scanned", report.Scanned, "expired", len(report.Expired),
+		"deleted", len(report.Deleted()), "dry_run", policy.DryRun)
+	return report, nil
+}
+
+// bucketHasTags reports whether bucket carries every tag in want. A bucket
+// with no tags at all has none of them.
+func bucketHasTags(ctx context.Context, client ReaperAPI, bucket, region string, want map[string]string, o options) (bool, error) {
+	var out *s3.GetBucketTaggingOutput
+	err := retry(ctx, o, "GetBucketTagging", bucket, func(ctx context.Context, _ int) error {
+		var err error
+		out, err = client.GetBucketTagging(ctx, &s3.GetBucketTaggingInput{Bucket: aws.String(bucket)}, append(sdkCallOptions(ctx), inRegion(region))...)
+		return err
+	})
+	if isNotConfigured(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	got := make(map[string]string, len(out.TagSet))
+	for _, tag := range out.TagSet {
+		got[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	for key, value := range want {
+		v, ok := got[key]
+		if !ok || value != "" && v != value {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// inRegion sends a request to region rather than the client's own, since
+// S3 redirects requests for a bucket made to the wrong regional endpoint.
+// An empty region, from a backend that does not report one, changes
+// nothing.
+func inRegion(region string) func(*s3.Options) {
+	return func(o *s3.Options) {
+		if region != "" {
+			o.Region = region
+		}
+	}
+}
+
+// regionClient sends every call for one bucket to that bucket's region.
+type regionClient struct {
+	ReaperAPI
+	region string
+}
+
+func (c regionClient) DeleteBucket(ctx context.Context, params *s3.DeleteBucketInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketOutput, error) {
+	return c.ReaperAPI.DeleteBucket(ctx, params, append(optFns, inRegion(c.region))...)
+}
+
+func (c regionClient) ListObjectVersions(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+	return c.ReaperAPI.ListObjectVersions(ctx, params, append(optFns, inRegion(c.region))...)
+}
+
+func (c regionClient) ListMultipartUploads(ctx context.Context, params *s3.ListMultipartUploadsInput, optFns ...func(*s3.Options)) (*s3.ListMultipartUploadsOutput, error) {
+	return c.ReaperAPI.ListMultipartUploads(ctx, params, append(optFns, inRegion(c.region))...)
+}
+
+func (c regionClient) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	return c.ReaperAPI.DeleteObjects(ctx, params, append(optFns, inRegion(c.region))...)
+}
+
+func (c regionClient) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	return c.ReaperAPI.AbortMultipartUpload(ctx, params, append(optFns, inRegion(c.region))...)
+}
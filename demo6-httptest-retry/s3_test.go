@@ -2,25 +2,40 @@ package s3
 
 import (
 	"context"
-	"crypto/tls"
 	"crypto/x509"
-	"io"
-	"log/slog"
-	"net"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
-	"os"
-	"strings"
 	"testing"
 	"time"
 
-	toxiproxy "github.com/Shopify/toxiproxy/client"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
+	awsretry "github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/golangbot/testkit/clocktest"
+	"github.com/golangbot/testkit/faultinject"
+	"github.com/golangbot/testkit/logtest"
+	"github.com/golangbot/testkit/s3fake"
+	"github.com/golangbot/testkit/toxitest"
 )
 
+// createPastLatency runs create with proxy.DrivePastLatency, on its clock
+// and reporting attempts and retries to it.
+func createPastLatency(t *testing.T, proxy *toxitest.Proxy, create func(opts ...Option) error) error {
+	t.Helper()
+	return proxy.DrivePastLatency(defaultCreateTimeout, func(clock *clocktest.Fake, hooks toxitest.RetryHooks) error {
+		return create(WithClock(clock), WithRetryObserver(RetryObserverFuncs{
+			Attempt: func(e RetryEvent) {
+				if e.Err != nil {
+					hooks.Failed(e.Attempt)
+				}
+			},
+			Retry: func(e RetryEvent) { hooks.Retrying(e.Delay) },
+		}))
+	})
+}
+
 func Test_createS3BucketSuccessfulRetry(t *testing.T) {
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -32,82 +47,33 @@ func Test_createS3BucketSuccessfulRetry(t *testing.T) {
 		t.Fatalf("Error parsing URL: %v\n", err)
 		return
 	}
-
-	host := u.Hostname()
-	port := u.Port()
-
-	toxiClient := toxiproxy.NewClient("localhost:8474")
-	_, err = toxiClient.Populate([]toxiproxy.Proxy{{
-		Name:   "s3_proxy",
-		Listen: "localhost:8443",
-
-		Upstream: host + ":" + port,
-		Enabled:  true,
-	}})
-	if err != nil {
-		t.Fatalf("Failed to create toxy proxy: %s", err)
-	}
-
-	proxy, err := toxiClient.Proxy("s3_proxy")
-	if err != nil {
-		t.Fatalf("Failed to get s3_proxy: %s", err)
-	}
-
-	_, err = proxy.AddToxic("latency", "latency", "upstream", 1.0, toxiproxy.Attributes{
-		"latency": 30000,
-	})
-	if err != nil {
-		t.Fatalf("Failed to add toxic: %s", err)
-	}
-
-	time.Sleep(3 * time.Second)
-	removeToxicErr := make(chan error)
-
-	go func() {
-		<-time.After(7 * time.Second)
-		err := proxy.RemoveToxic("latency")
-		removeToxicErr <- err
-
-	}()
-
-	testRootCA := x509.NewCertPool()
-	testRootCA.AddCert(ts.Certificate())
-
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion("eu-west-2"),
-		config.WithHTTPClient(&http.Client{
-			Transport: &http.Transport{
-				DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-					var d net.Dialer
-					conn, err := d.DialContext(ctx, network, "localhost:8443")
-					if err != nil {
-						return nil, err
-					}
-					return tls.Client(conn, &tls.Config{
-						ServerName: host,
-						RootCAs:    testRootCA,
-					}), nil
-				},
-			},
-		}),
-	)
+	proxy := toxitest.New(t, u.Host)
+	// The server behind the proxy does not check signatures.
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "SECRETEXAMPLE")
+
+	s3Client, err := BackendConfig{
+		Backend:         BackendProxy,
+		Region:          "eu-west-2",
+		ProxyAddr:       proxy.Listen,
+		ProxyServerName: u.Hostname(),
+		RootCAs:         []*x509.Certificate{ts.Certificate()},
+	}.NewClient(context.TODO())
 	if err != nil {
-		slog.Error("Failed to create AWS session", "error", err)
-		return
+		t.Fatalf("Failed to create S3 client: %v", err)
 	}
 
-	var testLogs strings.Builder
-	w := io.MultiWriter(os.Stdout, &testLogs)
-	h := slog.NewTextHandler(w, nil)
-	slog.SetDefault(slog.New(h))
+	logger, logs := logtest.New()
 
-	s3Client := s3.NewFromConfig(cfg)
 	bucketName := "gopherconuk-2025-my-new-bucket"
 	region := "eu-west-2"
 	wantErr := false
 
 	defer deleteBucket(s3Client, bucketName, region)
-	if err := createS3Bucket(s3Client, bucketName, region); (err != nil) != wantErr {
+	err = createPastLatency(t, proxy, func(opts ...Option) error {
+		return createS3Bucket(s3Client, bucketName, region, append(opts, WithLogger(logger))...)
+	})
+	if (err != nil) != wantErr {
 		t.Errorf("createS3Bucket() error = %v, wantErr %v", err, wantErr)
 	}
 	if _, err := s3Client.HeadBucket(context.TODO(), &s3.HeadBucketInput{
@@ -115,12 +81,173 @@ func Test_createS3BucketSuccessfulRetry(t *testing.T) {
 	}); err != nil {
 		t.Errorf("Failed to get S3 bucket: %v", err)
 	}
-	// Wait for the toxic removal goroutine and check for errors
-	if err := <-removeToxicErr; err != nil {
-		t.Errorf("Failed to remove toxic: %v", err)
+
+	if failures := logs.Find("Failed to create S3 bucket"); len(failures) == 0 {
+		t.Errorf("Expected s3 bucket failure but did not find it in logs:\n%s", logs.Messages())
+	} else if got := failures[0]; got.String("bucket") != bucketName || got.Int("attempt") != 1 || got.Err("error") == nil {
+		t.Errorf("first failure logged bucket=%q attempt=%d error=%v, want bucket=%q attempt=1 and an error",
+			got.String("bucket"), got.Int("attempt"), got.Err("error"), bucketName)
+	}
+}
+
+func Test_createS3BucketInjectedFaults(t *testing.T) {
+	ts := httptest.NewTLSServer(s3fake.NewHandler())
+	defer ts.Close()
+	s3Client, transport := s3fake.NewFaultyClient(ts, "eu-west-2",
+		faultinject.S3Error(http.StatusServiceUnavailable, "SlowDown"),
+		faultinject.ConnReset(),
+	)
+
+	logger, logs := logtest.New()
+
+	bucketName := "gopherconuk-2025-my-new-bucket"
+	if err := createS3Bucket(s3Client, bucketName, "eu-west-2", WithRetryPolicy(RetryPolicy{MaxAttempts: 3}), WithLogger(logger)); err != nil {
+		t.Fatalf("createS3Bucket() error = %v", err)
+	}
+	if got := transport.Calls(); got != 3 {
+		t.Errorf("CreateBucket sent %d times, want 3", got)
+	}
+	failures := logs.Find("Failed to create S3 bucket")
+	if len(failures) != 2 {
+		t.Fatalf("logged %d failed attempts, want 2:\n%s", len(failures), logs.Messages())
+	}
+	for i, r := range failures {
+		if got := r.Int("attempt"); got != i+1 {
+			t.Errorf("failure %d logged attempt %d, want %d", i, got, i+1)
+		}
+	}
+}
+
+func Test_createS3BucketInjectedFaultsExhausted(t *testing.T) {
+	ts := httptest.NewTLSServer(s3fake.NewHandler())
+	defer ts.Close()
+	s3Client, transport := s3fake.NewFaultyClient(ts, "eu-west-2",
+		faultinject.S3Error(http.StatusInternalServerError, "InternalError"),
+		faultinject.S3Error(http.StatusInternalServerError, "InternalError"),
+		faultinject.S3Error(http.StatusInternalServerError, "InternalError"),
+	)
+
+	bucketName := "gopherconuk-2025-my-new-bucket"
+	if err := createS3Bucket(s3Client, bucketName, "eu-west-2", WithRetryPolicy(RetryPolicy{MaxAttempts: 3})); err == nil {
+		t.Fatalf("createS3Bucket() succeeded, want an error after three failed attempts")
+	}
+	if got := transport.Calls(); got != 3 {
+		t.Errorf("CreateBucket sent %d times, want 3", got)
 	}
+}
 
-	if !strings.Contains(testLogs.String(), "Failed to create S3 bucket") {
-		t.Errorf("Expected s3 bucket failure but did not find it in logs")
+func Test_createS3BucketResetAfterSend(t *testing.T) {
+	ts := httptest.NewTLSServer(s3fake.NewHandler())
+	defer ts.Close()
+	s3Client, transport := s3fake.NewFaultyClient(ts, "eu-west-2", faultinject.ResetAfterSend())
+
+	bucketName := "gopherconuk-2025-my-new-bucket"
+	if err := createS3Bucket(s3Client, bucketName, "eu-west-2", WithRetryPolicy(RetryPolicy{MaxAttempts: 3})); err != nil {
+		t.Fatalf("createS3Bucket() error = %v", err)
+	}
+	// The first CreateBucket went through, so the retry finds the bucket
+	// with HeadBucket instead of creating it again.
+	if got := transport.Calls(); got != 1 {
+		t.Errorf("CreateBucket sent %d times, want 1", got)
+	}
+}
+
+// noBackoff keeps the SDK retryer's attempts but not its sleeps.
+func noBackoff(o *awsretry.StandardOptions) {
+	o.Backoff = awsretry.BackoffDelayerFunc(func(int, error) (time.Duration, error) { return 0, nil })
+}
+
+func Test_createS3BucketSDKRetries(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    SDKRetries
+		retryer aws.Retryer
+		// faults is how many CreateBucket requests fail before one
+		// succeeds.
+		faults      int
+		wantErr     bool
+		wantCreates int
+		// wantHeads counts the HeadBucket requests, made before each retry
+		// and while waiting for a created bucket.
+		wantHeads int
+		// wantWire is the WireAttempts of each failed attempt of the loop,
+		// HeadBucket requests included.
+		wantWire []int
+	}{
+		{"disabled", SDKRetriesDisabled, awsretry.NewStandard(noBackoff), 9, true, 3, 2, []int{1, 2, 2}},
+		{"disabled adaptive", SDKRetriesDisabled, awsretry.NewAdaptiveMode(func(o *awsretry.AdaptiveModeOptions) {
+			o.StandardOptions = append(o.StandardOptions, noBackoff)
+		}), 9, true, 3, 2, []int{1, 2, 2}},
+		{"shared", SDKRetriesShared, awsretry.NewStandard(noBackoff), 9, true, 3, 0, []int{3}},
+		{"shared SDK recovers", SDKRetriesShared, awsretry.NewStandard(noBackoff), 1, false, 2, 1, nil},
+		{"shared loop recovers", SDKRetriesShared, awsretry.NewStandard(func(o *awsretry.StandardOptions) {
+			noBackoff(o)
+			o.MaxAttempts = 2
+		}), 2, false, 3, 2, []int{2}},
+		{"independent", SDKRetriesIndependent, awsretry.NewStandard(noBackoff), 9, true, 9, 2, []int{3, 4, 4}},
+		// Leaving RetryPolicy.SDK unset must keep the SDK's retries, as
+		// callers got before SDKRetries existed.
+		{"default", RetryPolicy{}.SDK, awsretry.NewStandard(noBackoff), 9, true, 9, 2, []int{3, 4, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewTLSServer(s3fake.NewHandler())
+			defer ts.Close()
+			schedule := make([]faultinject.Fault, tt.faults)
+			for i := range schedule {
+				schedule[i] = faultinject.S3Error(http.StatusInternalServerError, "InternalError")
+			}
+			s3Client, transport := s3fake.NewFaultyClient(ts, "eu-west-2", schedule...)
+			heads := faultinject.New(transport.Base)
+			heads.Match = faultinject.Method(http.MethodHead)
+			transport.Base = heads
+			s3Client = s3.New(s3Client.Options(), func(o *s3.Options) {
+				o.Retryer = tt.retryer
+			})
+			logger, logs := logtest.New()
+
+			err := createS3Bucket(s3Client, "gopherconuk-2025-my-new-bucket", "eu-west-2",
+				WithRetryPolicy(RetryPolicy{MaxAttempts: 3, SDK: tt.mode}), WithLogger(logger))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("createS3Bucket() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := transport.Calls(); got != tt.wantCreates {
+				t.Errorf("CreateBucket sent %d times, want %d", got, tt.wantCreates)
+			}
+			if got := heads.Calls(); got != tt.wantHeads {
+				t.Errorf("HeadBucket sent %d times, want %d", got, tt.wantHeads)
+			}
+
+			failures := logs.Find("Failed to create S3 bucket")
+			if len(failures) != len(tt.wantWire) {
+				t.Fatalf("logged %d failed attempts, want %d:\n%s", len(failures), len(tt.wantWire), logs.Messages())
+			}
+			total := 0
+			for i, r := range failures {
+				total += tt.wantWire[i]
+				if got := r.Int("wire_attempts"); got != total {
+					t.Errorf("failure %d logged wire_attempts %d, want %d", i+1, got, total)
+				}
+			}
+			if !tt.wantErr {
+				return
+			}
+			var retryErr *RetryError
+			if !errors.As(err, &retryErr) {
+				t.Fatalf("createS3Bucket() error = %v, want a *RetryError", err)
+			}
+			wantTotal := tt.wantCreates + tt.wantHeads
+			if retryErr.WireAttempts != wantTotal {
+				t.Errorf("RetryError.WireAttempts = %d, want %d", retryErr.WireAttempts, wantTotal)
+			}
+			for i, a := range retryErr.Attempts {
+				if a.WireAttempts != tt.wantWire[i] {
+					t.Errorf("Attempts[%d].WireAttempts = %d, want %d", i, a.WireAttempts, tt.wantWire[i])
+				}
+			}
+			if got := logs.Find("Failed to create S3 bucket after multiple attempts")[0].Int("wire_attempts"); got != wantTotal {
+				t.Errorf("final log wire_attempts = %d, want %d", got, wantTotal)
+			}
+		})
 	}
 }
@@ -0,0 +1,117 @@
+package s3
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestRedirectTransport(t *testing.T) {
+	var mu sync.Mutex
+	var serverNames []string
+	var protos []string
+	conns := 0
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		protos = append(protos, r.Proto)
+		mu.Unlock()
+		io.WriteString(w, r.Host)
+	}))
+	ts.EnableHTTP2 = true
+	ts.TLS = &tls.Config{GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		mu.Lock()
+		serverNames = append(serverNames, hello.ServerName)
+		mu.Unlock()
+		return nil, nil
+	}}
+	ts.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	client := &http.Client{Transport: NewRedirectTransport(
+		RedirectHost("*.example.com", ts.Listener.Addr().String()),
+		RedirectRootCAs(ts.Certificate()),
+	)}
+	for _, url := range []string{
+		"https://bucket.example.com/",
+		"https://bucket.example.com/key",
+		"https://other.example.com/",
+	} {
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatalf("GET %s error = %v", url, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if want := resp.Request.URL.Host; string(body) != want {
+			t.Errorf("GET %s reached host %q, want %q", url, body, want)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// One connection per hostname, reused within a host, with SNI naming the
+	// host that was asked for.
+	if conns != 2 {
+		t.Errorf("server saw %d connections, want 2", conns)
+	}
+	if len(serverNames) != 2 || serverNames[0] != "bucket.example.com" || serverNames[1] != "other.example.com" {
+		t.Errorf("SNI = %v, want [bucket.example.com other.example.com]", serverNames)
+	}
+	for _, proto := range protos {
+		if proto != "HTTP/2.0" {
+			t.Errorf("request used %s, want HTTP/2.0", proto)
+		}
+	}
+}
+
+func TestRedirectTransportVirtualHostedBucket(t *testing.T) {
+	var mu sync.Mutex
+	var hosts []string
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hosts = append(hosts, r.Host)
+		mu.Unlock()
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	// Without a base endpoint the SDK addresses the bucket by its
+	// virtual-hosted name, which the rule sends to the test server. Its
+	// certificate is for example.com, so that is the name to verify.
+	s3Client := s3.New(s3.Options{
+		Region: "eu-west-2",
+		HTTPClient: &http.Client{Transport: NewRedirectTransport(
+			RedirectHost("*.s3.eu-west-2.amazonaws.com", ts.Listener.Addr().String()),
+			RedirectServerName("*.s3.eu-west-2.amazonaws.com", "example.com"),
+			RedirectRootCAs(ts.Certificate()),
+		)},
+		Credentials: credentials.NewStaticCredentialsProvider("AKIDEXAMPLE", "SECRETEXAMPLE", ""),
+	})
+	bucketName := "gopherconuk-2025-my-new-bucket"
+	if _, err := s3Client.HeadBucket(context.Background(), &s3.HeadBucketInput{Bucket: aws.String(bucketName)}); err != nil {
+		t.Fatalf("HeadBucket() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := bucketName + ".s3.eu-west-2.amazonaws.com"; len(hosts) != 1 || hosts[0] != want {
+		t.Errorf("server saw hosts %v, want [%s]", hosts, want)
+	}
+}
@@ -0,0 +1,132 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func Test_validateBucketName(t *testing.T) {
+	tests := []struct {
+		name    string
+		bucket  string
+		wantErr bool
+	}{
+		{"typical", "gopherconuk-2025-my-new-bucket", false},
+		{"shortest", "abc", false},
+		{"longest", strings.Repeat("a", 63), false},
+		{"dots", "www.example.com", false},
+		{"too short", "ab", true},
+		{"too long", strings.Repeat("a", 64), true},
+		{"upper case", "Gophercon", true},
+		{"underscore", "my_bucket", true},
+		{"leading hyphen", "-bucket", true},
+		{"trailing dot", "bucket.", true},
+		{"adjacent dots", "my..bucket", true},
+		{"ip address", "192.168.5.4", true},
+		{"ip-like but not an address", "192.168.5.400", false},
+		{"xn-- prefix", "xn--bucket", true},
+		{"sthree- prefix", "sthree-bucket", true},
+		{"amzn-s3-demo- prefix", "amzn-s3-demo-bucket", true},
+		{"-s3alias suffix", "bucket-s3alias", true},
+		{"--ol-s3 suffix", "bucket--ol-s3", true},
+		{".mrap suffix", "bucket.mrap", true},
+		{"--x-s3 suffix", "bucket--usw2-az1--x-s3", true},
+		{"--table-s3 suffix", "bucket--table-s3", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateBucketName(tt.bucket)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateBucketName(%q) error = %v, wantErr %v", tt.bucket, err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidBucketName) {
+				t.Errorf("validateBucketName(%q) error = %v, want ErrInvalidBucketName", tt.bucket, err)
+			}
+		})
+	}
+}
+
+func Test_checkBucketNameTLS(t *testing.T) {
+	virtualHosted := s3.New(s3.Options{Region: "eu-west-2"})
+	pathStyle := s3.New(s3.Options{Region: "eu-west-2", UsePathStyle: true})
+
+	if err := checkBucketNameTLS(virtualHosted, "www.example.com"); !errors.Is(err, ErrInvalidBucketName) {
+		t.Errorf("virtual-hosted client with dotted name: error = %v, want ErrInvalidBucketName", err)
+	}
+	if err := checkBucketNameTLS(pathStyle, "www.example.com"); err != nil {
+		t.Errorf("path-style client with dotted name: error = %v", err)
+	}
+	if err := checkBucketNameTLS(virtualHosted, "gopherconuk-2025"); err != nil {
+		t.Errorf("virtual-hosted client without dots: error = %v", err)
+	}
+}
+
+func Test_newBucketName(t *testing.T) {
+	tests := []struct {
+		name       string
+		prefix     string
+		runID      string
+		wantPrefix string
+	}{
+		{"prefix and run ID", "gopherconuk-2025", "1234", "gopherconuk-2025-1234-"},
+		{"no run ID", "gopherconuk-2025", "", "gopherconuk-2025-"},
+		{"sanitized", "GopherCon UK.2025", "refs/pull/7", "gophercon-uk-2025-refs-pull-7-"},
+		{"truncated", strings.Repeat("long-", 20), "1234", strings.Repeat("long-", 10)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, err := newBucketName(tt.prefix, tt.runID)
+			if err != nil {
+				t.Fatalf("newBucketName() error = %v", err)
+			}
+			if err := validateBucketName(name); err != nil {
+				t.Errorf("newBucketName() = %q, which is invalid: %v", name, err)
+			}
+			if !strings.HasPrefix(name, tt.wantPrefix) {
+				t.Errorf("newBucketName() = %q, want prefix %q", name, tt.wantPrefix)
+			}
+			if strings.Contains(name, ".") {
+				t.Errorf("newBucketName() = %q, want no dots", name)
+			}
+		})
+	}
+
+	seen := map[string]bool{}
+	for range 100 {
+		name, _ := newBucketName("gopherconuk-2025", "1234")
+		if seen[name] {
+			t.Fatalf("newBucketName() returned %q twice", name)
+		}
+		seen[name] = true
+	}
+
+	if _, err := newBucketName("sthree", ""); !errors.Is(err, ErrInvalidBucketName) {
+		t.Errorf("newBucketName() with reserved prefix: error = %v, want ErrInvalidBucketName", err)
+	}
+}
+
+// countingS3Client counts CreateBucket calls.
+type countingS3Client struct {
+	mockS3Client
+	creates int
+}
+
+func (m *countingS3Client) CreateBucket(ctx context.Context, params *s3.CreateBucketInput, optFns ...func(*s3.Options)) (*s3.CreateBucketOutput, error) {
+	m.creates++
+	return m.mockS3Client.CreateBucket(ctx, params, optFns...)
+}
+
+func Test_createS3BucketRejectsInvalidName(t *testing.T) {
+	mockClient := &countingS3Client{}
+	err := createS3Bucket(mockClient, "Not_A_Bucket", "eu-west-2")
+	if !errors.Is(err, ErrInvalidBucketName) {
+		t.Fatalf("createS3Bucket() error = %v, want ErrInvalidBucketName", err)
+	}
+	if mockClient.creates != 0 {
+		t.Errorf("CreateBucket called %d times, want 0", mockClient.creates)
+	}
+}
@@ -0,0 +1,265 @@
+package s3
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// mockBucketConfig keeps the configuration written by the Put* calls so the
+// Get* calls can read it back. Unset settings fail the way S3 does.
+type mockBucketConfig struct {
+	mockBucketAPI
+	ownership  types.ObjectOwnership
+	pab        *types.PublicAccessBlockConfiguration
+	encryption *types.ServerSideEncryptionConfiguration
+	versioning types.BucketVersioningStatus
+	tags       []types.Tag
+	lifecycle  []types.LifecycleRule
+	policy     *string
+}
+
+func notConfigured(code string) error {
+	return &smithy.GenericAPIError{Code: code}
+}
+
+func (m *mockBucketConfig) GetBucketOwnershipControls(ctx context.Context, params *s3.GetBucketOwnershipControlsInput, optFns ...func(*s3.Options)) (*s3.GetBucketOwnershipControlsOutput, error) {
+	if m.ownership == "" {
+		return nil, notConfigured("OwnershipControlsNotFoundError")
+	}
+	return &s3.GetBucketOwnershipControlsOutput{OwnershipControls: &types.OwnershipControls{
+		Rules: []types.OwnershipControlsRule{{ObjectOwnership: m.ownership}},
+	}}, nil
+}
+
+func (m *mockBucketConfig) GetPublicAccessBlock(ctx context.Context, params *s3.GetPublicAccessBlockInput, optFns ...func(*s3.Options)) (*s3.GetPublicAccessBlockOutput, error) {
+	if m.pab == nil {
+		return nil, notConfigured("NoSuchPublicAccessBlockConfiguration")
+	}
+	return &s3.GetPublicAccessBlockOutput{PublicAccessBlockConfiguration: m.pab}, nil
+}
+
+func (m *mockBucketConfig) GetBucketEncryption(ctx context.Context, params *s3.GetBucketEncryptionInput, optFns ...func(*s3.Options)) (*s3.GetBucketEncryptionOutput, error) {
+	if m.encryption == nil {
+		return nil, notConfigured("ServerSideEncryptionConfigurationNotFoundError")
+	}
+	return &s3.GetBucketEncryptionOutput{ServerSideEncryptionConfiguration: m.encryption}, nil
+}
+
+func (m *mockBucketConfig) GetBucketVersioning(ctx context.Context, params *s3.GetBucketVersioningInput, optFns ...func(*s3.Options)) (*s3.GetBucketVersioningOutput, error) {
+	return &s3.GetBucketVersioningOutput{Status: m.versioning}, nil
+}
+
+func (m *mockBucketConfig) GetBucketTagging(ctx context.Context, params *s3.GetBucketTaggingInput, optFns ...func(*s3.Options)) (*s3.GetBucketTaggingOutput, error) {
+	if m.tags == nil {
+		return nil, notConfigured("NoSuchTagSet")
+	}
+	return &s3.GetBucketTaggingOutput{TagSet: m.tags}, nil
+}
+
+func (m *mockBucketConfig) GetBucketLifecycleConfiguration(ctx context.Context, params *s3.GetBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLifecycleConfigurationOutput, error) {
+	if m.lifecycle == nil {
+		return nil, notConfigured("NoSuchLifecycleConfiguration")
+	}
+	return &s3.GetBucketLifecycleConfigurationOutput{Rules: m.lifecycle}, nil
+}
+
+func (m *mockBucketConfig) GetBucketPolicy(ctx context.Context, params *s3.GetBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.GetBucketPolicyOutput, error) {
+	if m.policy == nil {
+		return nil, notConfigured("NoSuchBucketPolicy")
+	}
+	return &s3.GetBucketPolicyOutput{Policy: m.policy}, nil
+}
+
+func (m *mockBucketConfig) PutBucketOwnershipControls(ctx context.Context, params *s3.PutBucketOwnershipControlsInput, optFns ...func(*s3.Options)) (*s3.PutBucketOwnershipControlsOutput, error) {
+	m.ownership = params.OwnershipControls.Rules[0].ObjectOwnership
+	return &s3.PutBucketOwnershipControlsOutput{}, m.record("PutBucketOwnershipControls")
+}
+
+func (m *mockBucketConfig) PutPublicAccessBlock(ctx context.Context, params *s3.PutPublicAccessBlockInput, optFns ...func(*s3.Options)) (*s3.PutPublicAccessBlockOutput, error) {
+	m.pab = params.PublicAccessBlockConfiguration
+	return &s3.PutPublicAccessBlockOutput{}, m.record("PutPublicAccessBlock")
+}
+
+func (m *mockBucketConfig) PutBucketEncryption(ctx context.Context, params *s3.PutBucketEncryptionInput, optFns ...func(*s3.Options)) (*s3.PutBucketEncryptionOutput, error) {
+	m.encryption = params.ServerSideEncryptionConfiguration
+	return &s3.PutBucketEncryptionOutput{}, m.record("PutBucketEncryption")
+}
+
+func (m *mockBucketConfig) PutBucketVersioning(ctx context.Context, params *s3.PutBucketVersioningInput, optFns ...func(*s3.Options)) (*s3.PutBucketVersioningOutput, error) {
+	m.versioning = params.VersioningConfiguration.Status
+	return &s3.PutBucketVersioningOutput{}, m.record("PutBucketVersioning")
+}
+
+func (m *mockBucketConfig) PutBucketTagging(ctx context.Context, params *s3.PutBucketTaggingInput, optFns ...func(*s3.Options)) (*s3.PutBucketTaggingOutput, error) {
+	m.tags = params.Tagging.TagSet
+	return &s3.PutBucketTaggingOutput{}, m.record("PutBucketTagging")
+}
+
+func (m *mockBucketConfig) PutBucketLifecycleConfiguration(ctx context.Context, params *s3.PutBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketLifecycleConfigurationOutput, error) {
+	m.lifecycle = params.LifecycleConfiguration.Rules
+	return &s3.PutBucketLifecycleConfigurationOutput{}, m.record("PutBucketLifecycleConfiguration")
+}
+
+func (m *mockBucketConfig) PutBucketPolicy(ctx context.Context, params *s3.PutBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.PutBucketPolicyOutput, error) {
+	m.policy = params.Policy
+	return &s3.PutBucketPolicyOutput{}, m.record("PutBucketPolicy")
+}
+
+const testPolicy = `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Principal":"*","Action":"s3:*","Resource":"arn:aws:s3:::gopherconuk-2025-my-new-bucket/*","Condition":{"Bool":{"aws:SecureTransport":"false"}}}]}`
+
+// testPolicyReformatted is testPolicy with its keys reordered and indented.
+const testPolicyReformatted = `{
+  "Statement": [
+    {
+      "Action": "s3:*",
+      "Condition": {"Bool": {"aws:SecureTransport": "false"}},
+      "Effect": "Deny",
+      "Principal": "*",
+      "Resource": "arn:aws:s3:::gopherconuk-2025-my-new-bucket/*"
+    }
+  ],
+  "Version": "2012-10-17"
+}`
+
+func TestDiffAndReconcile(t *testing.T) {
+	spec := testBucketSpec()
+	spec.Policy = testPolicy
+	mockS3Client := &mockBucketConfig{}
+	ctx := context.Background()
+
+	if err := EnsureBucket(ctx, mockS3Client, spec, noRetryDelay); err != nil {
+		t.Fatalf("EnsureBucket() error = %v", err)
+	}
+	diff, err := Diff(ctx, mockS3Client, spec, noRetryDelay)
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	if !diff.Empty() {
+		t.Fatalf("Diff() after EnsureBucket = %v, want no changes", diff)
+	}
+
+	// Someone suspends versioning, drops a tag and rewrites the policy with
+	// different whitespace, which is not drift.
+	mockS3Client.versioning = types.BucketVersioningStatusSuspended
+	mockS3Client.tags = mockS3Client.tags[:1]
+	mockS3Client.policy = aws.String(testPolicyReformatted)
+	mockS3Client.calls = nil
+
+	diff, err = Diff(ctx, mockS3Client, spec, noRetryDelay)
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	if want := []string{FieldVersioning, FieldTags}; !slices.Equal(diff.Fields(), want) {
+		t.Errorf("Diff() fields = %v, want %v\n%v", diff.Fields(), want, diff)
+	}
+	if got := diff.Changes[0].Got; got != types.BucketVersioningStatusSuspended {
+		t.Errorf("versioning change got = %v, want Suspended", got)
+	}
+
+	diff, err = Reconcile(ctx, mockS3Client, spec, noRetryDelay)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if want := []string{"PutBucketVersioning", "PutBucketTagging"}; !slices.Equal(mockS3Client.calls, want) {
+		t.Errorf("Reconcile() calls = %v, want %v", mockS3Client.calls, want)
+	}
+	if diff, err = Diff(ctx, mockS3Client, spec, noRetryDelay); err != nil || !diff.Empty() {
+		t.Errorf("Diff() after Reconcile = %v, %v, want no changes", diff, err)
+	}
+}
+
+func TestDiffUnconfiguredBucket(t *testing.T) {
+	spec := testBucketSpec()
+	spec.Policy = testPolicy
+	mockS3Client := &mockBucketConfig{mockBucketAPI: mockBucketAPI{exists: true}}
+
+	diff, err := Diff(context.Background(), mockS3Client, spec, noRetryDelay)
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	want := []string{FieldObjectOwnership, FieldPublicAccessBlock, FieldEncryption, FieldVersioning, FieldTags, FieldLifecycleRules, FieldPolicy}
+	if !slices.Equal(diff.Fields(), want) {
+		t.Errorf("Diff() fields = %v, want %v", diff.Fields(), want)
+	}
+	for _, c := range diff.Changes {
+		if c.Field != FieldVersioning && c.Got != nil {
+			t.Errorf("%s got = %v, want nil for an unconfigured setting", c.Field, c.Got)
+		}
+	}
+}
+
+func TestLifecycleRulesEqual(t *testing.T) {
+	rule := func(edit func(r *types.LifecycleRule)) types.LifecycleRule {
+		r := types.LifecycleRule{
+			ID:         aws.String("expire-tmp"),
+			Status:     types.ExpirationStatusEnabled,
+			Filter:     &types.LifecycleRuleFilter{Prefix: aws.String("tmp/")},
+			Expiration: &types.LifecycleExpiration{Days: aws.Int32(1)},
+		}
+		if edit != nil {
+			edit(&r)
+		}
+		return r
+	}
+	archive := types.LifecycleRule{
+		ID:     aws.String("archive"),
+		Status: types.ExpirationStatusEnabled,
+		Filter: &types.LifecycleRuleFilter{Tag: &types.Tag{Key: aws.String("class"), Value: aws.String("cold")}},
+		Transitions: []types.Transition{
+			{Days: aws.Int32(30), StorageClass: types.TransitionStorageClassStandardIa},
+			{Days: aws.Int32(90), StorageClass: types.TransitionStorageClassGlacier},
+		},
+	}
+	tests := []struct {
+		name string
+		want []types.LifecycleRule
+		got  []types.LifecycleRule
+		same bool
+	}{
+		{"identical", []types.LifecycleRule{rule(nil)}, []types.LifecycleRule{rule(nil)}, true},
+		{"legacy prefix", []types.LifecycleRule{rule(nil)}, []types.LifecycleRule{rule(func(r *types.LifecycleRule) {
+			r.Filter, r.Prefix = nil, aws.String("tmp/")
+		})}, true},
+		{"empty filter", []types.LifecycleRule{rule(func(r *types.LifecycleRule) { r.Filter = nil })},
+			[]types.LifecycleRule{rule(func(r *types.LifecycleRule) { r.Filter = &types.LifecycleRuleFilter{Prefix: aws.String("")} })}, true},
+		{"zero pointers", []types.LifecycleRule{rule(nil)}, []types.LifecycleRule{rule(func(r *types.LifecycleRule) {
+			r.Expiration.ExpiredObjectDeleteMarker = aws.Bool(false)
+			r.Filter.ObjectSizeGreaterThan = aws.Int64(0)
+		})}, true},
+		{"tag under and", []types.LifecycleRule{archive}, []types.LifecycleRule{func() types.LifecycleRule {
+			r := archive
+			r.Filter = &types.LifecycleRuleFilter{And: &types.LifecycleRuleAndOperator{Tags: []types.Tag{*archive.Filter.Tag}}}
+			r.Transitions = []types.Transition{archive.Transitions[1], archive.Transitions[0]}
+			return r
+		}()}, true},
+		{"rule order", []types.LifecycleRule{rule(nil), archive}, []types.LifecycleRule{archive, rule(nil)}, true},
+		{"generated ID", []types.LifecycleRule{rule(func(r *types.LifecycleRule) { r.ID = nil })},
+			[]types.LifecycleRule{rule(func(r *types.LifecycleRule) { r.ID = aws.String("NjZkYjM3YzYtZjM5") })}, true},
+		{"changed days", []types.LifecycleRule{rule(nil)}, []types.LifecycleRule{rule(func(r *types.LifecycleRule) {
+			r.Expiration.Days = aws.Int32(7)
+		})}, false},
+		{"changed prefix", []types.LifecycleRule{rule(nil)}, []types.LifecycleRule{rule(func(r *types.LifecycleRule) {
+			r.Filter.Prefix = aws.String("logs/")
+		})}, false},
+		{"disabled", []types.LifecycleRule{rule(nil)}, []types.LifecycleRule{rule(func(r *types.LifecycleRule) {
+			r.Status = types.ExpirationStatusDisabled
+		})}, false},
+		{"renamed", []types.LifecycleRule{rule(nil)}, []types.LifecycleRule{rule(func(r *types.LifecycleRule) {
+			r.ID = aws.String("expire-temp")
+		})}, false},
+		{"extra rule", []types.LifecycleRule{rule(nil)}, []types.LifecycleRule{rule(nil), archive}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lifecycleRulesEqual(tt.want, tt.got); got != tt.same {
+				t.Errorf("lifecycleRulesEqual() = %v, want %v", got, tt.same)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// bucketExists reports whether name exists and is reachable by the caller,
+// giving the HeadBucket call up to timeout on o.clock; zero means no limit
+// beyond ctx. A missing bucket is not an error. If o.expectedBucketOwner is
+// set, S3 answers 403 for a bucket owned by any other account, which comes
+// back as an error.
+func bucketExists(ctx context.Context, o options, timeout time.Duration, api s3.HeadBucketAPIClient, name string) (bool, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = withTimeout(ctx, o.clock, timeout)
+		defer cancel()
+	}
+	input := &s3.HeadBucketInput{Bucket: aws.String(name)}
+	if o.expectedBucketOwner != "" {
+		input.ExpectedBucketOwner = aws.String(o.expectedBucketOwner)
+	}
+	if _, err := api.HeadBucket(ctx, input, sdkCallOptions(ctx)...); err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// waitForBucket calls HeadBucket until the bucket in input exists, for up
+// to o.waitTimeout, or with no limit beyond ctx if that is zero. It follows s3.BucketExistsWaiter and takes the same
+// options, treating NotFound as "not yet" and any other error as final, but
+// sleeps on o.clock so tests can skip the wait.
+func waitForBucket(ctx context.Context, o options, api s3.HeadBucketAPIClient, input *s3.HeadBucketInput) error {
+	wo := s3.BucketExistsWaiterOptions{
+		MinDelay:  defaultWaiterMinDelay,
+		MaxDelay:  defaultWaiterMaxDelay,
+		Retryable: bucketMissing,
+	}
+	for _, fn := range o.waiterOptions {
+		fn(&wo)
+	}
+	if wo.MinDelay <= 0 || wo.MaxDelay <= 0 || wo.MinDelay > wo.MaxDelay {
+		return fmt.Errorf("waiter delays must satisfy 0 < min (%v) <= max (%v)", wo.MinDelay, wo.MaxDelay)
+	}
+	optFns := slices.Clone(wo.ClientOptions)
+	if len(wo.APIOptions) > 0 {
+		optFns = append(optFns, func(so *s3.Options) {
+			so.APIOptions = append(so.APIOptions, wo.APIOptions...)
+		})
+	}
+	// Last, so the retry loop's limit wraps any retryer set above.
+	optFns = append(optFns, sdkCallOptions(ctx)...)
+
+	waitCtx := ctx
+	if o.waitTimeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = withTimeout(ctx, o.clock, o.waitTimeout)
+		defer cancel()
+	}
+	bucket := aws.ToString(input.Bucket)
+	delay := wo.MinDelay
+	for {
+		output, err := api.HeadBucket(waitCtx, input, optFns...)
+		retryable, err := wo.Retryable(waitCtx, input, output, err)
+		if err != nil {
+			return phaseTimeout(ctx, waitCtx, err, bucket, PhaseWait, o.waitTimeout)
+		}
+		if !retryable {
+			return nil
+		}
+		if err := sleep(waitCtx, o.clock, delay); err != nil {
+			err = fmt.Errorf("waiting for bucket %s to exist: %w", bucket, err)
+			return phaseTimeout(ctx, waitCtx, err, bucket, PhaseWait, o.waitTimeout)
+		}
+		delay = min(delay*2, wo.MaxDelay)
+	}
+}
+
+// bucketMissing is the default BucketExistsWaiterOptions.Retryable: keep
+// waiting while the bucket is not found.
+func bucketMissing(_ context.Context, _ *s3.HeadBucketInput, _ *s3.HeadBucketOutput, err error) (bool, error) {
+	if err == nil {
+		return false, nil
+	}
+	if isNotFound(err) {
+		return true, nil
+	}
+	return false, err
+}
+
+func isNotFound(err error) bool {
+	var notFound *types.NotFound
+	var noSuchBucket *types.NoSuchBucket
+	var statusErr interface{ HTTPStatusCode() int }
+	return errors.As(err, &notFound) ||
+		errors.As(err, &noSuchBucket) ||
+		errors.As(err, &statusErr) && statusErr.HTTPStatusCode() == http.StatusNotFound
+}
+
+// WithExpectedBucketOwner makes the existence checks pass only for buckets
+// owned by accountID, so a bucket of the same name in another account is
+// reported as an error rather than mistaken for our own.
+func WithExpectedBucketOwner(accountID string) Option {
+	return func(o *options) {
+		o.expectedBucketOwner = accountID
+	}
+}
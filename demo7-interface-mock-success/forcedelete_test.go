@@ -0,0 +1,162 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// mockBucketContents is a bucket holding object versions and multipart
+// uploads. Listings page through versions using the index as the key marker.
+type mockBucketContents struct {
+	mockS3Client
+	mu            sync.Mutex
+	versions      []types.ObjectVersion
+	uploads       []types.MultipartUpload
+	failKeys      map[string]bool
+	batchSizes    []int
+	inFlight      int
+	maxInFlight   int
+	aborted       int
+	bucketDeleted bool
+}
+
+func newMockBucketContents(versions, uploads int) *mockBucketContents {
+	m := &mockBucketContents{failKeys: make(map[string]bool)}
+	for i := range versions {
+		m.versions = append(m.versions, types.ObjectVersion{
+			Key:       aws.String(fmt.Sprintf("key-%04d", i)),
+			VersionId: aws.String("v1"),
+		})
+	}
+	for i := range uploads {
+		m.uploads = append(m.uploads, types.MultipartUpload{
+			Key:      aws.String(fmt.Sprintf("upload-%d", i)),
+			UploadId: aws.String(strconv.Itoa(i)),
+		})
+	}
+	return m
+}
+
+func (m *mockBucketContents) ListObjectVersions(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	start := 0
+	if params.KeyMarker != nil {
+		start, _ = strconv.Atoi(*params.KeyMarker)
+	}
+	end := min(start+int(aws.ToInt32(params.MaxKeys)), len(m.versions))
+	output := &s3.ListObjectVersionsOutput{
+		Versions:    m.versions[start:end],
+		IsTruncated: aws.Bool(end < len(m.versions)),
+	}
+	if end < len(m.versions) {
+		output.NextKeyMarker = aws.String(strconv.Itoa(end))
+		output.NextVersionIdMarker = aws.String("v1")
+	}
+	return output, nil
+}
+
+func (m *mockBucketContents) ListMultipartUploads(ctx context.Context, params *s3.ListMultipartUploadsInput, optFns ...func(*s3.Options)) (*s3.ListMultipartUploadsOutput, error) {
+	return &s3.ListMultipartUploadsOutput{Uploads: m.uploads, IsTruncated: aws.Bool(false)}, nil
+}
+
+func (m *mockBucketContents) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.aborted++
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func (m *mockBucketContents) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	m.mu.Lock()
+	m.inFlight++
+	m.maxInFlight = max(m.maxInFlight, m.inFlight)
+	m.batchSizes = append(m.batchSizes, len(params.Delete.Objects))
+	m.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight--
+	output := &s3.DeleteObjectsOutput{}
+	for _, obj := range params.Delete.Objects {
+		if m.failKeys[*obj.Key] {
+			output.Errors = append(output.Errors, types.Error{Key: obj.Key, VersionId: obj.VersionId, Code: aws.String("AccessDenied")})
+		}
+	}
+	return output, nil
+}
+
+func (m *mockBucketContents) DeleteBucket(ctx context.Context, params *s3.DeleteBucketInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketOutput, error) {
+	m.bucketDeleted = true
+	return &s3.DeleteBucketOutput{}, nil
+}
+
+func Test_deleteBucketForce(t *testing.T) {
+	mockS3Client := newMockBucketContents(2500, 2)
+	var last DeleteProgress
+	reports := 0
+
+	err := deleteBucket(mockS3Client, "gopherconuk-2025-my-new-bucket", "eu-west-2",
+		WithForceDelete(),
+		WithDeleteConcurrency(2),
+		WithDeleteProgress(func(p DeleteProgress) {
+			reports++
+			last = p
+		}))
+	if err != nil {
+		t.Fatalf("deleteBucket() error = %v", err)
+	}
+	if !mockS3Client.bucketDeleted {
+		t.Errorf("DeleteBucket was not called")
+	}
+	if want := []int{1000, 1000, 500}; fmt.Sprint(mockS3Client.batchSizes) != fmt.Sprint(want) {
+		t.Errorf("DeleteObjects batch sizes = %v, want %v", mockS3Client.batchSizes, want)
+	}
+	if mockS3Client.maxInFlight > 2 {
+		t.Errorf("%d DeleteObjects calls ran at once, want at most 2", mockS3Client.maxInFlight)
+	}
+	if mockS3Client.aborted != 2 {
+		t.Errorf("aborted %d uploads, want 2", mockS3Client.aborted)
+	}
+	if reports != 5 || last.ObjectsDeleted != 2500 || last.UploadsAborted != 2 || last.Failed != 0 {
+		t.Errorf("got %d progress reports ending in %+v, want 5 ending in 2500 objects and 2 uploads", reports, last)
+	}
+}
+
+func Test_deleteBucketForcePartialFailure(t *testing.T) {
+	mockS3Client := newMockBucketContents(10, 0)
+	mockS3Client.failKeys["key-0003"] = true
+
+	err := deleteBucket(mockS3Client, "gopherconuk-2025-my-new-bucket", "eu-west-2", WithForceDelete())
+	var partialErr *PartialDeleteError
+	if !errors.As(err, &partialErr) {
+		t.Fatalf("deleteBucket() error = %v, want *PartialDeleteError", err)
+	}
+	if len(partialErr.Failures) != 1 || partialErr.Failures[0].Key != "key-0003" {
+		t.Errorf("failures = %+v, want only key-0003", partialErr.Failures)
+	}
+	if partialErr.Progress.ObjectsDeleted != 9 {
+		t.Errorf("deleted %d objects, want 9", partialErr.Progress.ObjectsDeleted)
+	}
+	if mockS3Client.bucketDeleted {
+		t.Errorf("DeleteBucket was called although the bucket is not empty")
+	}
+}
+
+func Test_deleteBucketForceUnsupportedClient(t *testing.T) {
+	mockS3Client := mockS3Client{}
+	if err := deleteBucket(&mockS3Client, "gopherconuk-2025-my-new-bucket", "eu-west-2", WithForceDelete()); err == nil {
+		t.Errorf("deleteBucket() error = nil, want an error for a client that cannot list objects")
+	}
+}
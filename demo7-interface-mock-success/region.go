@@ -0,0 +1,55 @@
+package s3
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// usEast1 is S3's default location. CreateBucket there must not name a
+// LocationConstraint at all; S3 rejects "us-east-1" as one.
+const usEast1 = "us-east-1"
+
+// createBucketInput builds the CreateBucket request for a bucket called name
+// in region. Any region other than us-east-1 must be a
+// types.BucketLocationConstraint the SDK knows, which includes the legacy
+// "EU" for eu-west-1.
+func createBucketInput(name, region string) (*s3.CreateBucketInput, error) {
+	input := &s3.CreateBucketInput{Bucket: aws.String(name)}
+	if region == usEast1 {
+		return input, nil
+	}
+	constraint := types.BucketLocationConstraint(region)
+	if !slices.Contains(constraint.Values(), constraint) {
+		return nil, fmt.Errorf("%w: %q is not a known S3 location constraint", ErrInvalidRegion, region)
+	}
+	input.CreateBucketConfiguration = &types.CreateBucketConfiguration{LocationConstraint: constraint}
+	return input, nil
+}
+
+// clientRegion returns the region requests for region must be sent to.
+func clientRegion(region string) string {
+	if types.BucketLocationConstraint(region) == types.BucketLocationConstraintEu {
+		return "eu-west-1"
+	}
+	return region
+}
+
+// checkClientRegion refuses a client configured for a region other than the
+// one the bucket is being created in, since S3 would reject the request
+// with IllegalLocationConstraintException after a round trip. Clients that
+// do not expose their options, such as test doubles, are not checked.
+func checkClientRegion(client any, region string) error {
+	c, ok := client.(interface{ Options() s3.Options })
+	if !ok {
+		return nil
+	}
+	configured := c.Options().Region
+	if configured == "" || configured == clientRegion(region) {
+		return nil
+	}
+	return fmt.Errorf("%w: client is configured for %s but the bucket is for %s", ErrRegionMismatch, configured, region)
+}
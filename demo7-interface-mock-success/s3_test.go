@@ -2,9 +2,12 @@ package s3
 
 import (
 	"context"
+	"strings"
 	"testing"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/golangbot/s3/s3stub"
 )
 
 type mockS3Client struct {
@@ -33,3 +36,43 @@ func Test_createS3BucketSuccess(t *testing.T) {
 		t.Errorf("createS3Bucket() error = %v, wantErr %v", err, wantErr)
 	}
 }
+
+// Test_createS3BucketSDKStub stubs a real *s3.Client instead of replacing it,
+// so the SDK still serializes the request createS3Bucket builds.
+func Test_createS3BucketSDKStub(t *testing.T) {
+	tests := []struct {
+		region   string
+		wantURL  string
+		wantBody string
+	}{
+		{"eu-west-2", "https://gopherconuk-2025-my-new-bucket.s3.eu-west-2.amazonaws.com/", "<LocationConstraint>eu-west-2</LocationConstraint>"},
+		// us-east-1 sends no CreateBucketConfiguration at all.
+		{"us-east-1", "https://gopherconuk-2025-my-new-bucket.s3.us-east-1.amazonaws.com/", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.region, func(t *testing.T) {
+			stub := s3stub.New()
+			stub.Respond("CreateBucket", &s3.CreateBucketOutput{})
+			stub.Respond("HeadBucket", &s3.HeadBucketOutput{})
+			client := stub.NewClient(tt.region)
+
+			if err := createS3Bucket(client, "gopherconuk-2025-my-new-bucket", tt.region); err != nil {
+				t.Fatalf("createS3Bucket() error = %v", err)
+			}
+			calls := stub.Calls("CreateBucket")
+			if len(calls) != 1 {
+				t.Fatalf("CreateBucket called %d times, want 1", len(calls))
+			}
+			input := calls[0].Input.(*s3.CreateBucketInput)
+			if got := aws.ToString(input.Bucket); got != "gopherconuk-2025-my-new-bucket" {
+				t.Errorf("CreateBucketInput.Bucket = %q", got)
+			}
+			if got := calls[0].URL.String(); got != tt.wantURL {
+				t.Errorf("CreateBucket URL = %q, want %q", got, tt.wantURL)
+			}
+			if body := string(calls[0].Body); tt.wantBody == "" && body != "" || !strings.Contains(body, tt.wantBody) {
+				t.Errorf("CreateBucket body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
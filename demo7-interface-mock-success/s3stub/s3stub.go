@@ -0,0 +1,224 @@
+// Package s3stub stubs a real *s3.Client from inside its middleware stack.
+// Unlike a mock of the s3Client interface, the SDK still validates and
+// serializes the input, resolves the endpoint, signs the request and runs
+// its retryer; only the send and the response deserialization are
+// replaced, by canned outputs or errors per operation:
+//
+//	stub := s3stub.New()
+//	stub.Fail("CreateBucket", s3stub.APIError(http.StatusServiceUnavailable, "SlowDown", ""))
+//	stub.Respond("CreateBucket", &s3.CreateBucketOutput{})
+//	client := stub.NewClient("eu-west-2")
+//	...
+//	input := stub.Calls("CreateBucket")[0].Input.(*s3.CreateBucketInput)
+//
+// Nothing is ever sent over the network.
+package s3stub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// RequestID is the request ID on the errors APIError and HTTPError build.
+const RequestID = "s3stub-request"
+
+// Response is what one attempt at an operation gets back: Output, which
+// must be the operation's output type such as *s3.CreateBucketOutput, or
+// Err.
+type Response struct {
+	Output any
+	Err    error
+}
+
+// Call is one attempt at an operation, as the SDK built it. The SDK's
+// retryer makes a Call per attempt; they share Input.
+type Call struct {
+	Operation string
+	// Input is the operation's input after the SDK's own initialization,
+	// such as *s3.CreateBucketInput.
+	Input any
+	// Method, URL and Header are the signed request that would have been
+	// sent, so endpoint resolution and addressing style can be checked.
+	Method string
+	URL    *url.URL
+	Header http.Header
+	Body   []byte
+}
+
+// Stub answers operations from queues of canned responses. It is safe for
+// concurrent use.
+type Stub struct {
+	mu        sync.Mutex
+	responses map[string][]Response
+	calls     []Call
+}
+
+// New returns a Stub with no responses queued. An operation with nothing
+// queued fails without being retried.
+func New() *Stub {
+	return &Stub{responses: map[string][]Response{}}
+}
+
+// Respond queues a successful response for operation, such as
+// "CreateBucket". Responses are used in order and the last one queued for
+// an operation is reused for every later attempt.
+func (s *Stub) Respond(operation string, output any) {
+	s.queue(operation, Response{Output: output})
+}
+
+// Fail queues an error for operation, in the same queue as Respond.
+func (s *Stub) Fail(operation string, err error) {
+	s.queue(operation, Response{Err: err})
+}
+
+func (s *Stub) queue(operation string, resp Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[operation] = append(s.responses[operation], resp)
+}
+
+// Calls returns every attempt at operation so far, or every attempt at any
+// operation if operation is "".
+func (s *Stub) Calls(operation string) []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var calls []Call
+	for _, c := range s.calls {
+		if operation == "" || c.Operation == operation {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// NewClient returns a real *s3.Client for region whose operations the stub
+// answers. optFns are applied after the stub's options.
+func (s *Stub) NewClient(region string, optFns ...func(*s3.Options)) *s3.Client {
+	return s3.New(s3.Options{Region: region}, append([]func(*s3.Options){s.ClientOptions}, optFns...)...)
+}
+
+// ClientOptions installs the stub on a client's options, for use with
+// s3.New or s3.NewFromConfig. It gives the client dummy credentials if it
+// has none, so requests can be signed, and an HTTP client that refuses to
+// send anything in case a request gets past the stub.
+func (s *Stub) ClientOptions(o *s3.Options) {
+	o.APIOptions = append(o.APIOptions, s.addMiddleware)
+	if o.Credentials == nil {
+		o.Credentials = aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKIDSTUB", SecretAccessKey: "stub", Source: "s3stub"}, nil
+		})
+	}
+	o.HTTPClient = noNetwork{}
+}
+
+// inputKey is the stack value that carries an operation's input from the
+// Initialize step to the Deserialize step.
+type inputKey struct{}
+
+func (s *Stub) addMiddleware(stack *middleware.Stack) error {
+	// After the SDK's own Initialize middleware, so Input is what it
+	// validated.
+	err := stack.Initialize.Add(middleware.InitializeMiddlewareFunc("s3stub.CaptureInput",
+		func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			return next.HandleInitialize(middleware.WithStackValue(ctx, inputKey{}, in.Parameters), in)
+		}), middleware.After)
+	if err != nil {
+		return err
+	}
+	// First in Deserialize, which is after Finalize has resolved, signed
+	// and retried, and before anything sends or deserializes.
+	return stack.Deserialize.Add(middleware.DeserializeMiddlewareFunc("s3stub.Respond",
+		func(ctx context.Context, in middleware.DeserializeInput, _ middleware.DeserializeHandler) (middleware.DeserializeOutput, middleware.Metadata, error) {
+			return s.respond(ctx, in)
+		}), middleware.Before)
+}
+
+func (s *Stub) respond(ctx context.Context, in middleware.DeserializeInput) (middleware.DeserializeOutput, middleware.Metadata, error) {
+	var metadata middleware.Metadata
+	operation := awsmiddleware.GetOperationName(ctx)
+	call := Call{Operation: operation, Input: middleware.GetStackValue(ctx, inputKey{})}
+	if req, ok := in.Request.(*smithyhttp.Request); ok {
+		call.Method = req.Method
+		u := *req.URL
+		call.URL = &u
+		call.Header = req.Header.Clone()
+		if stream := req.GetStream(); stream != nil {
+			body, err := io.ReadAll(stream)
+			if err != nil {
+				return middleware.DeserializeOutput{}, metadata, fmt.Errorf("s3stub: read %s body: %w", operation, err)
+			}
+			call.Body = body
+		}
+	}
+
+	s.mu.Lock()
+	s.calls = append(s.calls, call)
+	queue := s.responses[operation]
+	if len(queue) == 0 {
+		s.mu.Unlock()
+		return middleware.DeserializeOutput{}, metadata, fmt.Errorf("s3stub: no response for %s", operation)
+	}
+	resp := queue[0]
+	if len(queue) > 1 {
+		s.responses[operation] = queue[1:]
+	}
+	s.mu.Unlock()
+
+	raw := &smithyhttp.Response{Response: &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}}
+	if resp.Err != nil {
+		var statusErr interface{ HTTPStatusCode() int }
+		if errors.As(resp.Err, &statusErr) {
+			raw.StatusCode = statusErr.HTTPStatusCode()
+		}
+		return middleware.DeserializeOutput{RawResponse: raw}, metadata, resp.Err
+	}
+	// The SDK type-asserts Result to the operation's output, so a wrong type
+	// would panic inside it.
+	if want := operation + "Output"; resp.Output == nil || reflect.TypeOf(resp.Output).Kind() != reflect.Pointer ||
+		reflect.TypeOf(resp.Output).Elem().Name() != want {
+		return middleware.DeserializeOutput{}, metadata, fmt.Errorf("s3stub: response for %s is %T, want *s3.%s", operation, resp.Output, want)
+	}
+	return middleware.DeserializeOutput{RawResponse: raw, Result: resp.Output}, metadata, nil
+}
+
+// HTTPError wraps err the way the SDK wraps an error response with status,
+// so the SDK's retryer and error classification treat it as the real thing.
+// err is typically a modeled error such as &types.NotFound{}.
+func HTTPError(status int, err error) error {
+	return &awshttp.ResponseError{
+		ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status, Header: http.Header{}}},
+			Err:      err,
+		},
+		RequestID: RequestID,
+	}
+}
+
+// APIError is HTTPError for an S3 error code without a modeled type, such
+// as SlowDown or InternalError.
+func APIError(status int, code, message string) error {
+	return HTTPError(status, &smithy.GenericAPIError{Code: code, Message: message})
+}
+
+// noNetwork is the HTTP client of a stubbed client. The stub answers before
+// anything is sent, so it is only reached if the stub was removed from the
+// stack.
+type noNetwork struct{}
+
+func (noNetwork) Do(req *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("s3stub: unexpected network request %s %s", req.Method, req.URL)
+}
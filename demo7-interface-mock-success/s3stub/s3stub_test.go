@@ -0,0 +1,123 @@
+package s3stub
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// noBackoff keeps the SDK's retries but not its sleeps.
+func noBackoff(o *s3.Options) {
+	o.Retryer = retry.NewStandard(func(so *retry.StandardOptions) {
+		so.Backoff = retry.BackoffDelayerFunc(func(int, error) (time.Duration, error) { return 0, nil })
+	})
+}
+
+func TestRespondCapturesBuiltRequest(t *testing.T) {
+	stub := New()
+	stub.Respond("CreateBucket", &s3.CreateBucketOutput{Location: aws.String("/my-bucket")})
+	client := stub.NewClient("eu-west-2")
+
+	out, err := client.CreateBucket(context.Background(), &s3.CreateBucketInput{
+		Bucket: aws.String("my-bucket"),
+		CreateBucketConfiguration: &types.CreateBucketConfiguration{
+			LocationConstraint: types.BucketLocationConstraintEuWest2,
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateBucket() error = %v", err)
+	}
+	if got := aws.ToString(out.Location); got != "/my-bucket" {
+		t.Errorf("Location = %q, want the canned /my-bucket", got)
+	}
+
+	calls := stub.Calls("CreateBucket")
+	if len(calls) != 1 {
+		t.Fatalf("Calls(CreateBucket) = %d, want 1", len(calls))
+	}
+	call := calls[0]
+	if input, ok := call.Input.(*s3.CreateBucketInput); !ok || aws.ToString(input.Bucket) != "my-bucket" {
+		t.Errorf("Input = %#v, want the *s3.CreateBucketInput for my-bucket", call.Input)
+	}
+	if got, want := call.Method+" "+call.URL.String(), "PUT https://my-bucket.s3.eu-west-2.amazonaws.com/"; got != want {
+		t.Errorf("request = %q, want %q", got, want)
+	}
+	if !strings.Contains(string(call.Body), "<LocationConstraint>eu-west-2</LocationConstraint>") {
+		t.Errorf("Body = %s, want the serialized LocationConstraint", call.Body)
+	}
+	if !strings.Contains(call.Header.Get("Authorization"), "Credential=AKIDSTUB/") {
+		t.Errorf("Authorization = %q, want a request signed with the stub's credentials", call.Header.Get("Authorization"))
+	}
+}
+
+func TestFailRunsSDKRetryer(t *testing.T) {
+	stub := New()
+	stub.Fail("HeadBucket", APIError(http.StatusServiceUnavailable, "SlowDown", "Please reduce your request rate."))
+	stub.Respond("HeadBucket", &s3.HeadBucketOutput{BucketRegion: aws.String("eu-west-2")})
+	client := stub.NewClient("eu-west-2", noBackoff)
+
+	if _, err := client.HeadBucket(context.Background(), &s3.HeadBucketInput{Bucket: aws.String("my-bucket")}); err != nil {
+		t.Fatalf("HeadBucket() error = %v, want the SDK to retry past SlowDown", err)
+	}
+	calls := stub.Calls("HeadBucket")
+	if len(calls) != 2 {
+		t.Fatalf("Calls(HeadBucket) = %d, want 2 attempts", len(calls))
+	}
+	if got := calls[1].Header.Get("Amz-Sdk-Request"); !strings.HasPrefix(got, "attempt=2;") {
+		t.Errorf("second attempt's amz-sdk-request = %q, want attempt=2", got)
+	}
+}
+
+func TestFailModeledError(t *testing.T) {
+	stub := New()
+	stub.Fail("HeadBucket", HTTPError(http.StatusNotFound, &types.NotFound{}))
+	client := stub.NewClient("eu-west-2")
+
+	_, err := client.HeadBucket(context.Background(), &s3.HeadBucketInput{Bucket: aws.String("my-bucket")})
+	var notFound *types.NotFound
+	if !errors.As(err, &notFound) {
+		t.Fatalf("HeadBucket() error = %v, want *types.NotFound", err)
+	}
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "NotFound" {
+		t.Errorf("HeadBucket() error code = %v, want NotFound", err)
+	}
+	if got := len(stub.Calls("")); got != 1 {
+		t.Errorf("Calls() = %d, want 1: a 404 is not retried", got)
+	}
+}
+
+func TestValidationRunsBeforeStub(t *testing.T) {
+	stub := New()
+	client := stub.NewClient("eu-west-2")
+	if _, err := client.CreateBucket(context.Background(), &s3.CreateBucketInput{}); err == nil {
+		t.Fatal("CreateBucket() without a bucket succeeded, want the SDK's validation error")
+	}
+	if got := len(stub.Calls("")); got != 0 {
+		t.Errorf("Calls() = %d, want 0: an invalid input never reaches the stub", got)
+	}
+}
+
+func TestUnstubbedOperation(t *testing.T) {
+	stub := New()
+	stub.Respond("CreateBucket", &s3.HeadBucketOutput{})
+	client := stub.NewClient("eu-west-2")
+
+	if _, err := client.DeleteBucket(context.Background(), &s3.DeleteBucketInput{Bucket: aws.String("b")}); err == nil ||
+		!strings.Contains(err.Error(), "no response for DeleteBucket") {
+		t.Errorf("DeleteBucket() error = %v, want no response for DeleteBucket", err)
+	}
+	if _, err := client.CreateBucket(context.Background(), &s3.CreateBucketInput{Bucket: aws.String("b")}); err == nil ||
+		!strings.Contains(err.Error(), "want *s3.CreateBucketOutput") {
+		t.Errorf("CreateBucket() error = %v, want a wrong output type error", err)
+	}
+}
@@ -0,0 +1,256 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// mockBucketAPI records every call EnsureBucket makes. Calls named in
+// failures fail with the given error until its count runs out.
+type mockBucketAPI struct {
+	mockS3Client
+	exists   bool
+	calls    []string
+	failures map[string]failure
+	tagging  *types.Tagging
+}
+
+type failure struct {
+	err   error
+	count int
+}
+
+func (m *mockBucketAPI) record(op string) error {
+	m.calls = append(m.calls, op)
+	f, ok := m.failures[op]
+	if !ok || f.count == 0 {
+		return nil
+	}
+	f.count--
+	m.failures[op] = f
+	return f.err
+}
+
+func (m *mockBucketAPI) CreateBucket(ctx context.Context, params *s3.CreateBucketInput, optFns ...func(*s3.Options)) (*s3.CreateBucketOutput, error) {
+	if err := m.record("CreateBucket"); err != nil {
+		return nil, err
+	}
+	m.exists = true
+	return &s3.CreateBucketOutput{}, nil
+}
+
+func (m *mockBucketAPI) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	if !m.exists {
+		return nil, &types.NotFound{}
+	}
+	return &s3.HeadBucketOutput{}, nil
+}
+
+func (m *mockBucketAPI) DeleteBucket(ctx context.Context, params *s3.DeleteBucketInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketOutput, error) {
+	if err := m.record("DeleteBucket"); err != nil {
+		return nil, err
+	}
+	m.exists = false
+	return &s3.DeleteBucketOutput{}, nil
+}
+
+func (m *mockBucketAPI) PutBucketOwnershipControls(ctx context.Context, params *s3.PutBucketOwnershipControlsInput, optFns ...func(*s3.Options)) (*s3.PutBucketOwnershipControlsOutput, error) {
+	return &s3.PutBucketOwnershipControlsOutput{}, m.record("PutBucketOwnershipControls")
+}
+
+func (m *mockBucketAPI) PutPublicAccessBlock(ctx context.Context, params *s3.PutPublicAccessBlockInput, optFns ...func(*s3.Options)) (*s3.PutPublicAccessBlockOutput, error) {
+	return &s3.PutPublicAccessBlockOutput{}, m.record("PutPublicAccessBlock")
+}
+
+func (m *mockBucketAPI) PutBucketEncryption(ctx context.Context, params *s3.PutBucketEncryptionInput, optFns ...func(*s3.Options)) (*s3.PutBucketEncryptionOutput, error) {
+	return &s3.PutBucketEncryptionOutput{}, m.record("PutBucketEncryption")
+}
+
+func (m *mockBucketAPI) PutBucketVersioning(ctx context.Context, params *s3.PutBucketVersioningInput, optFns ...func(*s3.Options)) (*s3.PutBucketVersioningOutput, error) {
+	return &s3.PutBucketVersioningOutput{}, m.record("PutBucketVersioning")
+}
+
+func (m *mockBucketAPI) GetBucketTagging(ctx context.Context, params *s3.GetBucketTaggingInput, optFns ...func(*s3.Options)) (*s3.GetBucketTaggingOutput, error) {
+	if m.tagging == nil {
+		return nil, notConfigured("NoSuchTagSet")
+	}
+	return &s3.GetBucketTaggingOutput{TagSet: m.tagging.TagSet}, nil
+}
+
+func (m *mockBucketAPI) PutBucketTagging(ctx context.Context, params *s3.PutBucketTaggingInput, optFns ...func(*s3.Options)) (*s3.PutBucketTaggingOutput, error) {
+	m.tagging = params.Tagging
+	return &s3.PutBucketTaggingOutput{}, m.record("PutBucketTagging")
+}
+
+func (m *mockBucketAPI) PutBucketLifecycleConfiguration(ctx context.Context, params *s3.PutBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketLifecycleConfigurationOutput, error) {
+	return &s3.PutBucketLifecycleConfigurationOutput{}, m.record("PutBucketLifecycleConfiguration")
+}
+
+func (m *mockBucketAPI) PutBucketPolicy(ctx context.Context, params *s3.PutBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.PutBucketPolicyOutput, error) {
+	return &s3.PutBucketPolicyOutput{}, m.record("PutBucketPolicy")
+}
+
+func testBucketSpec() BucketSpec {
+	return BucketSpec{
+		Name:       "gopherconuk-2025-my-new-bucket",
+		Region:     "eu-west-2",
+		Versioning: types.BucketVersioningStatusEnabled,
+		Encryption: &types.ServerSideEncryptionRule{
+			ApplyServerSideEncryptionByDefault: &types.ServerSideEncryptionByDefault{
+				SSEAlgorithm: types.ServerSideEncryptionAes256,
+			},
+		},
+		PublicAccessBlock: &types.PublicAccessBlockConfiguration{
+			BlockPublicAcls:       aws.Bool(true),
+			BlockPublicPolicy:     aws.Bool(true),
+			IgnorePublicAcls:      aws.Bool(true),
+			RestrictPublicBuckets: aws.Bool(true),
+		},
+		Tags:            map[string]string{"team": "gophers", "env": "test"},
+		ObjectOwnership: types.ObjectOwnershipBucketOwnerEnforced,
+		LifecycleRules: []types.LifecycleRule{{
+			ID:         aws.String("expire-tmp"),
+			Status:     types.ExpirationStatusEnabled,
+			Filter:     &types.LifecycleRuleFilter{Prefix: aws.String("tmp/")},
+			Expiration: &types.LifecycleExpiration{Days: aws.Int32(1)},
+		}},
+	}
+}
+
+var noRetryDelay = WithRetryPolicy(RetryPolicy{MaxAttempts: 3})
+
+func TestEnsureBucket(t *testing.T) {
+	mockS3Client := &mockBucketAPI{}
+
+	if err := EnsureBucket(context.Background(), mockS3Client, testBucketSpec(), noRetryDelay); err != nil {
+		t.Fatalf("EnsureBucket() error = %v", err)
+	}
+	want := []string{
+		"CreateBucket",
+		"PutBucketOwnershipControls",
+		"PutPublicAccessBlock",
+		"PutBucketEncryption",
+		"PutBucketVersioning",
+		"PutBucketTagging",
+		"PutBucketLifecycleConfiguration",
+	}
+	if !slices.Equal(mockS3Client.calls, want) {
+		t.Errorf("calls = %v, want %v", mockS3Client.calls, want)
+	}
+	if got := aws.ToString(mockS3Client.tagging.TagSet[0].Key); got != "env" {
+		t.Errorf("first tag = %s, want tags sorted by key", got)
+	}
+}
+
+func TestEnsureBucketKeepsTestRunTag(t *testing.T) {
+	mockS3Client := &mockBucketConfig{}
+	ctx := context.Background()
+	spec := BucketSpec{
+		Name:   "gopherconuk-2025-my-new-bucket",
+		Region: "eu-west-2",
+		Tags:   map[string]string{"team": "gophers"},
+	}
+
+	if err := EnsureBucket(ctx, mockS3Client, spec, WithBucketTags(map[string]string{TestRunTag: "run-1234"}), noRetryDelay); err != nil {
+		t.Fatalf("EnsureBucket() error = %v", err)
+	}
+	tags := map[string]string{}
+	for _, tag := range mockS3Client.tags {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	if want := map[string]string{TestRunTag: "run-1234", "team": "gophers"}; !maps.Equal(tags, want) {
+		t.Errorf("tags after EnsureBucket = %v, want %v", tags, want)
+	}
+
+	mockS3Client.calls = nil
+	diff, err := Reconcile(ctx, mockS3Client, spec, noRetryDelay)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if !diff.Empty() || len(mockS3Client.calls) != 0 {
+		t.Errorf("Reconcile() = %v with calls %v, want no changes: %s is not drift", diff, mockS3Client.calls, TestRunTag)
+	}
+}
+
+func TestEnsureBucketExistingBucket(t *testing.T) {
+	mockS3Client := &mockBucketAPI{exists: true}
+	spec := BucketSpec{
+		Name:       "gopherconuk-2025-my-new-bucket",
+		Region:     "eu-west-2",
+		Versioning: types.BucketVersioningStatusSuspended,
+	}
+
+	if err := EnsureBucket(context.Background(), mockS3Client, spec, noRetryDelay); err != nil {
+		t.Fatalf("EnsureBucket() error = %v", err)
+	}
+	if want := []string{"PutBucketVersioning"}; !slices.Equal(mockS3Client.calls, want) {
+		t.Errorf("calls = %v, want %v", mockS3Client.calls, want)
+	}
+}
+
+func TestEnsureBucketRetriesTransientFailure(t *testing.T) {
+	mockS3Client := &mockBucketAPI{failures: map[string]failure{
+		"PutBucketEncryption": {err: &smithy.GenericAPIError{Code: "SlowDown"}, count: 2},
+	}}
+
+	if err := EnsureBucket(context.Background(), mockS3Client, testBucketSpec(), noRetryDelay); err != nil {
+		t.Fatalf("EnsureBucket() error = %v", err)
+	}
+	n := 0
+	for _, call := range mockS3Client.calls {
+		if call == "PutBucketEncryption" {
+			n++
+		}
+	}
+	if n != 3 {
+		t.Errorf("PutBucketEncryption called %d times, want 3", n)
+	}
+}
+
+func TestEnsureBucketRollback(t *testing.T) {
+	tests := []struct {
+		name           string
+		exists         bool
+		wantRolledBack bool
+		wantExists     bool
+	}{
+		{name: "new bucket is deleted", exists: false, wantRolledBack: true, wantExists: false},
+		{name: "existing bucket is kept", exists: true, wantRolledBack: false, wantExists: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockS3Client := &mockBucketAPI{
+				exists: tt.exists,
+				failures: map[string]failure{
+					"PutBucketTagging": {err: &smithy.GenericAPIError{Code: "AccessDenied"}, count: 1},
+				},
+			}
+
+			err := EnsureBucket(context.Background(), mockS3Client, testBucketSpec(), noRetryDelay)
+			var ensureErr *EnsureBucketError
+			if !errors.As(err, &ensureErr) {
+				t.Fatalf("EnsureBucket() error = %v, want *EnsureBucketError", err)
+			}
+			if ensureErr.Step != "PutBucketTagging" {
+				t.Errorf("failed step = %s, want PutBucketTagging", ensureErr.Step)
+			}
+			if ensureErr.RolledBack != tt.wantRolledBack {
+				t.Errorf("RolledBack = %v, want %v", ensureErr.RolledBack, tt.wantRolledBack)
+			}
+			if mockS3Client.exists != tt.wantExists {
+				t.Errorf("bucket exists = %v, want %v", mockS3Client.exists, tt.wantExists)
+			}
+			if slices.Contains(mockS3Client.calls, "PutBucketLifecycleConfiguration") {
+				t.Errorf("steps after the failure were still applied: %v", mockS3Client.calls)
+			}
+		})
+	}
+}
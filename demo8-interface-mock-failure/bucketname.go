@@ -0,0 +1,131 @@
+package s3
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Limits on the length of a general purpose bucket name.
+const (
+	minBucketNameLen = 3
+	maxBucketNameLen = 63
+)
+
+// Prefixes and suffixes S3 reserves for its own use or for other kinds of
+// bucket, such as access point aliases and directory buckets.
+var (
+	reservedBucketPrefixes = []string{"xn--", "sthree-", "amzn-s3-demo-"}
+	reservedBucketSuffixes = []string{"-s3alias", "--ol-s3", ".mrap", "--x-s3", "--table-s3"}
+)
+
+// validateBucketName checks name against S3's rules for general purpose
+// bucket names, so a bad name fails before any request is sent. The error
+// wraps ErrInvalidBucketName and says which rule was broken.
+func validateBucketName(name string) error {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w %q: %s", ErrInvalidBucketName, name, fmt.Sprintf(format, args...))
+	}
+	if len(name) < minBucketNameLen || len(name) > maxBucketNameLen {
+		return invalid("must be %d to %d characters long", minBucketNameLen, maxBucketNameLen)
+	}
+	for i := 0; i < len(name); i++ {
+		if c := name[i]; !isBucketNameAlnum(c) && c != '-' && c != '.' {
+			return invalid("%q is not allowed; use lower-case letters, digits, hyphens and dots", c)
+		}
+	}
+	if !isBucketNameAlnum(name[0]) || !isBucketNameAlnum(name[len(name)-1]) {
+		return invalid("must begin and end with a letter or digit")
+	}
+	if strings.Contains(name, "..") {
+		return invalid("must not contain two adjacent dots")
+	}
+	if addr, err := netip.ParseAddr(name); err == nil && addr.Is4() {
+		return invalid("must not be formatted as an IP address")
+	}
+	for _, p := range reservedBucketPrefixes {
+		if strings.HasPrefix(name, p) {
+			return invalid("prefix %q is reserved", p)
+		}
+	}
+	for _, s := range reservedBucketSuffixes {
+		if strings.HasSuffix(name, s) {
+			return invalid("suffix %q is reserved", s)
+		}
+	}
+	return nil
+}
+
+func isBucketNameAlnum(c byte) bool {
+	return 'a' <= c && c <= 'z' || '0' <= c && c <= '9'
+}
+
+// checkBucketNameTLS refuses a name with dots when client addresses buckets
+// virtual-hosted style over HTTPS. The bucket becomes part of the host name
+// there, and S3's wildcard certificate only covers a single label, so every
+// request would fail certificate verification. Path-style clients and
+// clients that do not expose their options are not checked.
+func checkBucketNameTLS(client any, name string) error {
+	if !strings.Contains(name, ".") {
+		return nil
+	}
+	c, ok := client.(interface{ Options() s3.Options })
+	if !ok || c.Options().UsePathStyle {
+		return nil
+	}
+	return fmt.Errorf("%w %q: dots break TLS with virtual-hosted-style addressing; use path-style addressing or a name without dots", ErrInvalidBucketName, name)
+}
+
+// bucketNameSuffixLen is the number of random hex digits newBucketName adds.
+const bucketNameSuffixLen = 12
+
+// newBucketName returns a valid bucket name unlikely to be in use, made of
+// prefix, runID and a random suffix joined by hyphens, such as
+// "gopherconuk-2025-1234-3f9c0a17be42". runID identifies the test run, a CI
+// job ID for example, and may be empty. Both are lower-cased, characters S3
+// does not allow become hyphens, and the result never has dots, so it works
+// with any addressing style. prefix and runID are shortened if the name
+// would be too long.
+func newBucketName(prefix, runID string) (string, error) {
+	suffix := make([]byte, bucketNameSuffixLen/2)
+	rand.Read(suffix)
+	parts := []string{}
+	for _, p := range []string{prefix, runID} {
+		if p = sanitizeBucketNamePart(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	parts = append(parts, hex.EncodeToString(suffix))
+	name := strings.Join(parts, "-")
+	if len(name) > maxBucketNameLen {
+		// Keep the random suffix and as much of the front as fits.
+		head := strings.TrimRight(name[:maxBucketNameLen-bucketNameSuffixLen-1], "-")
+		name = head + "-" + hex.EncodeToString(suffix)
+	}
+	if err := validateBucketName(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// sanitizeBucketNamePart lower-cases s, turns each run of characters not
+// allowed in a bucket name, dots included, into a single hyphen and trims
+// hyphens from the ends.
+func sanitizeBucketNamePart(s string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(s) {
+		if r < 0x80 && isBucketNameAlnum(byte(r)) {
+			b.WriteRune(r)
+			hyphen = false
+		} else if !hyphen {
+			b.WriteByte('-')
+			hyphen = true
+		}
+	}
+	return strings.Trim(b.String(), "-")
+}
@@ -0,0 +1,84 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+func responseError(status int, err error) error {
+	return &awshttp.ResponseError{
+		ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status}},
+			Err:      err,
+		},
+	}
+}
+
+func TestClassifier_Classify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorClass
+	}{
+		{"bucket owned by you", &types.BucketAlreadyOwnedByYou{}, SuccessEquivalent},
+		{"bucket owned by another account", &types.BucketAlreadyExists{}, Terminal},
+		{"invalid bucket name", &smithy.GenericAPIError{Code: "InvalidBucketName"}, Terminal},
+		{"access denied", responseError(http.StatusForbidden, &smithy.GenericAPIError{Code: "AccessDenied"}), Terminal},
+		{"slow down", responseError(http.StatusServiceUnavailable, &smithy.GenericAPIError{Code: "SlowDown"}), Retryable},
+		{"internal error", responseError(http.StatusInternalServerError, &smithy.GenericAPIError{Code: "InternalError"}), Retryable},
+		{"unknown 5xx", responseError(http.StatusBadGateway, errors.New("bad gateway")), Retryable},
+		{"unknown 4xx", responseError(http.StatusBadRequest, errors.New("bad request")), Terminal},
+		{"throttled", responseError(http.StatusTooManyRequests, errors.New("too many requests")), Retryable},
+		{"attempt timeout", &aws.RequestCanceledError{Err: context.DeadlineExceeded}, Retryable},
+		{"connection reset", &smithyhttp.RequestSendError{Err: &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}}, Retryable},
+		{"wrapped connection reset", fmt.Errorf("send: %w", syscall.ECONNRESET), Retryable},
+		{"unrecognised", errors.New("mocked error: failed to create bucket"), Retryable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Classifier{}).Classify(tt.err); got != tt.want {
+				t.Errorf("Classify(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifier_CustomRules(t *testing.T) {
+	errQuota := errors.New("quota exceeded")
+	c := Classifier{Rules: []ClassifierRule{
+		func(err error) (ErrorClass, bool) {
+			if errors.Is(err, errQuota) {
+				return Terminal, true
+			}
+			return 0, false
+		},
+		func(err error) (ErrorClass, bool) {
+			var apiErr smithy.APIError
+			if errors.As(err, &apiErr) && apiErr.ErrorCode() == "AccessDenied" {
+				return Retryable, true
+			}
+			return 0, false
+		},
+	}}
+	if got := c.Classify(fmt.Errorf("create: %w", errQuota)); got != Terminal {
+		t.Errorf("Classify(quota) = %v, want %v", got, Terminal)
+	}
+	if got := c.Classify(&smithy.GenericAPIError{Code: "AccessDenied"}); got != Retryable {
+		t.Errorf("Classify(AccessDenied) = %v, want custom rule to win with %v", got, Retryable)
+	}
+	if got := c.Classify(&types.BucketAlreadyExists{}); got != Terminal {
+		t.Errorf("Classify(BucketAlreadyExists) = %v, want default rules to apply", got)
+	}
+}
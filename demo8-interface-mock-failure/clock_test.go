@@ -0,0 +1,166 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/golangbot/testkit/clocktest"
+)
+
+// hangingS3Client never answers CreateBucket; each call blocks until its
+// context is done. entered receives a value as each call starts.
+type hangingS3Client struct {
+	mockS3Client
+	entered chan struct{}
+}
+
+func (m hangingS3Client) CreateBucket(ctx context.Context,
+	params *s3.CreateBucketInput,
+	optFns ...func(*s3.Options)) (*s3.CreateBucketOutput, error) {
+	m.entered <- struct{}{}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func Test_createS3BucketCreateTimeoutFakeClock(t *testing.T) {
+	clock := clocktest.New(time.Now())
+	start := clock.Now()
+	mockS3Client := hangingS3Client{
+		mockS3Client: mockS3Client{callCount: make(map[string]int)},
+		entered:      make(chan struct{}),
+	}
+	var events eventLog
+	done := make(chan error, 1)
+	go func() {
+		done <- createS3BucketWithContext(context.Background(), mockS3Client, "gopherconuk-2025-my-new-bucket", "eu-west-2",
+			WithClock(clock),
+			WithRetryPolicy(RetryPolicy{MaxAttempts: 2, Backoff: ConstantBackoff{Interval: time.Second}}),
+			WithRetryObserver(&events))
+	}()
+
+	// Both attempts hang until their timeout, with a second's backoff
+	// between them.
+	<-mockS3Client.entered
+	clock.Advance(defaultCreateTimeout)
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	<-mockS3Client.entered
+	clock.Advance(defaultCreateTimeout)
+
+	select {
+	case err := <-done:
+		var timeoutErr *TimeoutError
+		if !errors.As(err, &timeoutErr) || timeoutErr.Phase != PhaseCreateBucket || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("createS3BucketWithContext() error = %v, want a CreateBucket *TimeoutError", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("createS3BucketWithContext() did not return after the fake clock passed both timeouts")
+	}
+	if got, want := clock.Since(start), 2*defaultCreateTimeout+time.Second; got != want {
+		t.Errorf("fake time passed = %v, want %v", got, want)
+	}
+	if len(events.retries) != 1 || events.retries[0].Delay != time.Second || events.retries[0].Elapsed != defaultCreateTimeout {
+		t.Errorf("retry events = %+v, want one 1s retry after %v", events.retries, defaultCreateTimeout)
+	}
+	if len(events.giveUps) != 1 || events.giveUps[0].Elapsed != 2*defaultCreateTimeout+time.Second {
+		t.Errorf("give-up events = %+v, want one after %v", events.giveUps, 2*defaultCreateTimeout+time.Second)
+	}
+}
+
+// slowHeadS3Client reports the bucket missing for the first misses
+// HeadBucket calls.
+type slowHeadS3Client struct {
+	calls  *int
+	misses int
+}
+
+func (m slowHeadS3Client) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	*m.calls++
+	if *m.calls <= m.misses {
+		return nil, &types.NotFound{}
+	}
+	return &s3.HeadBucketOutput{}, nil
+}
+
+func Test_waitForBucketBackoffFakeClock(t *testing.T) {
+	clock := clocktest.New(time.Now())
+	start := clock.Now()
+	calls := 0
+	client := slowHeadS3Client{calls: &calls, misses: 3}
+	done := make(chan error, 1)
+	go func() {
+		done <- waitForBucket(context.Background(), newOptions([]Option{WithClock(clock)}), client, &s3.HeadBucketInput{})
+	}()
+
+	// The overall wait is armed throughout, so a sleep makes two timers.
+	for _, d := range []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second} {
+		clock.BlockUntil(2)
+		clock.Advance(d)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("waitForBucket() error = %v", err)
+	}
+	if calls != 4 {
+		t.Errorf("HeadBucket called %d times, want 4", calls)
+	}
+	if got := clock.Since(start); got != 35*time.Second {
+		t.Errorf("fake time passed = %v, want 35s", got)
+	}
+}
+
+func Test_waitForBucketGivesUpFakeClock(t *testing.T) {
+	clock := clocktest.New(time.Now())
+	calls := 0
+	client := slowHeadS3Client{calls: &calls, misses: 100}
+	done := make(chan error, 1)
+	go func() {
+		done <- waitForBucket(context.Background(), newOptions([]Option{WithClock(clock)}), client, &s3.HeadBucketInput{})
+	}()
+
+	// 5s + 10s + 20s of backoff leaves the next 40s sleep cut short by the
+	// one minute limit.
+	for _, d := range []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second} {
+		clock.BlockUntil(2)
+		clock.Advance(d)
+	}
+	if err := <-done; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("waitForBucket() error = %v, want context.DeadlineExceeded", err)
+	}
+	if calls != 4 {
+		t.Errorf("HeadBucket called %d times, want 4", calls)
+	}
+}
+
+func Test_withTimeoutFakeClockDeadline(t *testing.T) {
+	// A fake clock set in the past must not hand the network stack a
+	// deadline that has already gone by.
+	clock := clocktest.New(time.Date(2025, 8, 13, 9, 0, 0, 0, time.UTC))
+	ctx, cancel := withTimeout(context.Background(), clock, 5*time.Second)
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); ok {
+		t.Errorf("Deadline() = %v, true, want no deadline on a fake clock", deadline)
+	}
+
+	parent, cancelParent := context.WithTimeout(context.Background(), time.Minute)
+	defer cancelParent()
+	want, _ := parent.Deadline()
+	ctx, cancel = withTimeout(parent, clock, 5*time.Second)
+	defer cancel()
+	if got, ok := ctx.Deadline(); !ok || !got.Equal(want) {
+		t.Errorf("Deadline() = %v, %v, want the parent's %v", got, ok, want)
+	}
+
+	clock.Advance(5 * time.Second)
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("context not done after the fake clock passed its timeout")
+	}
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		t.Errorf("Err() = %v, want context.DeadlineExceeded", ctx.Err())
+	}
+}
@@ -0,0 +1,144 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/golangbot/testkit/clocktest"
+)
+
+// forbiddenS3Client fails CreateBucket with a retryable error and then
+// finds the bucket belongs to someone else.
+type forbiddenS3Client struct {
+	mockS3Client
+}
+
+func (m forbiddenS3Client) CreateBucket(ctx context.Context,
+	params *s3.CreateBucketInput,
+	optFns ...func(*s3.Options)) (*s3.CreateBucketOutput, error) {
+	return nil, &smithy.GenericAPIError{Code: "SlowDown"}
+}
+
+func (m forbiddenS3Client) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	return nil, responseError(http.StatusForbidden, errors.New("Forbidden"))
+}
+
+func TestRetryError(t *testing.T) {
+	tests := []struct {
+		name          string
+		client        bucketCreatorAPI
+		wantReason    GiveUpReason
+		wantPhases    []string
+		wantExhausted bool
+		wantOwned     bool
+		wantAs        any
+	}{
+		{
+			name: "retryable errors until attempts run out",
+			client: erroringS3Client{
+				mockS3Client: mockS3Client{callCount: make(map[string]int)},
+				err:          &smithy.GenericAPIError{Code: "SlowDown"},
+			},
+			wantReason:    GiveUpAttempts,
+			wantPhases:    []string{PhaseCreateBucket, PhaseCreateBucket, PhaseCreateBucket},
+			wantExhausted: true,
+			wantAs:        new(*smithy.GenericAPIError),
+		},
+		{
+			name: "name taken by another account",
+			client: erroringS3Client{
+				mockS3Client: mockS3Client{callCount: make(map[string]int)},
+				err:          &types.BucketAlreadyExists{},
+			},
+			wantReason: GiveUpTerminal,
+			wantPhases: []string{PhaseCreateBucket},
+			wantOwned:  true,
+			wantAs:     new(*types.BucketAlreadyExists),
+		},
+		{
+			name:       "bucket found to be forbidden after a failed create",
+			client:     forbiddenS3Client{mockS3Client{callCount: make(map[string]int)}},
+			wantReason: GiveUpTerminal,
+			wantPhases: []string{PhaseCreateBucket, PhaseHeadBucket},
+			wantOwned:  true,
+			wantAs:     new(*smithy.GenericAPIError),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := createS3BucketWithContext(context.Background(), tt.client, "gopherconuk-2025-my-new-bucket", "eu-west-2",
+				WithRetryPolicy(RetryPolicy{MaxAttempts: 3}))
+			var retryErr *RetryError
+			if !errors.As(err, &retryErr) {
+				t.Fatalf("createS3BucketWithContext() error = %v, want a *RetryError", err)
+			}
+			if retryErr.Reason != tt.wantReason || retryErr.Op != "CreateBucket" || retryErr.Bucket != "gopherconuk-2025-my-new-bucket" {
+				t.Errorf("RetryError = %+v, want CreateBucket of gopherconuk-2025-my-new-bucket giving up with %v", retryErr, tt.wantReason)
+			}
+			if len(retryErr.Attempts) != len(tt.wantPhases) {
+				t.Fatalf("RetryError has %d attempts, want %d", len(retryErr.Attempts), len(tt.wantPhases))
+			}
+			for i, a := range retryErr.Attempts {
+				if a.Attempt != i+1 || a.Phase != tt.wantPhases[i] || a.Err == nil {
+					t.Errorf("attempt %d = %+v, want attempt %d failing in %s", i, a, i+1, tt.wantPhases[i])
+				}
+			}
+			if got := errors.Is(err, ErrRetriesExhausted); got != tt.wantExhausted {
+				t.Errorf("errors.Is(err, ErrRetriesExhausted) = %v, want %v", got, tt.wantExhausted)
+			}
+			if got := errors.Is(err, ErrBucketOwnedByOtherAccount); got != tt.wantOwned {
+				t.Errorf("errors.Is(err, ErrBucketOwnedByOtherAccount) = %v, want %v", got, tt.wantOwned)
+			}
+			if !errors.As(err, tt.wantAs) {
+				t.Errorf("errors.As(err, %T) = false, want true", tt.wantAs)
+			}
+		})
+	}
+}
+
+func TestRetryErrorTiming(t *testing.T) {
+	clock := clocktest.New(time.Date(2025, 8, 13, 9, 0, 0, 0, time.UTC))
+	start := clock.Now()
+	mockS3Client := hangingS3Client{
+		mockS3Client: mockS3Client{callCount: make(map[string]int)},
+		entered:      make(chan struct{}),
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- createS3BucketWithContext(context.Background(), mockS3Client, "gopherconuk-2025-my-new-bucket", "eu-west-2",
+			WithClock(clock),
+			WithRetryPolicy(RetryPolicy{MaxAttempts: 2, Backoff: ConstantBackoff{Interval: time.Second}}),
+			WithCreateTimeout(3*time.Second))
+	}()
+	<-mockS3Client.entered
+	clock.Advance(3 * time.Second)
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	<-mockS3Client.entered
+	clock.Advance(3 * time.Second)
+
+	err := <-done
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) || len(retryErr.Attempts) != 2 {
+		t.Fatalf("createS3BucketWithContext() error = %v, want a *RetryError with 2 attempts", err)
+	}
+	for i, wantStart := range []time.Time{start, start.Add(4 * time.Second)} {
+		a := retryErr.Attempts[i]
+		if !a.Start.Equal(wantStart) || a.Duration != 3*time.Second {
+			t.Errorf("attempt %d started at %v and took %v, want %v and 3s", a.Attempt, a.Start, a.Duration, wantStart)
+		}
+		var timeoutErr *TimeoutError
+		if !errors.As(a.Err, &timeoutErr) || timeoutErr.Phase != PhaseCreateBucket {
+			t.Errorf("attempt %d error = %v, want a CreateBucket *TimeoutError", a.Attempt, a.Err)
+		}
+	}
+	if !errors.Is(err, ErrRetriesExhausted) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("createS3BucketWithContext() error = %v, want it to match ErrRetriesExhausted and context.DeadlineExceeded", err)
+	}
+}
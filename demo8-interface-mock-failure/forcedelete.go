@@ -0,0 +1,251 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// maxDeleteObjects is the most keys S3 accepts in one DeleteObjects call.
+const maxDeleteObjects = 1000
+
+const defaultDeleteConcurrency = 4
+
+// bucketEmptierAPI is the part of the S3 API needed to empty a bucket before
+// deleting it.
+type bucketEmptierAPI interface {
+	s3.ListObjectVersionsAPIClient
+	s3.ListMultipartUploadsAPIClient
+	DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+	AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+}
+
+// DeleteProgress is reported to the WithDeleteProgress callback each time a
+// batch of objects is deleted or a multipart upload is aborted. Counts are
+// running totals for the bucket.
+type DeleteProgress struct {
+	Bucket         string
+	ObjectsDeleted int
+	UploadsAborted int
+	Failed         int
+}
+
+// ObjectDeleteFailure describes one object version or multipart upload that
+// could not be removed.
+type ObjectDeleteFailure struct {
+	Key       string
+	VersionID string
+	UploadID  string
+	Err       error
+}
+
+// PartialDeleteError is returned by a force delete that removed some, but
+// not all, of a bucket's contents. The bucket itself is left in place.
+type PartialDeleteError struct {
+	Bucket   string
+	Progress DeleteProgress
+	Failures []ObjectDeleteFailure
+}
+
+func (e *PartialDeleteError) Error() string {
+	return fmt.Sprintf("bucket %s: %d object(s) or upload(s) could not be deleted, first: %s: %v",
+		e.Bucket, len(e.Failures), e.Failures[0].Key, e.Failures[0].Err)
+}
+
+// WithForceDelete makes deleteBucket abort multipart uploads and delete every
+// object version and delete marker before deleting the bucket.
+func WithForceDelete() Option {
+	return func(o *options) {
+		o.forceDelete = true
+	}
+}
+
+// WithDeleteConcurrency bounds how many DeleteObjects and
+// AbortMultipartUpload calls a force delete runs at once.
+func WithDeleteConcurrency(n int) Option {
+	return func(o *options) {
+		o.deleteConcurrency = n
+	}
+}
+
+// WithDeleteProgress registers fn to be called as a force delete makes
+// progress. Calls are serialised, so fn does not need its own locking.
+func WithDeleteProgress(fn func(DeleteProgress)) Option {
+	return func(o *options) {
+		o.deleteProgress = fn
+	}
+}
+
+// bucketEmptier tracks one force delete. Work is fanned out to at most
+// concurrency goroutines and results are folded back under mu.
+type bucketEmptier struct {
+	api      bucketEmptierAPI
+	bucket   string
+	progress func(DeleteProgress)
+	logger   *slog.Logger
+	clock    Clock
+	sem      chan struct{}
+	wg       sync.WaitGroup
+
+	mu       sync.Mutex
+	state    DeleteProgress
+	failures []ObjectDeleteFailure
+}
+
+// emptyBucket removes every multipart upload, object version and delete
+// marker from bucket. It returns a *PartialDeleteError if anything is left.
+func emptyBucket(ctx context.Context, api bucketEmptierAPI, bucket string, o options) error {
+	concurrency := o.deleteConcurrency
+	if concurrency < 1 {
+		concurrency = defaultDeleteConcurrency
+	}
+	e := &bucketEmptier{
+		api:      api,
+		bucket:   bucket,
+		progress: o.deleteProgress,
+		logger:   o.logger,
+		clock:    o.clock,
+		sem:      make(chan struct{}, concurrency),
+		state:    DeleteProgress{Bucket: bucket},
+	}
+	err := e.abortUploads(ctx)
+	if err == nil {
+		err = e.deleteVersions(ctx)
+	}
+	e.wg.Wait()
+	if err != nil {
+		return err
+	}
+	if len(e.failures) > 0 {
+		return &PartialDeleteError{Bucket: bucket, Progress: e.state, Failures: e.failures}
+	}
+	e.logger.Info("S3 bucket emptied", "bucket", bucket, "objects", e.state.ObjectsDeleted, "uploads", e.state.UploadsAborted)
+	return nil
+}
+
+func (e *bucketEmptier) abortUploads(ctx context.Context) error {
+	paginator := s3.NewListMultipartUploadsPaginator(e.api, &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(e.bucket),
+	})
+	for paginator.HasMorePages() {
+		pageCtx, cancel := withTimeout(ctx, e.clock, attemptTimeout)
+		page, err := paginator.NextPage(pageCtx)
+		cancel()
+		if err != nil {
+			e.logger.Error("Failed to list multipart uploads", "bucket", e.bucket, "error", err)
+			return err
+		}
+		for _, upload := range page.Uploads {
+			e.run(ctx, func(ctx context.Context) {
+				_, err := e.api.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+					Bucket:   aws.String(e.bucket),
+					Key:      upload.Key,
+					UploadId: upload.UploadId,
+				})
+				e.mu.Lock()
+				defer e.mu.Unlock()
+				if err != nil {
+					e.failures = append(e.failures, ObjectDeleteFailure{
+						Key: aws.ToString(upload.Key), UploadID: aws.ToString(upload.UploadId), Err: err,
+					})
+					e.state.Failed++
+				} else {
+					e.state.UploadsAborted++
+				}
+				e.report()
+			})
+		}
+	}
+	return nil
+}
+
+func (e *bucketEmptier) deleteVersions(ctx context.Context) error {
+	paginator := s3.NewListObjectVersionsPaginator(e.api, &s3.ListObjectVersionsInput{
+		Bucket:  aws.String(e.bucket),
+		MaxKeys: aws.Int32(maxDeleteObjects),
+	})
+	var batch []types.ObjectIdentifier
+	for paginator.HasMorePages() {
+		pageCtx, cancel := withTimeout(ctx, e.clock, attemptTimeout)
+		page, err := paginator.NextPage(pageCtx)
+		cancel()
+		if err != nil {
+			e.logger.Error("Failed to list object versions", "bucket", e.bucket, "error", err)
+			return err
+		}
+		for _, v := range page.Versions {
+			batch = append(batch, types.ObjectIdentifier{Key: v.Key, VersionId: v.VersionId})
+		}
+		for _, m := range page.DeleteMarkers {
+			batch = append(batch, types.ObjectIdentifier{Key: m.Key, VersionId: m.VersionId})
+		}
+		for len(batch) >= maxDeleteObjects {
+			e.deleteBatch(ctx, batch[:maxDeleteObjects])
+			batch = batch[maxDeleteObjects:]
+		}
+	}
+	if len(batch) > 0 {
+		e.deleteBatch(ctx, batch)
+	}
+	return nil
+}
+
+func (e *bucketEmptier) deleteBatch(ctx context.Context, objects []types.ObjectIdentifier) {
+	objects = append([]types.ObjectIdentifier(nil), objects...)
+	e.run(ctx, func(ctx context.Context) {
+		output, err := e.api.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(e.bucket),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if err != nil {
+			e.logger.Error("Failed to delete objects", "bucket", e.bucket, "count", len(objects), "error", err)
+			for _, obj := range objects {
+				e.failures = append(e.failures, ObjectDeleteFailure{
+					Key: aws.ToString(obj.Key), VersionID: aws.ToString(obj.VersionId), Err: err,
+				})
+			}
+			e.state.Failed += len(objects)
+			e.report()
+			return
+		}
+		for _, objErr := range output.Errors {
+			e.failures = append(e.failures, ObjectDeleteFailure{
+				Key:       aws.ToString(objErr.Key),
+				VersionID: aws.ToString(objErr.VersionId),
+				Err:       fmt.Errorf("%s: %s", aws.ToString(objErr.Code), aws.ToString(objErr.Message)),
+			})
+		}
+		e.state.Failed += len(output.Errors)
+		e.state.ObjectsDeleted += len(objects) - len(output.Errors)
+		e.report()
+	})
+}
+
+// run calls fn on its own goroutine once a concurrency slot is free.
+func (e *bucketEmptier) run(ctx context.Context, fn func(context.Context)) {
+	e.sem <- struct{}{}
+	e.wg.Add(1)
+	go func() {
+		defer func() {
+			<-e.sem
+			e.wg.Done()
+		}()
+		ctx, cancel := withTimeout(ctx, e.clock, attemptTimeout)
+		defer cancel()
+		fn(ctx)
+	}()
+}
+
+// report must be called with mu held.
+func (e *bucketEmptier) report() {
+	if e.progress != nil {
+		e.progress(e.state)
+	}
+}
@@ -5,6 +5,8 @@ go 1.24.1
 require (
 	github.com/aws/aws-sdk-go-v2 v1.36.6
 	github.com/aws/aws-sdk-go-v2/service/s3 v1.84.1
+	github.com/aws/smithy-go v1.22.4
+	github.com/golangbot/testkit v0.0.0-00010101000000-000000000000
 )
 
 require (
@@ -16,5 +18,6 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/internal/checksum v1.7.5 // indirect
 	github.com/aws/aws-sdk-go-v2/service/internal/presigned-url v1.12.18 // indirect
 	github.com/aws/aws-sdk-go-v2/service/internal/s3shared v1.18.18 // indirect
-	github.com/aws/smithy-go v1.22.4 // indirect
 )
+
+replace github.com/golangbot/testkit => ../testkit
@@ -0,0 +1,177 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// eventLog is a RetryObserver that keeps every event.
+type eventLog struct {
+	attempts, retries, giveUps []RetryEvent
+}
+
+func (l *eventLog) OnAttempt(e RetryEvent) { l.attempts = append(l.attempts, e) }
+func (l *eventLog) OnRetry(e RetryEvent)   { l.retries = append(l.retries, e) }
+func (l *eventLog) OnGiveUp(e RetryEvent)  { l.giveUps = append(l.giveUps, e) }
+
+// waitFailingS3Client creates buckets but cannot see them afterwards.
+type waitFailingS3Client struct {
+	mockS3Client
+	err error
+}
+
+func (m waitFailingS3Client) CreateBucket(ctx context.Context,
+	params *s3.CreateBucketInput,
+	optFns ...func(*s3.Options)) (*s3.CreateBucketOutput, error) {
+	return &s3.CreateBucketOutput{}, nil
+}
+
+func (m waitFailingS3Client) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	return nil, m.err
+}
+
+func Test_createS3BucketObserverRetry(t *testing.T) {
+	mockS3Client := mockS3Client{callCount: make(map[string]int)}
+	var events eventLog
+	bucketName := "gopherconuk-2025-my-new-bucket"
+	err := createS3Bucket(mockS3Client, bucketName, "eu-west-2",
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: ConstantBackoff{Interval: time.Millisecond}}),
+		WithRetryObserver(&events))
+	if err != nil {
+		t.Fatalf("createS3Bucket() error = %v", err)
+	}
+
+	if len(events.attempts) != 3 {
+		t.Fatalf("OnAttempt called %d times, want 3", len(events.attempts))
+	}
+	for i, e := range events.attempts {
+		if e.Op != "CreateBucket" || e.Bucket != bucketName || e.Attempt != i+1 || e.Phase != PhaseCreateBucket {
+			t.Errorf("attempt event %d = %+v, want CreateBucket attempt %d of %s", i, e, i+1, bucketName)
+		}
+		if failed := i < 2; (e.Err != nil) != failed || (failed && e.Class != Retryable) {
+			t.Errorf("attempt event %d error = %v (%v), want failed=%v and retryable", i, e.Err, e.Class, failed)
+		}
+	}
+	if len(events.retries) != 2 {
+		t.Fatalf("OnRetry called %d times, want 2", len(events.retries))
+	}
+	var prev time.Duration
+	for i, e := range events.retries {
+		if e.Attempt != i+2 || e.Delay != time.Millisecond || e.Err == nil {
+			t.Errorf("retry event %d = %+v, want attempt %d after 1ms with the previous error", i, e, i+2)
+		}
+		if e.Elapsed < prev {
+			t.Errorf("retry event %d elapsed %v, before the previous event's %v", i, e.Elapsed, prev)
+		}
+		prev = e.Elapsed
+	}
+	if len(events.giveUps) != 0 {
+		t.Errorf("OnGiveUp called for a successful call: %+v", events.giveUps)
+	}
+}
+
+func Test_createS3BucketObserverGiveUp(t *testing.T) {
+	tests := []struct {
+		name        string
+		client      bucketCreatorAPI
+		policy      RetryPolicy
+		wantReason  GiveUpReason
+		wantPhase   string
+		wantAttempt int
+	}{
+		{
+			name: "terminal error",
+			client: erroringS3Client{
+				mockS3Client: mockS3Client{callCount: make(map[string]int)},
+				err:          &types.BucketAlreadyExists{},
+			},
+			policy:      RetryPolicy{MaxAttempts: 3},
+			wantReason:  GiveUpTerminal,
+			wantPhase:   PhaseCreateBucket,
+			wantAttempt: 1,
+		},
+		{
+			name: "attempts used up",
+			client: erroringS3Client{
+				mockS3Client: mockS3Client{callCount: make(map[string]int)},
+				err:          &smithy.GenericAPIError{Code: "SlowDown"},
+			},
+			policy:      RetryPolicy{MaxAttempts: 3},
+			wantReason:  GiveUpAttempts,
+			wantPhase:   PhaseCreateBucket,
+			wantAttempt: 3,
+		},
+		{
+			name: "time budget used up",
+			client: erroringS3Client{
+				mockS3Client: mockS3Client{callCount: make(map[string]int)},
+				err:          &smithy.GenericAPIError{Code: "SlowDown"},
+			},
+			policy:      RetryPolicy{MaxAttempts: 5, MaxElapsed: time.Millisecond, Backoff: ConstantBackoff{Interval: time.Second}},
+			wantReason:  GiveUpElapsed,
+			wantPhase:   PhaseCreateBucket,
+			wantAttempt: 1,
+		},
+		{
+			name: "waiter fails",
+			client: waitFailingS3Client{
+				mockS3Client: mockS3Client{callCount: make(map[string]int)},
+				err:          &smithy.GenericAPIError{Code: "InternalError"},
+			},
+			policy:      RetryPolicy{MaxAttempts: 1},
+			wantReason:  GiveUpAttempts,
+			wantPhase:   PhaseWait,
+			wantAttempt: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var events eventLog
+			err := createS3BucketWithContext(context.Background(), tt.client, "gopherconuk-2025-my-new-bucket", "eu-west-2",
+				WithRetryPolicy(tt.policy), WithRetryObserver(&events))
+			if err == nil {
+				t.Fatalf("createS3BucketWithContext() error = nil, want an error")
+			}
+			if len(events.giveUps) != 1 {
+				t.Fatalf("OnGiveUp called %d times, want 1", len(events.giveUps))
+			}
+			e := events.giveUps[0]
+			if e.Reason != tt.wantReason || e.Phase != tt.wantPhase || e.Attempt != tt.wantAttempt {
+				t.Errorf("give-up event = reason %v, phase %s, attempt %d; want %v, %s, %d",
+					e.Reason, e.Phase, e.Attempt, tt.wantReason, tt.wantPhase, tt.wantAttempt)
+			}
+			if !errors.Is(err, e.Err) {
+				t.Errorf("give-up event error = %v, want the returned error %v", e.Err, err)
+			}
+			var phaseErr *phaseError
+			if errors.As(err, &phaseErr) {
+				t.Errorf("createS3BucketWithContext() error = %v, leaks its phase tag", err)
+			}
+		})
+	}
+}
+
+func Test_createS3BucketObserverCanceled(t *testing.T) {
+	mockS3Client := mockS3Client{callCount: make(map[string]int)}
+	ctx, cancel := context.WithCancel(context.Background())
+	var giveUps []RetryEvent
+	err := createS3BucketWithContext(ctx, mockS3Client, "gopherconuk-2025-my-new-bucket", "eu-west-2",
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: ConstantBackoff{Interval: time.Minute}}),
+		WithRetryObserver(RetryObserverFuncs{
+			Retry:  func(RetryEvent) { cancel() },
+			GiveUp: func(e RetryEvent) { giveUps = append(giveUps, e) },
+		}))
+	var canceled *CanceledError
+	if !errors.As(err, &canceled) {
+		t.Fatalf("createS3BucketWithContext() error = %v, want a *CanceledError", err)
+	}
+	if len(giveUps) != 1 || giveUps[0].Reason != GiveUpCanceled || giveUps[0].Attempt != 1 || giveUps[0].Err != err {
+		t.Errorf("give-up events = %+v, want one canceled after attempt 1 with the returned error", giveUps)
+	}
+}
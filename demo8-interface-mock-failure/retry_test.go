@@ -0,0 +1,86 @@
+package s3
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConstantBackoff(t *testing.T) {
+	b := ConstantBackoff{Interval: 300 * time.Millisecond}
+	for n := 1; n <= 3; n++ {
+		if got := b.Delay(n, 0); got != 300*time.Millisecond {
+			t.Errorf("Delay(%d) = %v, want 300ms", n, got)
+		}
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff ExponentialBackoff
+		want    []time.Duration
+	}{
+		{
+			name:    "doubles by default",
+			backoff: ExponentialBackoff{Base: 100 * time.Millisecond},
+			want:    []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond},
+		},
+		{
+			name:    "capped at max",
+			backoff: ExponentialBackoff{Base: time.Second, Max: 3 * time.Second},
+			want:    []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second},
+		},
+		{
+			name:    "custom multiplier",
+			backoff: ExponentialBackoff{Base: 10 * time.Millisecond, Multiplier: 3},
+			want:    []time.Duration{10 * time.Millisecond, 30 * time.Millisecond, 90 * time.Millisecond},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, want := range tt.want {
+				if got := tt.backoff.Delay(i+1, 0); got != want {
+					t.Errorf("Delay(%d) = %v, want %v", i+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDecorrelatedJitterBackoff(t *testing.T) {
+	b := DecorrelatedJitterBackoff{
+		Base: 100 * time.Millisecond,
+		Max:  time.Second,
+		Rand: func() float64 { return 0.5 },
+	}
+	// With Rand fixed at 0.5 each delay is base + (3*prev-base)/2.
+	want := []time.Duration{200 * time.Millisecond, 350 * time.Millisecond, 575 * time.Millisecond, 912500 * time.Microsecond, time.Second}
+	var prev time.Duration
+	for i, w := range want {
+		got := b.Delay(i+1, prev)
+		if got != w {
+			t.Errorf("Delay(%d, %v) = %v, want %v", i+1, prev, got, w)
+		}
+		prev = got
+	}
+
+	b.Rand = nil
+	for range 100 {
+		if got := b.Delay(1, 200*time.Millisecond); got < b.Base || got > 600*time.Millisecond {
+			t.Fatalf("Delay() = %v, want within [100ms, 600ms]", got)
+		}
+	}
+}
+
+func TestRetryPolicyExhausted(t *testing.T) {
+	p := RetryPolicy{MaxElapsed: time.Second}
+	if p.exhausted(500*time.Millisecond, 400*time.Millisecond) {
+		t.Errorf("exhausted() = true before reaching MaxElapsed")
+	}
+	if !p.exhausted(800*time.Millisecond, 400*time.Millisecond) {
+		t.Errorf("exhausted() = false after passing MaxElapsed")
+	}
+	if (RetryPolicy{}).exhausted(time.Hour, time.Hour) {
+		t.Errorf("exhausted() = true with no MaxElapsed")
+	}
+}
@@ -2,12 +2,12 @@ package s3
 
 import (
 	"context"
-	"log/slog"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 type s3Client interface {
@@ -16,48 +16,168 @@ type s3Client interface {
 	s3.HeadBucketAPIClient
 }
 
-func createS3Bucket(s3Client s3Client, name string, region string) error {
-	var lastError error
-	retryCount := 3
-	for range retryCount {
-		func() {
-			lastError = nil
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
-			if _, err := s3Client.CreateBucket(ctx, &s3.CreateBucketInput{
-				Bucket: aws.String(name),
-				CreateBucketConfiguration: &types.CreateBucketConfiguration{
-					LocationConstraint: types.BucketLocationConstraint(region),
-				},
-			}); err != nil {
-				slog.Error("Failed to create S3 bucket", "bucket", name, "error", err)
-				lastError = err
-				return
+// attemptTimeout bounds a single call or attempt where nothing more specific
+// applies. It is derived from the caller's context, so a shorter parent
+// deadline still wins.
+const attemptTimeout = 5 * time.Second
+
+// bucketCreatorAPI is the part of the S3 API that creating a bucket needs.
+type bucketCreatorAPI interface {
+	CreateBucket(ctx context.Context, params *s3.CreateBucketInput, optFns ...func(*s3.Options)) (*s3.CreateBucketOutput, error)
+	s3.HeadBucketAPIClient
+}
+
+func createS3Bucket(s3Client s3Client, name string, region string, opts ...Option) error {
+	return createS3BucketWithContext(context.Background(), s3Client, name, region, opts...)
+}
+
+// createS3BucketWithContext is like createS3Bucket but runs the whole retry
+// loop under ctx. Cancelling ctx stops further attempts and returns a
+// *CanceledError. The CreateBucket call and the wait for the bucket have
+// separate time limits, and running out of either, or of the operation
+// timeout, is reported as a *TimeoutError naming the phase.
+func createS3BucketWithContext(ctx context.Context, s3Client bucketCreatorAPI, name string, region string, opts ...Option) error {
+	o := newOptions(opts)
+	input, err := prepareCreateBucket(s3Client, name, region)
+	if err != nil {
+		o.logger.Error("Refusing to create S3 bucket", "bucket", name, "region", region, "error", err)
+		return err
+	}
+	opCtx := ctx
+	if o.operationTimeout > 0 {
+		var cancel context.CancelFunc
+		opCtx, cancel = withTimeout(ctx, o.clock, o.operationTimeout)
+		defer cancel()
+	}
+	// Each phase of an attempt has its own timeout, so the attempt as a
+	// whole needs none.
+	ro := o
+	ro.attemptTimeout = 0
+	createSent := false
+	err = retry(opCtx, ro, "CreateBucket", name, func(ctx context.Context, attempt int) error {
+		// An earlier CreateBucket may have gone through even though we
+		// never saw the response, so look before creating again. The look
+		// is part of the create phase and shares its time limit.
+		if createSent {
+			exists, err := bucketExists(ctx, o, o.createTimeout, s3Client, name)
+			if exists {
+				o.logger.Info("S3 bucket was created by an earlier attempt", "bucket", name, "attempt", attempt)
+				return nil
 			}
-			if err := s3.NewBucketExistsWaiter(s3Client).Wait(
-				ctx, &s3.HeadBucketInput{Bucket: aws.String(name)}, time.Minute); err != nil {
-				slog.Error("Failed attempt to wait for bucket to exist.\n", "error", err)
-				lastError = err
-				return
+			if err != nil && o.classifier.Classify(err) == Terminal {
+				return inPhase(PhaseHeadBucket, err)
 			}
-		}()
-		if lastError == nil {
-			slog.Info("S3 bucket created successfully", "bucket", name)
-			return nil
 		}
+		createSent = true
+		createCtx, cancel := ctx, context.CancelFunc(func() {})
+		if o.createTimeout > 0 {
+			createCtx, cancel = withTimeout(ctx, o.clock, o.createTimeout)
+		}
+		_, err := s3Client.CreateBucket(createCtx, input, sdkCallOptions(ctx)...)
+		err = phaseTimeout(ctx, createCtx, err, name, PhaseCreateBucket, o.createTimeout)
+		cancel()
+		if err != nil {
+			if o.classifier.Classify(err) != SuccessEquivalent {
+				return inPhase(PhaseCreateBucket, err)
+			}
+			o.logger.Info("S3 bucket already exists", "bucket", name, "error", err)
+		}
+		headInput := &s3.HeadBucketInput{Bucket: aws.String(name)}
+		if o.expectedBucketOwner != "" {
+			headInput.ExpectedBucketOwner = aws.String(o.expectedBucketOwner)
+		}
+		return inPhase(PhaseWait, waitForBucket(ctx, o, s3Client, headInput))
+	})
+	err = phaseTimeout(ctx, opCtx, err, name, PhaseOperation, o.operationTimeout)
+	if err != nil {
+		args := []any{"bucket", name, "error", err}
+		var retryErr *RetryError
+		if errors.As(err, &retryErr) && retryErr.WireAttempts > 0 {
+			args = append(args, "wire_attempts", retryErr.WireAttempts)
+		}
+		o.logger.Error("Failed to create S3 bucket after multiple attempts", args...)
+		return err
 	}
-	slog.Error("Failed to create S3 bucket after multiple attempts", "bucket", name, "error", lastError)
-	return lastError
+	if len(o.bucketTags) > 0 {
+		if err := tagBucket(opCtx, s3Client, name, o); err != nil {
+			o.logger.Error("Failed to tag S3 bucket", "bucket", name, "error", err)
+			return err
+		}
+	}
+	o.logger.Info("S3 bucket created successfully", "bucket", name)
+	return nil
 }
 
-func deleteBucket(s3Client s3Client, name string, region string) error {
-	output, err := s3Client.DeleteBucket(context.TODO(), &s3.DeleteBucketInput{
+// prepareCreateBucket checks everything about a CreateBucket request that
+// can be checked without sending it, and builds its input.
+func prepareCreateBucket(s3Client any, name, region string) (*s3.CreateBucketInput, error) {
+	if err := validateBucketName(name); err != nil {
+		return nil, err
+	}
+	if err := checkBucketNameTLS(s3Client, name); err != nil {
+		return nil, err
+	}
+	input, err := createBucketInput(name, region)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkClientRegion(s3Client, region); err != nil {
+		return nil, err
+	}
+	return input, nil
+}
+
+func deleteBucket(s3Client s3Client, name string, region string, opts ...Option) error {
+	return deleteBucketWithContext(context.Background(), s3Client, name, region, opts...)
+}
+
+// deleteBucketWithContext is like deleteBucket but derives its timeout from
+// ctx and returns a *CanceledError if ctx is done before the bucket is gone.
+// With WithForceDelete the bucket is emptied first.
+func deleteBucketWithContext(ctx context.Context, s3Client s3Client, name string, region string, opts ...Option) error {
+	return deleteBucketWithOptions(ctx, s3Client, name, newOptions(opts))
+}
+
+// bucketDeleterAPI is the part of the S3 API that deleting a bucket needs. A
+// force delete also needs bucketEmptierAPI.
+type bucketDeleterAPI interface {
+	DeleteBucket(ctx context.Context, params *s3.DeleteBucketInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketOutput, error)
+}
+
+func deleteBucketWithOptions(ctx context.Context, s3Client bucketDeleterAPI, name string, o options) error {
+	if err := ctx.Err(); err != nil {
+		return &CanceledError{Op: "DeleteBucket", Bucket: name, Err: err}
+	}
+	if o.forceDelete {
+		emptier, ok := s3Client.(bucketEmptierAPI)
+		if !ok {
+			return fmt.Errorf("force delete of bucket %s: client cannot list and delete objects", name)
+		}
+		if err := emptyBucket(ctx, emptier, name, o); err != nil {
+			o.logger.Error("Failed to empty S3 bucket", "bucket", name, "error", err)
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return &CanceledError{Op: "DeleteBucket", Bucket: name, Err: ctxErr, LastErr: err}
+			}
+			return err
+		}
+	}
+	attemptCtx, cancel := withTimeout(ctx, o.clock, attemptTimeout)
+	defer cancel()
+	output, err := s3Client.DeleteBucket(attemptCtx, &s3.DeleteBucketInput{
 		Bucket: aws.String(name),
 	})
 	if err != nil {
-		slog.Error("Failed to delete S3 bucket", "bucket", name, "error", err)
+		o.logger.Error("Failed to delete S3 bucket", "bucket", name, "error", err)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return &CanceledError{Op: "DeleteBucket", Bucket: name, Attempt: 1, Err: ctxErr, LastErr: err}
+		}
 		return err
 	}
-	slog.Info("S3 bucket deleted successfully", "bucket", name, "output", output.ResultMetadata)
+	// A mocked client may succeed without an output.
+	args := []any{"bucket", name}
+	if output != nil {
+		args = append(args, "output", output.ResultMetadata)
+	}
+	o.logger.Info("S3 bucket deleted successfully", args...)
 	return nil
 }
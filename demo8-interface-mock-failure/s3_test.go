@@ -3,13 +3,14 @@ package s3
 import (
 	"context"
 	"errors"
-	"io"
-	"log/slog"
-	"os"
-	"strings"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/golangbot/testkit/logtest"
 )
 
 type mockS3Client struct {
@@ -27,6 +28,10 @@ func (m mockS3Client) CreateBucket(ctx context.Context,
 }
 
 func (m mockS3Client) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	// The bucket only exists once CreateBucket has succeeded
+	if m.callCount["CreateBucket"] <= 2 {
+		return nil, &types.NotFound{}
+	}
 	return &s3.HeadBucketOutput{}, nil
 }
 
@@ -41,15 +46,218 @@ func Test_createS3BucketSuccessfulRetry(t *testing.T) {
 	bucketName := "gopherconuk-2025-my-new-bucket"
 	region := "eu-west-2"
 	wantErr := false
-	var testLogs strings.Builder
-	w := io.MultiWriter(os.Stdout, &testLogs)
-	h := slog.NewTextHandler(w, nil)
-	slog.SetDefault(slog.New(h))
+	logger, logs := logtest.New()
 	defer deleteBucket(mockS3Client, bucketName, region)
-	if err := createS3Bucket(mockS3Client, bucketName, region); (err != nil) != wantErr {
+	if err := createS3Bucket(mockS3Client, bucketName, region, WithLogger(logger)); (err != nil) != wantErr {
 		t.Errorf("createS3Bucket() error = %v, wantErr %v", err, wantErr)
 	}
-	if !strings.Contains(testLogs.String(), "Failed to create S3 bucket") {
-		t.Errorf("Expected s3 bucket failure but did not find it in logs")
+	if failures := logs.Find("Failed to create S3 bucket"); len(failures) == 0 {
+		t.Errorf("Expected s3 bucket failure but did not find it in logs:\n%s", logs.Messages())
+	} else if got := failures[0]; got.String("bucket") != bucketName || got.Int("attempt") != 1 || got.Err("error") == nil {
+		t.Errorf("first failure logged bucket=%q attempt=%d error=%v, want bucket=%q attempt=1 and an error",
+			got.String("bucket"), got.Int("attempt"), got.Err("error"), bucketName)
+	}
+}
+
+type cancellingS3Client struct {
+	mockS3Client
+	cancel context.CancelFunc
+}
+
+func (m cancellingS3Client) CreateBucket(ctx context.Context,
+	params *s3.CreateBucketInput,
+	optFns ...func(*s3.Options)) (*s3.CreateBucketOutput, error) {
+	m.callCount["CreateBucket"] = m.callCount["CreateBucket"] + 1
+	m.cancel()
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func Test_createS3BucketWithContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mockS3Client := cancellingS3Client{
+		mockS3Client: mockS3Client{callCount: make(map[string]int)},
+		cancel:       cancel,
+	}
+	bucketName := "gopherconuk-2025-my-new-bucket"
+	region := "eu-west-2"
+
+	err := createS3BucketWithContext(ctx, mockS3Client, bucketName, region)
+	var canceledErr *CanceledError
+	if !errors.As(err, &canceledErr) {
+		t.Fatalf("createS3BucketWithContext() error = %v, want *CanceledError", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("createS3BucketWithContext() error = %v, want context.Canceled", err)
+	}
+	if got := mockS3Client.callCount["CreateBucket"]; got != 1 {
+		t.Errorf("CreateBucket called %d times, want 1", got)
+	}
+}
+
+func Test_createS3BucketWithContextDeadline(t *testing.T) {
+	mockS3Client := mockS3Client{
+		callCount: make(map[string]int),
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	err := createS3BucketWithContext(ctx, mockS3Client, "gopherconuk-2025-my-new-bucket", "eu-west-2")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("createS3BucketWithContext() error = %v, want context.DeadlineExceeded", err)
+	}
+	if got := mockS3Client.callCount["CreateBucket"]; got != 0 {
+		t.Errorf("CreateBucket called %d times, want 0", got)
+	}
+}
+
+func Test_deleteBucketWithContextCancelled(t *testing.T) {
+	mockS3Client := mockS3Client{
+		callCount: make(map[string]int),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := deleteBucketWithContext(ctx, mockS3Client, "gopherconuk-2025-my-new-bucket", "eu-west-2")
+	var canceledErr *CanceledError
+	if !errors.As(err, &canceledErr) || canceledErr.Op != "DeleteBucket" {
+		t.Errorf("deleteBucketWithContext() error = %v, want *CanceledError for DeleteBucket", err)
+	}
+}
+
+func Test_deleteBucketLogsResultMetadata(t *testing.T) {
+	mockS3Client := mockS3Client{
+		callCount: make(map[string]int),
+	}
+	logger, logs := logtest.New()
+	if err := deleteBucket(mockS3Client, "gopherconuk-2025-my-new-bucket", "eu-west-2", WithLogger(logger)); err != nil {
+		t.Fatalf("deleteBucket() error = %v", err)
+	}
+	deleted := logs.Find("S3 bucket deleted successfully")
+	if len(deleted) != 1 {
+		t.Fatalf("logged %d deletions, want 1:\n%s", len(deleted), logs.Messages())
+	}
+	if _, ok := deleted[0].Value("output"); !ok {
+		t.Errorf("deletion log has no output attribute, want the DeleteBucket result metadata")
+	}
+}
+
+func Test_createS3BucketBackoffSchedule(t *testing.T) {
+	mockS3Client := mockS3Client{
+		callCount: make(map[string]int),
+	}
+	logger, logs := logtest.New()
+
+	err := createS3Bucket(mockS3Client, "gopherconuk-2025-my-new-bucket", "eu-west-2", WithLogger(logger),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 5, Backoff: ExponentialBackoff{Base: 10 * time.Millisecond}}))
+	if err != nil {
+		t.Fatalf("createS3Bucket() error = %v", err)
+	}
+	var delays []time.Duration
+	for _, r := range logs.Find("Retrying S3 request") {
+		delays = append(delays, r.Duration("delay"))
+	}
+	want := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond}
+	if !slices.Equal(delays, want) {
+		t.Errorf("backoff delays = %v, want %v", delays, want)
+	}
+	if got := mockS3Client.callCount["CreateBucket"]; got != 3 {
+		t.Errorf("CreateBucket called %d times, want 3", got)
+	}
+}
+
+func Test_createS3BucketMaxElapsed(t *testing.T) {
+	mockS3Client := mockS3Client{
+		callCount: make(map[string]int),
+	}
+	err := createS3Bucket(mockS3Client, "gopherconuk-2025-my-new-bucket", "eu-west-2",
+		WithRetryPolicy(RetryPolicy{
+			MaxAttempts: 5,
+			MaxElapsed:  50 * time.Millisecond,
+			Backoff:     ConstantBackoff{Interval: 40 * time.Millisecond},
+		}))
+	if err == nil {
+		t.Fatalf("createS3Bucket() error = nil, want the last CreateBucket error")
+	}
+	if got := mockS3Client.callCount["CreateBucket"]; got != 2 {
+		t.Errorf("CreateBucket called %d times, want 2", got)
+	}
+}
+
+type erroringS3Client struct {
+	mockS3Client
+	err    error
+	exists bool
+}
+
+func (m erroringS3Client) CreateBucket(ctx context.Context,
+	params *s3.CreateBucketInput,
+	optFns ...func(*s3.Options)) (*s3.CreateBucketOutput, error) {
+	m.callCount["CreateBucket"] = m.callCount["CreateBucket"] + 1
+	return nil, m.err
+}
+
+func (m erroringS3Client) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	if !m.exists {
+		return nil, &types.NotFound{}
+	}
+	return &s3.HeadBucketOutput{}, nil
+}
+
+func Test_createS3BucketClassifiedErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		exists    bool
+		opts      []Option
+		wantErr   bool
+		wantCalls int
+	}{
+		{
+			name:      "terminal error is not retried",
+			err:       &types.BucketAlreadyExists{},
+			wantErr:   true,
+			wantCalls: 1,
+		},
+		{
+			name:      "bucket already owned by you counts as created",
+			err:       &types.BucketAlreadyOwnedByYou{},
+			exists:    true,
+			wantErr:   false,
+			wantCalls: 1,
+		},
+		{
+			name:      "retryable error uses every attempt",
+			err:       &smithy.GenericAPIError{Code: "SlowDown"},
+			wantErr:   true,
+			wantCalls: 3,
+		},
+		{
+			name: "custom rule makes an error terminal",
+			err:  errors.New("mocked error: failed to create bucket"),
+			opts: []Option{WithClassifierRules(func(error) (ErrorClass, bool) {
+				return Terminal, true
+			})},
+			wantErr:   true,
+			wantCalls: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockS3Client := erroringS3Client{
+				mockS3Client: mockS3Client{callCount: make(map[string]int)},
+				err:          tt.err,
+				exists:       tt.exists,
+			}
+			opts := append([]Option{WithRetryPolicy(RetryPolicy{MaxAttempts: 3})}, tt.opts...)
+			err := createS3Bucket(mockS3Client, "gopherconuk-2025-my-new-bucket", "eu-west-2", opts...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("createS3Bucket() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := mockS3Client.callCount["CreateBucket"]; got != tt.wantCalls {
+				t.Errorf("CreateBucket called %d times, want %d", got, tt.wantCalls)
+			}
+		})
 	}
 }
@@ -0,0 +1,87 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Default time limits for the phases of createS3Bucket. Each CreateBucket
+// call gets defaultCreateTimeout and each wait for the bucket to appear gets
+// defaultWaitTimeout; the operation as a whole is only bounded by the
+// caller's context unless WithOperationTimeout is used.
+const (
+	defaultCreateTimeout = 5 * time.Second
+	defaultWaitTimeout   = time.Minute
+)
+
+// Defaults for the delay between HeadBucket calls while waiting for a new
+// bucket, the same as s3.BucketExistsWaiter's.
+const (
+	defaultWaiterMinDelay = 5 * time.Second
+	defaultWaiterMaxDelay = 120 * time.Second
+)
+
+// PhaseOperation is the phase a *TimeoutError reports when
+// WithOperationTimeout ran out.
+const PhaseOperation = "Operation"
+
+// WithCreateTimeout bounds each CreateBucket call, and the HeadBucket check
+// before a repeated one, replacing the default of five seconds. Zero removes
+// the limit, leaving the call bounded only by the retry loop's context.
+func WithCreateTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.createTimeout = d
+	}
+}
+
+// WithWaitTimeout bounds each wait for a newly created bucket to exist,
+// replacing the default of a minute. Zero removes the limit, so the wait
+// lasts as long as the retry loop's context allows.
+func WithWaitTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.waitTimeout = d
+	}
+}
+
+// WithOperationTimeout bounds the whole of createS3Bucket, all attempts and
+// backoff included. When it runs out the error is a *TimeoutError for
+// PhaseOperation wrapping the *CanceledError from the retry loop. Zero, the
+// default, means no limit beyond the caller's context.
+func WithOperationTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.operationTimeout = d
+	}
+}
+
+// WithWaiterOptions adjusts how the wait for a new bucket polls, using the
+// SDK's own options type. MinDelay, MaxDelay, Retryable, ClientOptions and
+// APIOptions are honoured; the wait runs on the call's Clock rather than
+// inside s3.BucketExistsWaiter, so LogWaitAttempts is not.
+func WithWaiterOptions(optFns ...func(*s3.BucketExistsWaiterOptions)) Option {
+	return func(o *options) {
+		o.waiterOptions = append(o.waiterOptions, optFns...)
+	}
+}
+
+// WithWaiterDelay sets the shortest and longest delay between HeadBucket
+// calls while waiting for a new bucket. The delay starts at minDelay and
+// doubles up to maxDelay.
+func WithWaiterDelay(minDelay, maxDelay time.Duration) Option {
+	return WithWaiterOptions(func(wo *s3.BucketExistsWaiterOptions) {
+		wo.MinDelay = minDelay
+		wo.MaxDelay = maxDelay
+	})
+}
+
+// phaseTimeout returns err as a *TimeoutError for phase if it failed
+// because phaseCtx ran out of time, rather than because ctx, its parent,
+// was done.
+func phaseTimeout(ctx, phaseCtx context.Context, err error, bucket, phase string, timeout time.Duration) error {
+	if err == nil || ctx.Err() != nil || !errors.Is(phaseCtx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	return &TimeoutError{Bucket: bucket, Phase: phase, Timeout: timeout, Err: err}
+}
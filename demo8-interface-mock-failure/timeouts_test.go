@@ -0,0 +1,127 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/golangbot/testkit/clocktest"
+)
+
+// neverExistsS3Client creates buckets that never show up.
+type neverExistsS3Client struct {
+	slowHeadS3Client
+}
+
+func (m neverExistsS3Client) CreateBucket(ctx context.Context,
+	params *s3.CreateBucketInput,
+	optFns ...func(*s3.Options)) (*s3.CreateBucketOutput, error) {
+	return &s3.CreateBucketOutput{}, nil
+}
+
+func Test_createS3BucketWaitTimeout(t *testing.T) {
+	clock := clocktest.New(time.Now())
+	calls := 0
+	client := neverExistsS3Client{slowHeadS3Client{calls: &calls, misses: 1000}}
+	done := make(chan error, 1)
+	go func() {
+		done <- createS3BucketWithContext(context.Background(), client, "gopherconuk-2025-my-new-bucket", "eu-west-2",
+			WithClock(clock),
+			WithRetryPolicy(RetryPolicy{MaxAttempts: 1}),
+			WithWaitTimeout(30*time.Second),
+			WithWaiterDelay(time.Second, 4*time.Second))
+	}()
+
+	// The delay doubles from 1s and stays at 4s, reaching 27s after eight
+	// sleeps; the ninth is cut short when the wait times out at 30s.
+	for _, d := range []time.Duration{1, 2, 4, 4, 4, 4, 4, 4, 3} {
+		clock.BlockUntil(2)
+		clock.Advance(d * time.Second)
+	}
+	err := <-done
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Phase != PhaseWait || timeoutErr.Timeout != 30*time.Second {
+		t.Fatalf("createS3BucketWithContext() error = %v, want a 30s BucketExistsWaiter *TimeoutError", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("createS3BucketWithContext() error = %v, want it to match context.DeadlineExceeded", err)
+	}
+	if calls != 9 {
+		t.Errorf("HeadBucket called %d times, want 9", calls)
+	}
+}
+
+func Test_createS3BucketZeroTimeouts(t *testing.T) {
+	clock := clocktest.New(time.Now())
+	calls := 0
+	client := neverExistsS3Client{slowHeadS3Client{calls: &calls, misses: 2}}
+	done := make(chan error, 1)
+	go func() {
+		done <- createS3BucketWithContext(context.Background(), client, "gopherconuk-2025-my-new-bucket", "eu-west-2",
+			WithClock(clock),
+			WithRetryPolicy(RetryPolicy{MaxAttempts: 1}),
+			WithCreateTimeout(0),
+			WithWaitTimeout(0),
+			WithWaiterDelay(time.Minute, time.Hour))
+	}()
+
+	// Zero means no limit, so the only timer while waiting is the sleep
+	// between HeadBucket calls, and the wait outlasts both defaults.
+	for range 2 {
+		clock.BlockUntil(1)
+		clock.Advance(time.Hour)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("createS3BucketWithContext() error = %v, want zero timeouts to mean no limit", err)
+	}
+	if calls != 3 {
+		t.Errorf("HeadBucket called %d times, want 3", calls)
+	}
+}
+
+func Test_createS3BucketOperationTimeout(t *testing.T) {
+	clock := clocktest.New(time.Now())
+	mockS3Client := hangingS3Client{
+		mockS3Client: mockS3Client{callCount: make(map[string]int)},
+		entered:      make(chan struct{}),
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- createS3BucketWithContext(context.Background(), mockS3Client, "gopherconuk-2025-my-new-bucket", "eu-west-2",
+			WithClock(clock),
+			WithRetryPolicy(RetryPolicy{MaxAttempts: 5, Backoff: ConstantBackoff{Interval: time.Second}}),
+			WithCreateTimeout(5*time.Second),
+			WithOperationTimeout(8*time.Second))
+	}()
+
+	// The first attempt times out at 5s and the second starts at 6s, two
+	// seconds before the operation runs out.
+	<-mockS3Client.entered
+	clock.Advance(5 * time.Second)
+	clock.BlockUntil(2)
+	clock.Advance(time.Second)
+	<-mockS3Client.entered
+	clock.Advance(2 * time.Second)
+
+	err := <-done
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Phase != PhaseOperation || timeoutErr.Timeout != 8*time.Second {
+		t.Fatalf("createS3BucketWithContext() error = %v, want an 8s Operation *TimeoutError", err)
+	}
+	var canceled *CanceledError
+	if !errors.As(err, &canceled) || canceled.Attempt != 2 {
+		t.Errorf("createS3BucketWithContext() error = %v, want it to wrap a *CanceledError after 2 attempts", err)
+	}
+}
+
+func Test_createS3BucketBadWaiterDelay(t *testing.T) {
+	client := neverExistsS3Client{slowHeadS3Client{calls: new(int)}}
+	err := createS3BucketWithContext(context.Background(), client, "gopherconuk-2025-my-new-bucket", "eu-west-2",
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 1}),
+		WithWaiterDelay(time.Minute, time.Second))
+	if err == nil {
+		t.Fatalf("createS3BucketWithContext() error = nil, want an error for a min delay above the max")
+	}
+}
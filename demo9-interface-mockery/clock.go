@@ -0,0 +1,97 @@
+package s3
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock is the time source for the retry loop, per-attempt timeouts and the
+// wait for a new bucket to exist. Tests swap in a fake with WithClock so
+// backoff and timeouts can be checked without waiting for them.
+type Clock interface {
+	Now() time.Time
+	// AfterFunc calls f once d has passed. stop cancels the call and
+	// reports whether it did so before f ran, like time.Timer.Stop.
+	AfterFunc(d time.Duration, f func()) (stop func() bool)
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) AfterFunc(d time.Duration, f func()) func() bool {
+	return time.AfterFunc(d, f).Stop
+}
+
+// WithClock runs the call's backoff, timeouts and bucket wait on clock
+// instead of the system clock.
+func WithClock(clock Clock) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// sleep waits for d on clock or until ctx is done, whichever comes first.
+func sleep(ctx context.Context, clock Clock, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	done := make(chan struct{})
+	stop := clock.AfterFunc(d, func() { close(done) })
+	defer stop()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// withTimeout is context.WithTimeout measured on clock. Only the system
+// clock gets a plain context.WithTimeout, whose deadline reaches the SDK and
+// the network stack; any other clock's timeout is enforced through Done
+// alone.
+func withTimeout(ctx context.Context, clock Clock, d time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := clock.(realClock); ok {
+		return context.WithTimeout(ctx, d)
+	}
+	c := &timeoutContext{Context: ctx, done: make(chan struct{})}
+	stopTimer := clock.AfterFunc(d, func() { c.cancel(context.DeadlineExceeded) })
+	stopParent := context.AfterFunc(ctx, func() { c.cancel(ctx.Err()) })
+	return c, func() {
+		stopTimer()
+		stopParent()
+		c.cancel(context.Canceled)
+	}
+}
+
+// timeoutContext is a context whose deadline is on a Clock other than the
+// system clock. It has its own Done channel, so contexts derived from it
+// learn of the cancellation through Done and see its Err. Deadline is the
+// parent's: net.Dialer and the SDK read a deadline as wall-clock time, and
+// a fake clock's time may be long past.
+type timeoutContext struct {
+	context.Context
+	done chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+func (c *timeoutContext) Done() <-chan struct{} { return c.done }
+
+func (c *timeoutContext) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *timeoutContext) cancel(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = err
+		close(c.done)
+	}
+}
@@ -0,0 +1,203 @@
+package s3
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Phases of a CreateBucket attempt, reported in RetryEvent.Phase. Other
+// operations report their op name as the phase.
+const (
+	PhaseHeadBucket   = "HeadBucket"
+	PhaseCreateBucket = "CreateBucket"
+	PhaseWait         = "BucketExistsWaiter"
+)
+
+// GiveUpReason says why retry stopped without succeeding.
+type GiveUpReason int
+
+const (
+	// GiveUpTerminal means the classifier said the error is not worth
+	// retrying.
+	GiveUpTerminal GiveUpReason = iota
+	// GiveUpAttempts means RetryPolicy.MaxAttempts were all used.
+	GiveUpAttempts
+	// GiveUpElapsed means the next delay would exceed RetryPolicy.MaxElapsed.
+	GiveUpElapsed
+	// GiveUpCanceled means the caller's context was done.
+	GiveUpCanceled
+)
+
+func (r GiveUpReason) String() string {
+	switch r {
+	case GiveUpTerminal:
+		return "terminal"
+	case GiveUpAttempts:
+		return "attempts"
+	case GiveUpElapsed:
+		return "elapsed"
+	case GiveUpCanceled:
+		return "canceled"
+	}
+	return "unknown"
+}
+
+// RetryEvent describes one step of the retry loop. Attempts are numbered
+// from 1 and Elapsed is measured from the start of the first one.
+type RetryEvent struct {
+	Op      string
+	Bucket  string
+	Attempt int
+	// Phase is the part of the attempt that produced Err, such as
+	// PhaseCreateBucket or PhaseWait.
+	Phase string
+	Err   error
+	Class ErrorClass
+	// Delay is the wait before the next attempt. It is only set for
+	// OnRetry, and for OnGiveUp with GiveUpElapsed.
+	Delay   time.Duration
+	Elapsed time.Duration
+	// WireAttempts is the number of requests sent so far, SDK retries
+	// included, which can differ from Attempt: see SDKRetries. It is zero
+	// for clients whose requests cannot be counted, such as mocks.
+	WireAttempts int
+	// Reason is only set for OnGiveUp.
+	Reason GiveUpReason
+}
+
+// RetryObserver is told about the retry loop as it runs, so tests, metrics
+// and tracing can follow it without parsing logs. Calls are made
+// synchronously from the goroutine running the operation.
+type RetryObserver interface {
+	// OnAttempt is called after every attempt, with a nil Err if it
+	// succeeded.
+	OnAttempt(RetryEvent)
+	// OnRetry is called before waiting Delay for attempt number Attempt.
+	// Err is the error that made the previous attempt fail.
+	OnRetry(RetryEvent)
+	// OnGiveUp is called when the operation fails, with the error it
+	// returns and the number of attempts made.
+	OnGiveUp(RetryEvent)
+}
+
+// RetryObserverFuncs is a RetryObserver made of optional functions.
+type RetryObserverFuncs struct {
+	Attempt func(RetryEvent)
+	Retry   func(RetryEvent)
+	GiveUp  func(RetryEvent)
+}
+
+func (f RetryObserverFuncs) OnAttempt(e RetryEvent) {
+	if f.Attempt != nil {
+		f.Attempt(e)
+	}
+}
+
+func (f RetryObserverFuncs) OnRetry(e RetryEvent) {
+	if f.Retry != nil {
+		f.Retry(e)
+	}
+}
+
+func (f RetryObserverFuncs) OnGiveUp(e RetryEvent) {
+	if f.GiveUp != nil {
+		f.GiveUp(e)
+	}
+}
+
+// observers fans events out to each observer in turn.
+type observers []RetryObserver
+
+func (obs observers) OnAttempt(e RetryEvent) {
+	for _, o := range obs {
+		o.OnAttempt(e)
+	}
+}
+
+func (obs observers) OnRetry(e RetryEvent) {
+	for _, o := range obs {
+		o.OnRetry(e)
+	}
+}
+
+func (obs observers) OnGiveUp(e RetryEvent) {
+	for _, o := range obs {
+		o.OnGiveUp(e)
+	}
+}
+
+// attemptFailureMessages are the log messages for a failed attempt, by
+// phase.
+var attemptFailureMessages = map[string]string{
+	PhaseHeadBucket:   "Failed to check for S3 bucket",
+	PhaseCreateBucket: "Failed to create S3 bucket",
+	PhaseWait:         "Failed attempt to wait for bucket to exist",
+}
+
+// logObserver is the RetryObserver that writes the retry loop's log
+// records. It is always installed, ahead of any from WithRetryObserver.
+type logObserver struct {
+	logger *slog.Logger
+}
+
+func (l logObserver) OnAttempt(e RetryEvent) {
+	if e.Err == nil || e.Class == SuccessEquivalent {
+		return
+	}
+	msg, ok := attemptFailureMessages[e.Phase]
+	if !ok {
+		msg = "S3 request attempt failed"
+	}
+	l.logger.Error(msg, wireAttempts(e, "op", e.Op, "bucket", e.Bucket, "attempt", e.Attempt, "error", e.Err, "class", e.Class)...)
+}
+
+func (l logObserver) OnRetry(e RetryEvent) {
+	l.logger.Info("Retrying S3 request", "op", e.Op, "bucket", e.Bucket, "attempt", e.Attempt, "delay", e.Delay)
+}
+
+func (l logObserver) OnGiveUp(e RetryEvent) {
+	switch e.Reason {
+	case GiveUpTerminal:
+		l.logger.Error("Not retrying S3 request", wireAttempts(e, "op", e.Op, "bucket", e.Bucket, "attempt", e.Attempt, "error", e.Err, "class", e.Class)...)
+	case GiveUpElapsed:
+		l.logger.Error("Retry time budget exhausted", wireAttempts(e, "op", e.Op, "bucket", e.Bucket, "attempt", e.Attempt, "elapsed", e.Elapsed, "delay", e.Delay)...)
+	case GiveUpCanceled:
+		l.logger.Error("Stopped retrying S3 request", wireAttempts(e, "op", e.Op, "bucket", e.Bucket, "attempt", e.Attempt, "error", e.Err)...)
+	}
+}
+
+// wireAttempts adds e.WireAttempts to a log record's args, when there is a
+// count to report.
+func wireAttempts(e RetryEvent, args ...any) []any {
+	if e.WireAttempts > 0 {
+		args = append(args, "wire_attempts", e.WireAttempts)
+	}
+	return args
+}
+
+// phaseError tags an attempt's error with the phase that produced it. retry
+// strips it off again, so callers never see it.
+type phaseError struct {
+	phase string
+	err   error
+}
+
+func (e *phaseError) Error() string { return e.phase + ": " + e.err.Error() }
+func (e *phaseError) Unwrap() error { return e.err }
+
+// inPhase tags err, if not nil, with phase.
+func inPhase(phase string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &phaseError{phase: phase, err: err}
+}
+
+// splitPhase returns the phase err was tagged with, or op, and the
+// untagged error.
+func splitPhase(op string, err error) (string, error) {
+	if pe, ok := err.(*phaseError); ok {
+		return pe.phase, pe.err
+	}
+	return op, err
+}
@@ -0,0 +1,81 @@
+package s3
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Option configures createS3Bucket and deleteBucket.
+type Option func(*options)
+
+type options struct {
+	retryPolicy RetryPolicy
+	classifier  Classifier
+
+	expectedBucketOwner string
+	bucketTags          map[string]string
+
+	forceDelete       bool
+	deleteConcurrency int
+	deleteProgress    func(DeleteProgress)
+
+	logger    *slog.Logger
+	observers []RetryObserver
+	clock     Clock
+
+	attemptTimeout   time.Duration
+	createTimeout    time.Duration
+	waitTimeout      time.Duration
+	operationTimeout time.Duration
+	waiterOptions    []func(*s3.BucketExistsWaiterOptions)
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		retryPolicy:    DefaultRetryPolicy(),
+		attemptTimeout: attemptTimeout,
+		createTimeout:  defaultCreateTimeout,
+		waitTimeout:    defaultWaitTimeout,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.logger == nil {
+		o.logger = slog.Default()
+	}
+	if o.clock == nil {
+		o.clock = realClock{}
+	}
+	return o
+}
+
+// WithRetryPolicy replaces DefaultRetryPolicy for a single call.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(o *options) {
+		o.retryPolicy = p
+	}
+}
+
+// WithLogger sends the call's log records to logger instead of
+// slog.Default(), so tests can capture them without changing global state.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithRetryObserver adds obs to the observers told about each attempt,
+// retry and give-up. It can be given more than once.
+func WithRetryObserver(obs RetryObserver) Option {
+	return func(o *options) {
+		o.observers = append(o.observers, obs)
+	}
+}
+
+// observer returns the RetryObserver for the call: logging, then any added
+// with WithRetryObserver.
+func (o options) observer() RetryObserver {
+	return append(observers{logObserver{o.logger}}, o.observers...)
+}
@@ -0,0 +1,219 @@
+package s3
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy controls how many times createS3Bucket tries and how long it
+// waits between attempts.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	// Values below 1 mean a single attempt.
+	MaxAttempts int
+	// MaxElapsed caps the time spent across all attempts and backoff. It is
+	// checked before each retry, so an attempt already in flight is not cut
+	// short. Zero means no limit other than the caller's context.
+	MaxElapsed time.Duration
+	// Backoff picks the delay before each retry. A nil Backoff retries
+	// immediately.
+	Backoff Backoff
+	// SDK says how the client's own retryer takes part. By default it
+	// retries within each attempt as it always has; SDKRetriesDisabled
+	// holds it to one attempt per call, so MaxAttempts counts requests.
+	SDK SDKRetries
+}
+
+// DefaultRetryPolicy returns the policy used when no WithRetryPolicy option
+// is given: three attempts with exponential backoff starting at 100ms.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		Backoff: ExponentialBackoff{
+			Base: 100 * time.Millisecond,
+			Max:  2 * time.Second,
+		},
+	}
+}
+
+func (p RetryPolicy) attempts() int {
+	return max(p.MaxAttempts, 1)
+}
+
+func (p RetryPolicy) delay(retry int, prev time.Duration) time.Duration {
+	if p.Backoff == nil {
+		return 0
+	}
+	return max(p.Backoff.Delay(retry, prev), 0)
+}
+
+// exhausted reports whether waiting d more would take the retry loop past
+// MaxElapsed.
+func (p RetryPolicy) exhausted(elapsed, d time.Duration) bool {
+	return p.MaxElapsed > 0 && elapsed+d > p.MaxElapsed
+}
+
+// Backoff computes the delay before a retry.
+type Backoff interface {
+	// Delay returns the wait before retry n, where n is 1 for the first
+	// retry. prev is the delay returned for retry n-1, or zero.
+	Delay(n int, prev time.Duration) time.Duration
+}
+
+// ConstantBackoff waits the same Interval before every retry.
+type ConstantBackoff struct {
+	Interval time.Duration
+}
+
+func (b ConstantBackoff) Delay(int, time.Duration) time.Duration {
+	return b.Interval
+}
+
+// ExponentialBackoff waits Base, then Base*Multiplier, Base*Multiplier^2 and
+// so on, never more than Max. Multiplier defaults to 2 and a zero Max means
+// no cap.
+type ExponentialBackoff struct {
+	Base       time.Duration
+	Max        time.Duration
+	Multiplier float64
+}
+
+func (b ExponentialBackoff) Delay(n int, _ time.Duration) time.Duration {
+	multiplier := b.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	d := float64(b.Base) * math.Pow(multiplier, float64(max(n-1, 0)))
+	if d >= math.MaxInt64 {
+		d = math.MaxInt64
+	}
+	return capDelay(time.Duration(d), b.Max)
+}
+
+// DecorrelatedJitterBackoff implements the "decorrelated jitter" strategy:
+// each delay is drawn uniformly between Base and three times the previous
+// delay, capped at Max. Rand returns a number in [0, 1) and defaults to
+// math/rand/v2.Float64; tests can replace it to get a fixed schedule.
+type DecorrelatedJitterBackoff struct {
+	Base time.Duration
+	Max  time.Duration
+	Rand func() float64
+}
+
+func (b DecorrelatedJitterBackoff) Delay(_ int, prev time.Duration) time.Duration {
+	random := b.Rand
+	if random == nil {
+		random = rand.Float64
+	}
+	prev = max(prev, b.Base)
+	upper := float64(prev) * 3
+	d := float64(b.Base) + random()*(upper-float64(b.Base))
+	if d >= math.MaxInt64 {
+		d = math.MaxInt64
+	}
+	return capDelay(time.Duration(d), b.Max)
+}
+
+func capDelay(d, limit time.Duration) time.Duration {
+	if limit > 0 && d > limit {
+		return limit
+	}
+	return d
+}
+
+// retry calls attempt, numbering attempts from 1, until it succeeds, fails
+// with an error that o.classifier does not consider Retryable, or
+// o.retryPolicy runs out, in which case it returns a *RetryError holding
+// every failed attempt. Each attempt gets its own o.attemptTimeout, if set,
+// derived from ctx, and all waiting is done on o.clock. Once ctx is done no
+// further attempts are made and a *CanceledError is returned. attempt may
+// tag its error with inPhase to say which part of it failed; every step is
+// reported to o.observer(). The SDK calls attempt makes take their options
+// from sdkCallOptions(ctx), which applies policy.SDK and counts the
+// requests actually sent.
+func retry(ctx context.Context, o options, op string, bucket string, attempt func(ctx context.Context, n int) error) error {
+	policy := o.retryPolicy
+	obs := o.observer()
+	budget := &wireBudget{mode: policy.SDK, max: policy.attempts()}
+	ctx = withWireBudget(ctx, budget)
+	start := o.clock.Now()
+	elapsed := func() time.Duration { return o.clock.Now().Sub(start) }
+	event := func(n int, phase string, err error) RetryEvent {
+		return RetryEvent{Op: op, Bucket: bucket, Attempt: n, Phase: phase, Err: err, Elapsed: elapsed(),
+			WireAttempts: budget.count()}
+	}
+	var failures []AttemptError
+	giveUp := func(e RetryEvent, reason GiveUpReason) error {
+		if reason != GiveUpCanceled {
+			e.Err = &RetryError{Op: op, Bucket: bucket, Reason: reason, Attempts: failures,
+				WireAttempts: budget.count()}
+		}
+		e.Reason = reason
+		obs.OnGiveUp(e)
+		return e.Err
+	}
+	var lastErr error
+	lastPhase := op
+	var delay time.Duration
+	for n := range policy.attempts() {
+		if n > 0 {
+			// The SDK may already have used up the requests a shared
+			// budget allows.
+			if budget.exhausted() {
+				return giveUp(event(n, lastPhase, lastErr), GiveUpAttempts)
+			}
+			delay = policy.delay(n, delay)
+			if policy.exhausted(elapsed(), delay) {
+				e := event(n, lastPhase, lastErr)
+				e.Delay = delay
+				return giveUp(e, GiveUpElapsed)
+			}
+			e := event(n+1, lastPhase, lastErr)
+			e.Delay = delay
+			obs.OnRetry(e)
+			if err := sleep(ctx, o.clock, delay); err != nil {
+				cerr := &CanceledError{Op: op, Bucket: bucket, Attempt: n, Err: err, LastErr: lastErr}
+				return giveUp(event(n, lastPhase, cerr), GiveUpCanceled)
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			cerr := &CanceledError{Op: op, Bucket: bucket, Attempt: n, Err: err, LastErr: lastErr}
+			return giveUp(event(n, lastPhase, cerr), GiveUpCanceled)
+		}
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if o.attemptTimeout > 0 {
+			attemptCtx, cancel = withTimeout(ctx, o.clock, o.attemptTimeout)
+		}
+		attemptStart := o.clock.Now()
+		sentBefore := budget.count()
+		lastPhase, lastErr = splitPhase(op, attempt(attemptCtx, n+1))
+		cancel()
+		e := event(n+1, lastPhase, lastErr)
+		if lastErr != nil {
+			e.Class = o.classifier.Classify(lastErr)
+		}
+		obs.OnAttempt(e)
+		if lastErr == nil || e.Class == SuccessEquivalent {
+			return nil
+		}
+		failures = append(failures, AttemptError{
+			Attempt:      n + 1,
+			Phase:        lastPhase,
+			Start:        attemptStart,
+			Duration:     o.clock.Now().Sub(attemptStart),
+			WireAttempts: budget.count() - sentBefore,
+			Err:          lastErr,
+		})
+		if e.Class == Terminal {
+			return giveUp(e, GiveUpTerminal)
+		}
+		if err := ctx.Err(); err != nil {
+			cerr := &CanceledError{Op: op, Bucket: bucket, Attempt: n + 1, Err: err, LastErr: lastErr}
+			e.Err = cerr
+			return giveUp(e, GiveUpCanceled)
+		}
+	}
+	return giveUp(event(policy.attempts(), lastPhase, lastErr), GiveUpAttempts)
+}
@@ -2,15 +2,13 @@ package s3
 
 import (
 	"errors"
-	"io"
-	"log/slog"
-	"os"
 	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/golangbot/testkit/logtest"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -26,7 +24,7 @@ func Test_createS3BucketSuccess(t *testing.T) {
 		CreateBucketConfiguration: &types.CreateBucketConfiguration{
 			LocationConstraint: types.BucketLocationConstraint(region),
 		},
-	}).Return(nil, nil)
+	}, mock.Anything).Return(nil, nil)
 
 	mockS3Client.On("DeleteBucket", mock.Anything, mock.Anything).Return(nil, nil)
 
@@ -40,10 +38,7 @@ func Test_createS3BucketSuccess(t *testing.T) {
 }
 
 func Test_createS3BucketRetrySuccess(t *testing.T) {
-	var testLogs strings.Builder
-	w := io.MultiWriter(os.Stdout, &testLogs)
-	h := slog.NewTextHandler(w, nil)
-	slog.SetDefault(slog.New(h))
+	logger, logs := logtest.New()
 
 	mockS3Client := mocks3Client{}
 	bucketName := "gopherconuk-2025-my-new-bucket"
@@ -56,26 +51,44 @@ func Test_createS3BucketRetrySuccess(t *testing.T) {
 		CreateBucketConfiguration: &types.CreateBucketConfiguration{
 			LocationConstraint: types.BucketLocationConstraint(region),
 		},
-	}).Return(nil, errors.New("mocked error: failed to create bucket")).Twice()
+	}, mock.Anything).Return(nil, errors.New("mocked error: failed to create bucket")).Twice()
 
 	mockS3Client.On("CreateBucket", mock.Anything, &s3.CreateBucketInput{
 		Bucket: aws.String(bucketName),
 		CreateBucketConfiguration: &types.CreateBucketConfiguration{
 			LocationConstraint: types.BucketLocationConstraint(region),
 		},
-	}).Return(nil, nil).Once()
+	}, mock.Anything).Return(nil, nil).Once()
 
 	mockS3Client.On("DeleteBucket", mock.Anything, mock.Anything).Return(nil, nil)
 
+	// Before each retry the bucket is looked up in case the failed attempt went through
+	mockS3Client.On("HeadBucket", mock.Anything, &s3.HeadBucketInput{
+		Bucket: aws.String(bucketName),
+	}, mock.Anything).Return(nil, &types.NotFound{}).Twice()
+
 	mockS3Client.On("HeadBucket", mock.Anything, &s3.HeadBucketInput{
 		Bucket: aws.String(bucketName),
 	}, mock.Anything).Return(&s3.HeadBucketOutput{}, nil)
 
-	if err := createS3Bucket(&mockS3Client, bucketName, region); (err != nil) != wantErr {
+	if err := createS3Bucket(&mockS3Client, bucketName, region, WithLogger(logger)); (err != nil) != wantErr {
 		t.Errorf("createS3Bucket() error = %v, wantErr %v", err, wantErr)
 	}
+	mockS3Client.AssertNumberOfCalls(t, "CreateBucket", 3)
 
-	if !strings.Contains(testLogs.String(), "Failed to create S3 bucket") {
-		t.Errorf("Expected s3 bucket failure but did not find it in logs")
+	failures := logs.Find("Failed to create S3 bucket")
+	if len(failures) != 2 {
+		t.Fatalf("logged %d failed attempts, want 2:\n%s", len(failures), logs.Messages())
+	}
+	for i, r := range failures {
+		if got := r.Int("attempt"); got != i+1 {
+			t.Errorf("failure %d logged attempt %d, want %d", i, got, i+1)
+		}
+		if err := r.Err("error"); err == nil || !strings.Contains(err.Error(), "mocked error") {
+			t.Errorf("failure %d logged error %v, want the mocked error", i, err)
+		}
+		if got := r.String("bucket"); got != bucketName {
+			t.Errorf("failure %d logged bucket %q, want %q", i, got, bucketName)
+		}
 	}
 }
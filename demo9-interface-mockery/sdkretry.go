@@ -0,0 +1,119 @@
+package s3
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsretry "github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// SDKRetries says how the retry loop shares its RetryPolicy with the
+// aws.Retryer of the client it calls, whether that is the standard retryer
+// or the adaptive one. Without coordination the two multiply: three of the
+// loop's attempts around the SDK's default of three is up to nine requests.
+type SDKRetries int
+
+const (
+	// SDKRetriesIndependent leaves the client's retryer alone, so each of
+	// the loop's attempts can be as many requests as the retryer allows. It
+	// is the zero value, so callers that do not set RetryPolicy.SDK keep
+	// the SDK's retries inside each attempt.
+	SDKRetriesIndependent SDKRetries = iota
+	// SDKRetriesDisabled holds the client's retryer to a single attempt per
+	// call, so each of the loop's attempts is exactly one request. The
+	// retryer still gets to delay or refuse that request, as the adaptive
+	// retryer's client-side rate limiting does.
+	SDKRetriesDisabled
+	// SDKRetriesShared lets the client's retryer retry within a call, with
+	// its own backoff and up to its own MaxAttempts, but counts every
+	// request it sends against the policy's MaxAttempts, HeadBucket checks
+	// included. The loop only retries what the SDK gave up on, and stops
+	// once the budget is spent; an attempt it does start still sends its
+	// operation once, even if a HeadBucket check used the last request.
+	SDKRetriesShared
+)
+
+func (m SDKRetries) String() string {
+	switch m {
+	case SDKRetriesIndependent:
+		return "independent"
+	case SDKRetriesDisabled:
+		return "disabled"
+	case SDKRetriesShared:
+		return "shared"
+	}
+	return "unknown"
+}
+
+// wireBudget counts the requests one retry loop sends and, for
+// SDKRetriesShared, how many the SDK may still send. Requests are counted
+// by a middleware on the client, so clients that are not an *s3.Client,
+// such as mocks, send none as far as it knows.
+type wireBudget struct {
+	mode SDKRetries
+	max  int
+	sent atomic.Int64
+}
+
+type wireBudgetKey struct{}
+
+func withWireBudget(ctx context.Context, b *wireBudget) context.Context {
+	return context.WithValue(ctx, wireBudgetKey{}, b)
+}
+
+// count returns the number of requests sent so far.
+func (b *wireBudget) count() int {
+	return int(b.sent.Load())
+}
+
+// exhausted reports whether SDKRetriesShared has no requests left to give.
+func (b *wireBudget) exhausted() bool {
+	return b.mode == SDKRetriesShared && b.count() >= b.max
+}
+
+// sdkCallOptions returns the per-call client options for a request made by
+// the retry loop running in ctx: the retryer its RetryPolicy.SDK asks for,
+// and the middleware that counts what goes on the wire. Outside a retry
+// loop there are none.
+func sdkCallOptions(ctx context.Context) []func(*s3.Options) {
+	b, ok := ctx.Value(wireBudgetKey{}).(*wireBudget)
+	if !ok {
+		return nil
+	}
+	return []func(*s3.Options){func(o *s3.Options) {
+		switch b.mode {
+		case SDKRetriesDisabled:
+			o.Retryer = awsretry.AddWithMaxAttempts(clientRetryer(o), 1)
+		case SDKRetriesShared:
+			r := clientRetryer(o)
+			attempts := max(b.max-b.count(), 1)
+			if n := r.MaxAttempts(); n > 0 {
+				attempts = min(attempts, n)
+			}
+			o.Retryer = awsretry.AddWithMaxAttempts(r, attempts)
+		}
+		o.APIOptions = append(o.APIOptions, b.addCounter)
+	}}
+}
+
+// clientRetryer returns the client's retryer, or the SDK's default if it
+// has none yet.
+func clientRetryer(o *s3.Options) aws.Retryer {
+	if o.Retryer == nil {
+		return awsretry.NewStandard()
+	}
+	return o.Retryer
+}
+
+// addCounter counts requests at the end of the Finalize step, after the
+// SDK's retry middleware, where it runs once per attempt.
+func (b *wireBudget) addCounter(stack *middleware.Stack) error {
+	return stack.Finalize.Add(middleware.FinalizeMiddlewareFunc("s3.CountWireAttempts",
+		func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+			b.sent.Add(1)
+			return next.HandleFinalize(ctx, in)
+		}), middleware.After)
+}
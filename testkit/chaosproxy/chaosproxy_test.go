@@ -0,0 +1,256 @@
+package chaosproxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	toxiproxy "github.com/Shopify/toxiproxy/client"
+)
+
+// startEcho starts a TCP server that writes back whatever it reads.
+func startEcho(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// newTestProxy starts a Server and creates one proxy in front of an echo
+// server through the toxiproxy client.
+func newTestProxy(t *testing.T) (*toxiproxy.Client, *toxiproxy.Proxy) {
+	t.Helper()
+	srv, err := Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	client := toxiproxy.NewClient(srv.Addr())
+	if _, err := client.Populate([]toxiproxy.Proxy{{
+		Name:     "echo",
+		Listen:   "127.0.0.1:0",
+		Upstream: startEcho(t),
+		Enabled:  true,
+	}}); err != nil {
+		t.Fatalf("Populate() error = %v", err)
+	}
+	// Proxies returned by Populate have no client, so look it up again.
+	proxy, err := client.Proxy("echo")
+	if err != nil {
+		t.Fatalf("Proxy() error = %v", err)
+	}
+	return client, proxy
+}
+
+func dial(t *testing.T, proxy *toxiproxy.Proxy) net.Conn {
+	t.Helper()
+	conn, err := net.DialTimeout("tcp", proxy.Listen, time.Second)
+	if err != nil {
+		t.Fatalf("Failed to dial proxy: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func echo(t *testing.T, conn net.Conn, msg string) string {
+	t.Helper()
+	if _, err := io.WriteString(conn, msg); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	buf := make([]byte, len(msg))
+	n, err := io.ReadFull(conn, buf)
+	if err != nil {
+		t.Fatalf("Read() error = %v after %q", err, buf[:n])
+	}
+	return string(buf)
+}
+
+func TestAPI(t *testing.T) {
+	client, proxy := newTestProxy(t)
+
+	if strings.HasSuffix(proxy.Listen, ":0") {
+		t.Errorf("Listen = %s, want the ephemeral port in use", proxy.Listen)
+	}
+
+	toxic, err := proxy.AddToxic("", "latency", "", 1.0, toxiproxy.Attributes{"latency": 10})
+	if err != nil {
+		t.Fatalf("AddToxic() error = %v", err)
+	}
+	if toxic.Name != "latency_downstream" || toxic.Stream != "downstream" {
+		t.Errorf("AddToxic() = %+v, want name latency_downstream on downstream", toxic)
+	}
+	if _, err := proxy.AddToxic("latency_downstream", "latency", "downstream", 1.0, nil); err == nil {
+		t.Errorf("AddToxic() with a duplicate name succeeded, want a conflict")
+	}
+	if _, err := proxy.AddToxic("", "wormhole", "", 1.0, nil); err == nil {
+		t.Errorf("AddToxic() with an unknown type succeeded, want an error")
+	}
+
+	toxic, err = proxy.UpdateToxic("latency_downstream", -1, toxiproxy.Attributes{"jitter": 5})
+	if err != nil {
+		t.Fatalf("UpdateToxic() error = %v", err)
+	}
+	if toxic.Attributes["latency"] != 10.0 || toxic.Attributes["jitter"] != 5.0 {
+		t.Errorf("UpdateToxic() attributes = %v, want latency 10 and jitter 5", toxic.Attributes)
+	}
+
+	fetched, err := client.Proxy("echo")
+	if err != nil {
+		t.Fatalf("Proxy() error = %v", err)
+	}
+	if len(fetched.ActiveToxics) != 1 || fetched.Listen != proxy.Listen {
+		t.Errorf("Proxy() = %+v, want one toxic on %s", fetched, proxy.Listen)
+	}
+
+	// Populating the same proxy again keeps it, toxics and all.
+	proxies, err := client.Populate([]toxiproxy.Proxy{{Name: "echo", Listen: "127.0.0.1:0", Upstream: fetched.Upstream, Enabled: true}})
+	if err != nil {
+		t.Fatalf("second Populate() error = %v", err)
+	}
+	if proxies[0].Listen != proxy.Listen || len(proxies[0].ActiveToxics) != 1 {
+		t.Errorf("second Populate() = %+v, want the existing proxy", proxies[0])
+	}
+
+	if err := client.ResetState(); err != nil {
+		t.Fatalf("ResetState() error = %v", err)
+	}
+	if toxics, err := proxy.Toxics(); err != nil || len(toxics) != 0 {
+		t.Errorf("Toxics() after reset = %v, %v, want none", toxics, err)
+	}
+	if err := proxy.RemoveToxic("latency_downstream"); err == nil {
+		t.Errorf("RemoveToxic() of a removed toxic succeeded, want not found")
+	}
+
+	if err := fetched.Disable(); err != nil {
+		t.Fatalf("Disable() error = %v", err)
+	}
+	if conn, err := net.Dial("tcp", proxy.Listen); err == nil {
+		conn.Close()
+		t.Errorf("Dial() to a disabled proxy succeeded")
+	}
+	if err := fetched.Enable(); err != nil {
+		t.Fatalf("Enable() error = %v", err)
+	}
+	if got := echo(t, dial(t, proxy), "hello"); got != "hello" {
+		t.Errorf("echo after Enable() = %q, want hello", got)
+	}
+
+	if err := proxy.Delete(); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := client.Proxy("echo"); err == nil {
+		t.Errorf("Proxy() after Delete() succeeded, want not found")
+	}
+}
+
+func TestLatency(t *testing.T) {
+	_, proxy := newTestProxy(t)
+	conn := dial(t, proxy)
+	echo(t, conn, "warm up")
+
+	// The toxic applies to a connection that is already open.
+	if _, err := proxy.AddToxic("latency", "latency", "upstream", 1.0, toxiproxy.Attributes{"latency": 200}); err != nil {
+		t.Fatalf("AddToxic() error = %v", err)
+	}
+	start := time.Now()
+	echo(t, conn, "slow")
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("echo with latency took %v, want at least 200ms", elapsed)
+	}
+
+	if err := proxy.RemoveToxic("latency"); err != nil {
+		t.Fatalf("RemoveToxic() error = %v", err)
+	}
+	start = time.Now()
+	echo(t, conn, "fast")
+	if elapsed := time.Since(start); elapsed >= 200*time.Millisecond {
+		t.Errorf("echo after removing latency took %v, want under 200ms", elapsed)
+	}
+}
+
+func TestBandwidthAndSlicer(t *testing.T) {
+	_, proxy := newTestProxy(t)
+	if _, err := proxy.AddToxic("", "slicer", "downstream", 1.0, toxiproxy.Attributes{
+		"average_size": 10, "size_variation": 5, "delay": 100,
+	}); err != nil {
+		t.Fatalf("AddToxic(slicer) error = %v", err)
+	}
+	// 10 KB/s, so 2 KB takes about 200ms.
+	if _, err := proxy.AddToxic("", "bandwidth", "upstream", 1.0, toxiproxy.Attributes{"rate": 10}); err != nil {
+		t.Fatalf("AddToxic(bandwidth) error = %v", err)
+	}
+	msg := strings.Repeat("gopher!\n", 256)
+	start := time.Now()
+	if got := echo(t, dial(t, proxy), msg); got != msg {
+		t.Errorf("echo through slicer changed the data")
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("echo at 10 KB/s took %v, want about 200ms", elapsed)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	_, proxy := newTestProxy(t)
+	if _, err := proxy.AddToxic("", "timeout", "upstream", 1.0, toxiproxy.Attributes{"timeout": 100}); err != nil {
+		t.Fatalf("AddToxic() error = %v", err)
+	}
+	conn := dial(t, proxy)
+	io.WriteString(conn, "hello")
+	start := time.Now()
+	n, err := conn.Read(make([]byte, 5))
+	if n != 0 || err == nil {
+		t.Errorf("Read() = %d, %v, want the connection closed with no data", n, err)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("connection closed after %v, want about 100ms", elapsed)
+	}
+}
+
+func TestResetPeer(t *testing.T) {
+	_, proxy := newTestProxy(t)
+	if _, err := proxy.AddToxic("", "reset_peer", "upstream", 1.0, nil); err != nil {
+		t.Fatalf("AddToxic() error = %v", err)
+	}
+	conn := dial(t, proxy)
+	io.WriteString(conn, "hello")
+	if _, err := conn.Read(make([]byte, 5)); !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("Read() error = %v, want ECONNRESET", err)
+	}
+}
+
+func TestLimitData(t *testing.T) {
+	_, proxy := newTestProxy(t)
+	if _, err := proxy.AddToxic("", "limit_data", "downstream", 1.0, toxiproxy.Attributes{"bytes": 4}); err != nil {
+		t.Fatalf("AddToxic() error = %v", err)
+	}
+	conn := dial(t, proxy)
+	io.WriteString(conn, "hello, gophers")
+	got, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if !bytes.Equal(got, []byte("hell")) {
+		t.Errorf("read %q, want the first 4 bytes", got)
+	}
+}
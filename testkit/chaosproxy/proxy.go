@@ -0,0 +1,321 @@
+package chaosproxy
+
+import (
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// dialTimeout bounds the connection to the upstream for each client.
+const dialTimeout = 5 * time.Second
+
+// proxyConfig is a proxy as sent to the API. Enabled is a pointer so that
+// a request that leaves it out gets Toxiproxy's default of true.
+type proxyConfig struct {
+	Name     string `json:"name"`
+	Listen   string `json:"listen"`
+	Upstream string `json:"upstream"`
+	Enabled  *bool  `json:"enabled"`
+}
+
+func (c proxyConfig) enabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
+// proxyState is a proxy as reported by the API.
+type proxyState struct {
+	Name     string   `json:"name"`
+	Listen   string   `json:"listen"`
+	Upstream string   `json:"upstream"`
+	Enabled  bool     `json:"enabled"`
+	Toxics   []*toxic `json:"toxics"`
+}
+
+// proxy forwards connections from its listener to upstream, passing the
+// bytes through whatever toxics are active at the time.
+type proxy struct {
+	name string
+	// listen is the address asked for, which may have port 0; addr is the
+	// address in use once the proxy has been enabled.
+	listen   string
+	addr     string
+	upstream string
+
+	mu       sync.Mutex
+	enabled  bool
+	toxics   []*toxic
+	listener net.Listener
+	conns    map[*connection]struct{}
+}
+
+func newProxy(config proxyConfig) *proxy {
+	return &proxy{
+		name:     config.Name,
+		listen:   config.Listen,
+		upstream: config.Upstream,
+		conns:    make(map[*connection]struct{}),
+	}
+}
+
+func (p *proxy) state() proxyState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	state := proxyState{
+		Name:     p.name,
+		Listen:   p.listenAddr(),
+		Upstream: p.upstream,
+		Enabled:  p.enabled,
+		Toxics:   []*toxic{},
+	}
+	for _, t := range p.toxics {
+		state.Toxics = append(state.Toxics, t.clone())
+	}
+	return state
+}
+
+// listenAddr must be called with p.mu held.
+func (p *proxy) listenAddr() string {
+	if p.addr != "" {
+		return p.addr
+	}
+	return p.listen
+}
+
+// matches reports whether config describes this proxy as it already is.
+func (p *proxy) matches(config proxyConfig) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return config.Upstream == p.upstream && (config.Listen == p.listen || config.Listen == p.addr)
+}
+
+func (p *proxy) update(config proxyConfig) error {
+	p.mu.Lock()
+	changed := false
+	if config.Upstream != "" && config.Upstream != p.upstream {
+		p.upstream = config.Upstream
+		changed = true
+	}
+	if config.Listen != "" && config.Listen != p.listen && config.Listen != p.addr {
+		p.listen, p.addr = config.Listen, ""
+		changed = true
+	}
+	wasEnabled := p.enabled
+	p.mu.Unlock()
+	if changed && wasEnabled {
+		p.stop()
+	}
+	return p.setEnabled(config.enabled())
+}
+
+// setEnabled starts or stops the listener. Disabling drops every open
+// connection. The port chosen the first time is kept, so a proxy on an
+// ephemeral port comes back on the same one.
+func (p *proxy) setEnabled(enabled bool) error {
+	if !enabled {
+		p.stop()
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.enabled {
+		return nil
+	}
+	l, err := net.Listen("tcp", p.listenAddr())
+	if err != nil {
+		return newAPIError(http.StatusInternalServerError, "listen on %s: %v", p.listenAddr(), err)
+	}
+	p.listener = l
+	p.addr = l.Addr().String()
+	p.enabled = true
+	go p.accept(l)
+	return nil
+}
+
+// stop closes the listener and every connection through the proxy.
+func (p *proxy) stop() {
+	p.mu.Lock()
+	l := p.listener
+	conns := make([]*connection, 0, len(p.conns))
+	for c := range p.conns {
+		conns = append(conns, c)
+	}
+	p.listener = nil
+	p.enabled = false
+	p.mu.Unlock()
+	if l != nil {
+		l.Close()
+	}
+	for _, c := range conns {
+		c.close(false)
+	}
+}
+
+func (p *proxy) accept(l net.Listener) {
+	for {
+		client, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go p.serve(client)
+	}
+}
+
+func (p *proxy) serve(client net.Conn) {
+	p.mu.Lock()
+	upstreamAddr := p.upstream
+	p.mu.Unlock()
+	upstream, err := net.DialTimeout("tcp", upstreamAddr, dialTimeout)
+	if err != nil {
+		client.Close()
+		return
+	}
+	c := &connection{proxy: p, client: client, upstream: upstream, done: make(chan struct{})}
+	p.mu.Lock()
+	if !p.enabled {
+		p.mu.Unlock()
+		c.close(false)
+		return
+	}
+	p.conns[c] = struct{}{}
+	p.mu.Unlock()
+
+	go c.pipe(streamUpstream, client, upstream)
+	go c.pipe(streamDownstream, upstream, client)
+	<-c.done
+	p.mu.Lock()
+	delete(p.conns, c)
+	p.mu.Unlock()
+}
+
+// activeToxics returns the toxics on stream, in the order they were added.
+func (p *proxy) activeToxics(stream string) []*toxic {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var toxics []*toxic
+	for _, t := range p.toxics {
+		if t.Stream == stream {
+			toxics = append(toxics, t.clone())
+		}
+	}
+	return toxics
+}
+
+func (p *proxy) addToxic(t *toxic) error {
+	if err := t.validate(); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if slices.ContainsFunc(p.toxics, func(other *toxic) bool { return other.Name == t.Name }) {
+		return newAPIError(http.StatusConflict, "toxic already exists")
+	}
+	p.toxics = append(p.toxics, t)
+	return nil
+}
+
+func (p *proxy) toxic(name string) (*toxic, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, t := range p.toxics {
+		if t.Name == name {
+			return t.clone(), nil
+		}
+	}
+	return nil, newAPIError(http.StatusNotFound, "toxic not found")
+}
+
+func (p *proxy) updateToxic(name string, toxicity *float32, attrs map[string]any) (*toxic, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	i := slices.IndexFunc(p.toxics, func(t *toxic) bool { return t.Name == name })
+	if i < 0 {
+		return nil, newAPIError(http.StatusNotFound, "toxic not found")
+	}
+	// Toxics are replaced rather than changed in place, so connections that
+	// took a copy keep a consistent view.
+	t := p.toxics[i].clone()
+	if toxicity != nil {
+		t.Toxicity = *toxicity
+	}
+	for key, value := range attrs {
+		t.Attributes[key] = value
+	}
+	if err := t.validate(); err != nil {
+		return nil, err
+	}
+	p.toxics[i] = t
+	return t.clone(), nil
+}
+
+func (p *proxy) removeToxic(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	i := slices.IndexFunc(p.toxics, func(t *toxic) bool { return t.Name == name })
+	if i < 0 {
+		return newAPIError(http.StatusNotFound, "toxic not found")
+	}
+	p.toxics = slices.Delete(p.toxics, i, i+1)
+	return nil
+}
+
+func (p *proxy) removeToxics() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.toxics = nil
+}
+
+// connection is one client connection and its upstream counterpart.
+type connection struct {
+	proxy    *proxy
+	client   net.Conn
+	upstream net.Conn
+
+	closeOnce sync.Once
+	done      chan struct{}
+	timerOnce sync.Once
+}
+
+// close closes both sides. With reset set the client sees a TCP RST rather
+// than an orderly FIN.
+func (c *connection) close(reset bool) {
+	c.closeOnce.Do(func() {
+		if reset {
+			if tcp, ok := c.client.(*net.TCPConn); ok {
+				tcp.SetLinger(0)
+			}
+		}
+		c.client.Close()
+		c.upstream.Close()
+		close(c.done)
+	})
+}
+
+// closeAfter closes the connection d from now. Only the first call counts,
+// so a toxic that sees many chunks does not keep pushing the deadline out.
+func (c *connection) closeAfter(d time.Duration, reset bool) {
+	c.timerOnce.Do(func() {
+		if d <= 0 {
+			c.close(reset)
+			return
+		}
+		time.AfterFunc(d, func() { c.close(reset) })
+	})
+}
+
+// sleep waits for d or until the connection is closed, and reports whether
+// the connection is still open.
+func (c *connection) sleep(d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-c.done:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
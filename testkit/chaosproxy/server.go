@@ -0,0 +1,377 @@
+// Package chaosproxy is an in-process TCP proxy that injects network faults.
+// It serves the Toxiproxy 2.x HTTP API, so tests written against the
+// toxiproxy client work unchanged without a Toxiproxy daemon:
+//
+//	srv, err := chaosproxy.Start("127.0.0.1:0")
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer srv.Close()
+//	client := toxiproxy.NewClient(srv.Addr())
+//
+// Proxies created with a listen address of "127.0.0.1:0" get an ephemeral
+// port; the address actually in use is reported back in the proxy's Listen
+// field. The latency, bandwidth, slicer, timeout, reset_peer and limit_data
+// toxics are supported on both the upstream and the downstream stream.
+package chaosproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// version is reported by GET /version.
+const version = "2.1.4-chaosproxy"
+
+// Server holds a set of proxies and serves the Toxiproxy API for them.
+type Server struct {
+	mu      sync.Mutex
+	proxies map[string]*proxy
+	mux     *http.ServeMux
+
+	listener net.Listener
+	httpSrv  *http.Server
+}
+
+// NewServer returns a Server with no proxies. It is an http.Handler for the
+// Toxiproxy API; use Start to also listen for API requests.
+func NewServer() *Server {
+	s := &Server{proxies: make(map[string]*proxy), mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /version", s.handleVersion)
+	s.mux.HandleFunc("POST /reset", s.handleReset)
+	s.mux.HandleFunc("POST /populate", s.handlePopulate)
+	s.mux.HandleFunc("GET /proxies", s.handleListProxies)
+	s.mux.HandleFunc("POST /proxies", s.handleCreateProxy)
+	s.mux.HandleFunc("GET /proxies/{proxy}", s.handleGetProxy)
+	s.mux.HandleFunc("POST /proxies/{proxy}", s.handleUpdateProxy)
+	s.mux.HandleFunc("DELETE /proxies/{proxy}", s.handleDeleteProxy)
+	s.mux.HandleFunc("GET /proxies/{proxy}/toxics", s.handleListToxics)
+	s.mux.HandleFunc("POST /proxies/{proxy}/toxics", s.handleCreateToxic)
+	s.mux.HandleFunc("GET /proxies/{proxy}/toxics/{toxic}", s.handleGetToxic)
+	s.mux.HandleFunc("POST /proxies/{proxy}/toxics/{toxic}", s.handleUpdateToxic)
+	s.mux.HandleFunc("DELETE /proxies/{proxy}/toxics/{toxic}", s.handleDeleteToxic)
+	return s
+}
+
+// Start returns a Server whose API listens on addr, such as "127.0.0.1:0"
+// for an ephemeral port.
+func Start(addr string) (*Server, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := NewServer()
+	s.listener = l
+	s.httpSrv = &http.Server{Handler: s}
+	go s.httpSrv.Serve(l)
+	return s, nil
+}
+
+// Addr returns the address of the API, for toxiproxy.NewClient. It is empty
+// for a Server that was not started with Start.
+func (s *Server) Addr() string {
+	if s.listener == nil {
+		return ""
+	}
+	return s.listener.Addr().String()
+}
+
+// Close stops the API and every proxy, dropping their connections.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	for name, p := range s.proxies {
+		p.stop()
+		delete(s.proxies, name)
+	}
+	s.mu.Unlock()
+	if s.httpSrv != nil {
+		return s.httpSrv.Close()
+	}
+	return nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// apiError is the error body Toxiproxy returns, which the client decodes.
+type apiError struct {
+	Message string `json:"error"`
+	Status  int    `json:"status"`
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+func newAPIError(status int, format string, args ...any) *apiError {
+	return &apiError{Message: fmt.Sprintf(format, args...), Status: status}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		apiErr = newAPIError(http.StatusInternalServerError, "%v", err)
+	}
+	writeJSON(w, apiErr.Status, apiErr)
+}
+
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprint(w, version)
+}
+
+// handleReset re-enables every proxy and removes all toxics.
+func (s *Server) handleReset(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.proxies {
+		p.removeToxics()
+		if err := p.setEnabled(true); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlePopulate creates the proxies in the request. A proxy that already
+// exists is kept if its listen address and upstream are unchanged, and
+// replaced otherwise.
+func (s *Server) handlePopulate(w http.ResponseWriter, r *http.Request) {
+	var configs []proxyConfig
+	if err := json.NewDecoder(r.Body).Decode(&configs); err != nil {
+		writeError(w, newAPIError(http.StatusBadRequest, "bad request body: %v", err))
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := struct {
+		Proxies []proxyState `json:"proxies"`
+		*apiError
+	}{Proxies: []proxyState{}}
+	for _, config := range configs {
+		p, err := s.populate(config)
+		if err != nil {
+			var apiErr *apiError
+			if !errors.As(err, &apiErr) {
+				apiErr = newAPIError(http.StatusInternalServerError, "%v", err)
+			}
+			result.apiError = apiErr
+			writeJSON(w, apiErr.Status, result)
+			return
+		}
+		result.Proxies = append(result.Proxies, p.state())
+	}
+	writeJSON(w, http.StatusCreated, result)
+}
+
+func (s *Server) populate(config proxyConfig) (*proxy, error) {
+	if p, ok := s.proxies[config.Name]; ok {
+		if p.matches(config) {
+			return p, p.setEnabled(config.enabled())
+		}
+		p.stop()
+		delete(s.proxies, config.Name)
+	}
+	return s.create(config)
+}
+
+// create must be called with s.mu held.
+func (s *Server) create(config proxyConfig) (*proxy, error) {
+	if config.Name == "" {
+		return nil, newAPIError(http.StatusBadRequest, "missing required field: name")
+	}
+	if config.Upstream == "" {
+		return nil, newAPIError(http.StatusBadRequest, "missing required field: upstream")
+	}
+	if _, ok := s.proxies[config.Name]; ok {
+		return nil, newAPIError(http.StatusConflict, "proxy already exists")
+	}
+	if config.Listen == "" {
+		config.Listen = "127.0.0.1:0"
+	}
+	p := newProxy(config)
+	if err := p.setEnabled(config.enabled()); err != nil {
+		return nil, err
+	}
+	s.proxies[config.Name] = p
+	return p, nil
+}
+
+func (s *Server) handleListProxies(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states := make(map[string]proxyState, len(s.proxies))
+	for name, p := range s.proxies {
+		states[name] = p.state()
+	}
+	writeJSON(w, http.StatusOK, states)
+}
+
+func (s *Server) handleCreateProxy(w http.ResponseWriter, r *http.Request) {
+	var config proxyConfig
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		writeError(w, newAPIError(http.StatusBadRequest, "bad request body: %v", err))
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, err := s.create(config)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, p.state())
+}
+
+// lookup must be called with s.mu held.
+func (s *Server) lookup(name string) (*proxy, error) {
+	p, ok := s.proxies[name]
+	if !ok {
+		return nil, newAPIError(http.StatusNotFound, "proxy not found")
+	}
+	return p, nil
+}
+
+func (s *Server) handleGetProxy(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, err := s.lookup(r.PathValue("proxy"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p.state())
+}
+
+// handleUpdateProxy applies the enabled, listen and upstream fields of the
+// request. Toxics in the body are ignored, as they are by Toxiproxy.
+func (s *Server) handleUpdateProxy(w http.ResponseWriter, r *http.Request) {
+	var config proxyConfig
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		writeError(w, newAPIError(http.StatusBadRequest, "bad request body: %v", err))
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, err := s.lookup(r.PathValue("proxy"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := p.update(config); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p.state())
+}
+
+func (s *Server) handleDeleteProxy(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, err := s.lookup(r.PathValue("proxy"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	p.stop()
+	delete(s.proxies, p.name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleListToxics(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, err := s.lookup(r.PathValue("proxy"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p.state().Toxics)
+}
+
+func (s *Server) handleCreateToxic(w http.ResponseWriter, r *http.Request) {
+	t := &toxic{Toxicity: 1}
+	if err := json.NewDecoder(r.Body).Decode(t); err != nil {
+		writeError(w, newAPIError(http.StatusBadRequest, "bad request body: %v", err))
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, err := s.lookup(r.PathValue("proxy"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := p.addToxic(t); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, t.clone())
+}
+
+func (s *Server) handleGetToxic(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, err := s.lookup(r.PathValue("proxy"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	t, err := p.toxic(r.PathValue("toxic"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+func (s *Server) handleUpdateToxic(w http.ResponseWriter, r *http.Request) {
+	var update struct {
+		Toxicity   *float32       `json:"toxicity"`
+		Attributes map[string]any `json:"attributes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeError(w, newAPIError(http.StatusBadRequest, "bad request body: %v", err))
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, err := s.lookup(r.PathValue("proxy"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	t, err := p.updateToxic(r.PathValue("toxic"), update.Toxicity, update.Attributes)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+func (s *Server) handleDeleteToxic(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, err := s.lookup(r.PathValue("proxy"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := p.removeToxic(r.PathValue("toxic")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,192 @@
+package chaosproxy
+
+import (
+	"maps"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	streamUpstream   = "upstream"
+	streamDownstream = "downstream"
+)
+
+// toxicAttributes lists the attributes of each supported toxic type with
+// their defaults, using Toxiproxy's names and units: latency, jitter and
+// timeout in milliseconds, rate in KB/s, delay in microseconds and sizes in
+// bytes.
+var toxicAttributes = map[string]map[string]float64{
+	"latency":    {"latency": 0, "jitter": 0},
+	"bandwidth":  {"rate": 0},
+	"slicer":     {"average_size": 0, "size_variation": 0, "delay": 0},
+	"timeout":    {"timeout": 0},
+	"reset_peer": {"timeout": 0},
+	"limit_data": {"bytes": 0},
+}
+
+// toxic is a fault applied to one direction of every connection through a
+// proxy. Its JSON form matches toxiproxy.Toxic.
+type toxic struct {
+	Name       string         `json:"name"`
+	Type       string         `json:"type"`
+	Stream     string         `json:"stream"`
+	Toxicity   float32        `json:"toxicity"`
+	Attributes map[string]any `json:"attributes"`
+}
+
+// validate fills in defaults and rejects toxics the proxy cannot apply.
+func (t *toxic) validate() error {
+	defaults, ok := toxicAttributes[t.Type]
+	if !ok {
+		return newAPIError(http.StatusBadRequest, "invalid toxic type: %q", t.Type)
+	}
+	if t.Stream == "" {
+		t.Stream = streamDownstream
+	}
+	if t.Stream != streamUpstream && t.Stream != streamDownstream {
+		return newAPIError(http.StatusBadRequest, "invalid stream: %q", t.Stream)
+	}
+	if t.Name == "" {
+		t.Name = t.Type + "_" + t.Stream
+	}
+	if t.Toxicity < 0 || t.Toxicity > 1 {
+		return newAPIError(http.StatusBadRequest, "toxicity must be between 0 and 1")
+	}
+	attrs := make(map[string]any, len(defaults))
+	for key, value := range defaults {
+		attrs[key] = value
+	}
+	for key, value := range t.Attributes {
+		if _, ok := defaults[key]; !ok {
+			return newAPIError(http.StatusBadRequest, "unknown attribute %q for toxic type %s", key, t.Type)
+		}
+		if _, ok := value.(float64); !ok {
+			return newAPIError(http.StatusBadRequest, "attribute %q must be a number", key)
+		}
+		attrs[key] = value
+	}
+	t.Attributes = attrs
+	return nil
+}
+
+func (t *toxic) clone() *toxic {
+	c := *t
+	c.Attributes = maps.Clone(t.Attributes)
+	return &c
+}
+
+func (t *toxic) attr(name string) float64 {
+	v, _ := t.Attributes[name].(float64)
+	return v
+}
+
+func (t *toxic) millis(name string) time.Duration {
+	return time.Duration(t.attr(name) * float64(time.Millisecond))
+}
+
+// pipe copies src to dst, one read at a time, applying the toxics that are
+// active on stream when each chunk arrives. Adding or removing a toxic
+// therefore affects connections that are already open.
+func (c *connection) pipe(stream string, src, dst net.Conn) {
+	defer c.close(false)
+	// Whether a toxic applies is decided once per connection, weighted by
+	// its toxicity, as Toxiproxy does.
+	applies := make(map[string]bool)
+	var sent int64
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			arrived := time.Now()
+			chunk := buf[:n]
+			var toxics []*toxic
+			for _, t := range c.proxy.activeToxics(stream) {
+				on, seen := applies[t.Name]
+				if !seen {
+					on = t.Toxicity >= 1 || rand.Float32() < t.Toxicity
+					applies[t.Name] = on
+				}
+				if on {
+					toxics = append(toxics, t)
+				}
+			}
+			if !c.forward(toxics, chunk, dst, arrived, &sent) {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// forward writes chunk to dst through toxics and reports whether the
+// connection should stay open.
+func (c *connection) forward(toxics []*toxic, chunk []byte, dst net.Conn, arrived time.Time, sent *int64) bool {
+	var delay time.Duration
+	var sliceSize, sliceVariation int
+	var sliceDelay time.Duration
+	limit := int64(-1)
+	for _, t := range toxics {
+		switch t.Type {
+		case "latency":
+			d := t.millis("latency")
+			if jitter := t.millis("jitter"); jitter > 0 {
+				d += time.Duration(rand.Int64N(int64(2*jitter))) - jitter
+			}
+			delay += d
+		case "bandwidth":
+			if rate := t.attr("rate"); rate > 0 {
+				delay += time.Duration(float64(len(chunk)) / (rate * 1000) * float64(time.Second))
+			}
+		case "slicer":
+			sliceSize = int(t.attr("average_size"))
+			sliceVariation = int(t.attr("size_variation"))
+			sliceDelay = time.Duration(t.attr("delay") * float64(time.Microsecond))
+		case "timeout":
+			// Data is dropped. A timeout of 0 holds the connection open until
+			// the toxic is removed; otherwise it is closed after timeout.
+			if d := t.millis("timeout"); d > 0 {
+				c.closeAfter(d, false)
+			}
+			return true
+		case "reset_peer":
+			c.closeAfter(t.millis("timeout"), true)
+			return true
+		case "limit_data":
+			limit = int64(t.attr("bytes"))
+		}
+	}
+
+	if !c.sleep(time.Until(arrived.Add(delay))) {
+		return false
+	}
+	closeAfterWrite := false
+	if limit >= 0 {
+		if remaining := limit - *sent; int64(len(chunk)) >= remaining {
+			chunk = chunk[:max(remaining, 0)]
+			closeAfterWrite = true
+		}
+	}
+	for len(chunk) > 0 {
+		size := len(chunk)
+		if sliceSize > 0 {
+			size = sliceSize
+			if sliceVariation > 0 {
+				size += rand.IntN(2*sliceVariation+1) - sliceVariation
+			}
+			size = min(max(size, 1), len(chunk))
+		}
+		if _, err := dst.Write(chunk[:size]); err != nil {
+			return false
+		}
+		*sent += int64(size)
+		chunk = chunk[size:]
+		if len(chunk) > 0 && !c.sleep(sliceDelay) {
+			return false
+		}
+	}
+	return !closeAfterWrite
+}
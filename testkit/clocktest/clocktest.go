@@ -0,0 +1,174 @@
+// Package clocktest provides a manual clock for testing code that waits,
+// so retries, backoff and timeouts can be checked in milliseconds of real
+// time. Fake satisfies the package's Clock interface:
+//
+//	clock := clocktest.New(time.Time{})
+//	go func() { done <- createS3BucketWithContext(ctx, client, name, region, WithClock(clock)) }()
+//	clock.BlockUntil(1)         // the first attempt's timeout is armed
+//	clock.Advance(5 * time.Second)
+package clocktest
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Fake is a clock that only moves when Advance is called. It is safe for
+// concurrent use.
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	timers  []*timer
+	changed chan struct{} // closed and replaced whenever timers changes
+}
+
+type timer struct {
+	when time.Time
+	f    func()
+}
+
+// New returns a Fake that reads now until it is advanced.
+func New(now time.Time) *Fake {
+	return &Fake{now: now, changed: make(chan struct{})}
+}
+
+// Now returns the fake time.
+func (c *Fake) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Since returns the fake time elapsed since t.
+func (c *Fake) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// AfterFunc arranges for f to be called once the clock has been advanced by
+// d. f runs on the goroutine that calls Advance. A d of zero or less runs f
+// straight away, on its own goroutine, as time.AfterFunc does.
+func (c *Fake) AfterFunc(d time.Duration, f func()) (stop func() bool) {
+	if d <= 0 {
+		go f()
+		return func() bool { return false }
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &timer{when: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	c.notify()
+	return func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		i := slices.Index(c.timers, t)
+		if i < 0 {
+			return false
+		}
+		c.timers = slices.Delete(c.timers, i, i+1)
+		c.notify()
+		return true
+	}
+}
+
+// Advance moves the clock forward by d, firing every timer that falls due in
+// order of when it was due. Each timer sees Now at its own due time.
+func (c *Fake) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	c.mu.Unlock()
+	for {
+		c.mu.Lock()
+		next := c.next(end)
+		if next == nil {
+			c.now = end
+			c.mu.Unlock()
+			return
+		}
+		c.now = next.when
+		c.timers = slices.DeleteFunc(c.timers, func(t *timer) bool { return t == next })
+		c.notify()
+		c.mu.Unlock()
+		next.f()
+	}
+}
+
+// next returns the earliest timer due at or before end, or nil. It must be
+// called with mu held.
+func (c *Fake) next(end time.Time) *timer {
+	var next *timer
+	for _, t := range c.timers {
+		if !t.when.After(end) && (next == nil || t.when.Before(next.when)) {
+			next = t
+		}
+	}
+	return next
+}
+
+// Pending returns the number of timers waiting to fire.
+func (c *Fake) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// BlockUntil waits until at least n timers are pending, which is how a test
+// knows the code under test has reached a sleep or armed a timeout.
+func (c *Fake) BlockUntil(n int) {
+	for {
+		pending, changed := c.watch()
+		if pending >= n {
+			return
+		}
+		<-changed
+	}
+}
+
+// Drive calls fn on its own goroutine and returns its error. Meanwhile each
+// duration received from advance is passed to Advance once a timer is
+// pending, so a test can step fn through as many timeouts and backoffs as
+// it turns out to need. If fn has not returned within limit of real time,
+// Drive fails t instead of leaving the test to hang, and fn is abandoned.
+func (c *Fake) Drive(t testing.TB, limit time.Duration, advance <-chan time.Duration, fn func() error) error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+	expired := time.After(limit)
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-expired:
+			t.Fatalf("clocktest: still running after %v of real time, at fake time %v with %d timers pending",
+				limit, c.Now(), c.Pending())
+			return nil
+		case d := <-advance:
+			for pending, changed := c.watch(); pending == 0; pending, changed = c.watch() {
+				select {
+				case err := <-done:
+					return err
+				case <-expired:
+					t.Fatalf("clocktest: no timer to advance %v past after %v of real time", d, limit)
+					return nil
+				case <-changed:
+				}
+			}
+			c.Advance(d)
+		}
+	}
+}
+
+// watch returns the number of pending timers and a channel that is closed
+// when that changes.
+func (c *Fake) watch() (int, <-chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers), c.changed
+}
+
+// notify wakes BlockUntil. It must be called with mu held.
+func (c *Fake) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
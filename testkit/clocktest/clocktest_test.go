@@ -0,0 +1,134 @@
+package clocktest
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2025, 8, 13, 9, 0, 0, 0, time.UTC)
+	clock := New(start)
+
+	var fired []time.Duration
+	record := func() { fired = append(fired, clock.Since(start)) }
+	clock.AfterFunc(3*time.Second, record)
+	clock.AfterFunc(time.Second, record)
+	stop := clock.AfterFunc(2*time.Second, record)
+
+	if got := clock.Pending(); got != 3 {
+		t.Fatalf("Pending() = %d, want 3", got)
+	}
+	if !stop() {
+		t.Errorf("stop() = false for a pending timer, want true")
+	}
+	if stop() {
+		t.Errorf("second stop() = true, want false")
+	}
+
+	clock.Advance(2500 * time.Millisecond)
+	if len(fired) != 1 || fired[0] != time.Second {
+		t.Errorf("after 2.5s fired at %v, want [1s]", fired)
+	}
+	if got := clock.Since(start); got != 2500*time.Millisecond {
+		t.Errorf("Since(start) = %v, want 2.5s", got)
+	}
+
+	clock.Advance(time.Second)
+	if len(fired) != 2 || fired[1] != 3*time.Second {
+		t.Errorf("after 3.5s fired at %v, want [1s 3s]", fired)
+	}
+	if got := clock.Pending(); got != 0 {
+		t.Errorf("Pending() = %d, want 0", got)
+	}
+}
+
+func TestFakeBlockUntil(t *testing.T) {
+	clock := New(time.Time{})
+	done := make(chan struct{})
+	go func() {
+		wake := make(chan struct{})
+		clock.AfterFunc(time.Minute, func() { close(wake) })
+		<-wake
+		close(done)
+	}()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("sleeper did not wake after Advance")
+	}
+}
+
+func TestFakeDrive(t *testing.T) {
+	clock := New(time.Time{})
+	errDone := errors.New("done")
+	sleep := func(d time.Duration) {
+		wake := make(chan struct{})
+		clock.AfterFunc(d, func() { close(wake) })
+		<-wake
+	}
+	advance := make(chan time.Duration, 3)
+	advance <- time.Second
+	err := clock.Drive(t, 10*time.Second, advance, func() error {
+		// Each sleep asks for the next one, as a retry loop reports its
+		// backoff before waiting it out.
+		for _, d := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+			if d > time.Second {
+				advance <- d
+			}
+			sleep(d)
+		}
+		return errDone
+	})
+	if err != errDone {
+		t.Errorf("Drive() = %v, want %v", err, errDone)
+	}
+	if got := clock.Since(time.Time{}); got != 7*time.Second {
+		t.Errorf("clock advanced %v, want 7s", got)
+	}
+}
+
+// fatalTB records a Fatalf and stops the goroutine, as testing.T does.
+type fatalTB struct {
+	testing.TB
+	msg string
+}
+
+func (tb *fatalTB) Helper() {}
+
+func (tb *fatalTB) Fatalf(format string, args ...any) {
+	tb.msg = fmt.Sprintf(format, args...)
+	runtime.Goexit()
+}
+
+func TestFakeDriveLimit(t *testing.T) {
+	clock := New(time.Time{})
+	advance := make(chan time.Duration, 1)
+	advance <- time.Second
+	block := make(chan struct{})
+	defer close(block)
+
+	tb := &fatalTB{TB: t}
+	returned := make(chan struct{})
+	go func() {
+		defer close(returned)
+		clock.Drive(tb, 50*time.Millisecond, advance, func() error {
+			<-block
+			return nil
+		})
+	}()
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Drive did not give up after its limit")
+	}
+	if !strings.Contains(tb.msg, "no timer to advance 1s past") {
+		t.Errorf("Drive failed the test with %q, want it to say no timer was pending", tb.msg)
+	}
+}
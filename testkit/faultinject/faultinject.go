@@ -0,0 +1,211 @@
+// Package faultinject wraps an http.RoundTripper so that tests can make
+// requests slow, hang, fail or come back broken without running Toxiproxy.
+// Faults follow a script: the first matching request gets the first fault,
+// the second gets the second, and so on. Requests past the end of the
+// script are passed through untouched.
+//
+//	transport := faultinject.New(ts.Client().Transport,
+//		faultinject.S3Error(http.StatusServiceUnavailable, "SlowDown"),
+//		faultinject.ConnReset(),
+//	)
+//	cfg, err := config.LoadDefaultConfig(ctx,
+//		config.WithHTTPClient(&http.Client{Transport: transport}),
+//	)
+package faultinject
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Fault decides what happens to one request. It may call next to send the
+// request on, before or after misbehaving.
+type Fault func(req *http.Request, next http.RoundTripper) (*http.Response, error)
+
+// Transport is an http.RoundTripper that applies a script of faults.
+type Transport struct {
+	// Base sends requests on. If nil, http.DefaultTransport is used.
+	Base http.RoundTripper
+	// Match picks the requests the script applies to. Others are passed
+	// straight to Base and do not use up a fault. If nil, every request
+	// matches.
+	Match func(*http.Request) bool
+
+	mu       sync.Mutex
+	schedule []Fault
+	calls    int
+}
+
+// New returns a Transport that applies schedule, in order, to requests sent
+// through base. A nil entry lets that request through.
+func New(base http.RoundTripper, schedule ...Fault) *Transport {
+	return &Transport{Base: base, schedule: schedule}
+}
+
+// Calls reports how many matching requests the transport has seen.
+func (t *Transport) Calls() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.calls
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if t.Match != nil && !t.Match(req) {
+		return base.RoundTrip(req)
+	}
+	t.mu.Lock()
+	var fault Fault
+	if t.calls < len(t.schedule) {
+		fault = t.schedule[t.calls]
+	}
+	t.calls++
+	t.mu.Unlock()
+	if fault == nil {
+		return base.RoundTrip(req)
+	}
+	return fault(req, base)
+}
+
+// Method matches requests with the given HTTP method, for example PUT for
+// CreateBucket or HEAD for HeadBucket.
+func Method(method string) func(*http.Request) bool {
+	return func(req *http.Request) bool {
+		return req.Method == method
+	}
+}
+
+// Pass lets the request through. It is the same as a nil entry and reads
+// better in a script.
+func Pass() Fault {
+	return nil
+}
+
+// Latency waits for d before sending the request, or fails with the
+// request's context error if that is done first.
+func Latency(d time.Duration) Fault {
+	return func(req *http.Request, next http.RoundTripper) (*http.Response, error) {
+		if err := sleep(req.Context(), d); err != nil {
+			return nil, err
+		}
+		return next.RoundTrip(req)
+	}
+}
+
+// Timeout never answers: the request blocks until its context is done, as
+// if the server had stopped responding.
+func Timeout() Fault {
+	return func(req *http.Request, next http.RoundTripper) (*http.Response, error) {
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	}
+}
+
+// ConnReset fails the request with ECONNRESET without sending it.
+func ConnReset() Fault {
+	return func(req *http.Request, next http.RoundTripper) (*http.Response, error) {
+		return nil, connReset()
+	}
+}
+
+// ResetAfterSend sends the request, discards the response and then fails
+// with ECONNRESET. The server has done the work but the client never hears
+// about it, which is the case idempotent retries have to handle.
+func ResetAfterSend() Fault {
+	return func(req *http.Request, next http.RoundTripper) (*http.Response, error) {
+		resp, err := next.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return nil, connReset()
+	}
+}
+
+// TruncateBody sends the request and cuts the response body off after n
+// bytes, so reading it fails with io.ErrUnexpectedEOF.
+func TruncateBody(n int64) Fault {
+	return func(req *http.Request, next http.RoundTripper) (*http.Response, error) {
+		resp, err := next.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = &truncatedBody{body: resp.Body, remaining: n}
+		return resp, nil
+	}
+}
+
+// S3Error answers with an S3 error document carrying status and code,
+// without sending the request on.
+func S3Error(status int, code string) Fault {
+	return func(req *http.Request, next http.RoundTripper) (*http.Response, error) {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		body := ""
+		if req.Method != http.MethodHead {
+			body = fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<Error><Code>%s</Code><Message>injected fault</Message><Resource>%s</Resource><RequestId>faultinject</RequestId></Error>`,
+				code, req.URL.Path)
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+			StatusCode:    status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": {"application/xml"}, "X-Amz-Request-Id": {"faultinject"}},
+			Body:          io.NopCloser(strings.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+}
+
+func connReset() error {
+	return &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type truncatedBody struct {
+	body      io.ReadCloser
+	remaining int64
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.body.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+func (b *truncatedBody) Close() error {
+	return b.body.Close()
+}
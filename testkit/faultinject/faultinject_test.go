@@ -0,0 +1,110 @@
+package faultinject
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestTransportSchedule(t *testing.T) {
+	var served int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served++
+		io.WriteString(w, "hello, gophers")
+	}))
+	defer ts.Close()
+
+	transport := New(nil,
+		S3Error(http.StatusServiceUnavailable, "SlowDown"),
+		ConnReset(),
+		TruncateBody(5),
+		Pass(),
+	)
+	transport.Match = Method(http.MethodPut)
+	client := &http.Client{Transport: transport}
+
+	// GETs do not match, so they pass through and do not use up the script.
+	if resp, err := client.Get(ts.URL); err != nil {
+		t.Fatalf("GET error = %v", err)
+	} else {
+		resp.Body.Close()
+	}
+
+	put := func() (*http.Response, error) {
+		req, _ := http.NewRequest(http.MethodPut, ts.URL+"/bucket", nil)
+		return client.Do(req)
+	}
+
+	resp, err := put()
+	if err != nil {
+		t.Fatalf("first PUT error = %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || !strings.Contains(string(body), "<Code>SlowDown</Code>") {
+		t.Errorf("first PUT = %d %q, want 503 SlowDown", resp.StatusCode, body)
+	}
+
+	if _, err := put(); !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("second PUT error = %v, want ECONNRESET", err)
+	}
+
+	resp, err = put()
+	if err != nil {
+		t.Fatalf("third PUT error = %v", err)
+	}
+	body, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "hello" || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("third PUT body = %q, %v, want %q, %v", body, err, "hello", io.ErrUnexpectedEOF)
+	}
+
+	for i := 0; i < 2; i++ {
+		resp, err := put()
+		if err != nil {
+			t.Fatalf("PUT after script error = %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "hello, gophers" {
+			t.Errorf("PUT after script body = %q, want it untouched", body)
+		}
+	}
+
+	if got := transport.Calls(); got != 5 {
+		t.Errorf("Calls() = %d, want 5", got)
+	}
+	// The injected error and the reset never reach the server.
+	if served != 4 {
+		t.Errorf("server saw %d requests, want 4", served)
+	}
+}
+
+func TestTransportLatencyAndTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	client := &http.Client{Transport: New(nil, Latency(50*time.Millisecond), Timeout())}
+
+	start := time.Now()
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("delayed GET error = %v", err)
+	}
+	resp.Body.Close()
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("delayed GET took %v, want at least 50ms", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, nil)
+	if _, err := client.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("hung GET error = %v, want context.DeadlineExceeded", err)
+	}
+}
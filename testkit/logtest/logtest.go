@@ -0,0 +1,204 @@
+// Package logtest records slog output so tests can assert on log records and
+// their attributes instead of matching substrings of formatted text.
+//
+//	logger, logs := logtest.New()
+//	createS3Bucket(client, name, region, WithLogger(logger))
+//	failures := logs.Find("Failed to create S3 bucket")
+//	if got := failures[0].Int("attempt"); got != 1 { ... }
+package logtest
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Record is one captured log record. Attributes from With and WithGroup are
+// included, with group names joined to keys by dots.
+type Record struct {
+	Time    time.Time
+	Level   slog.Level
+	Message string
+	Attrs   map[string]slog.Value
+}
+
+// Value returns the attribute key and whether it was set.
+func (r Record) Value(key string) (slog.Value, bool) {
+	v, ok := r.Attrs[key]
+	return v, ok
+}
+
+// String returns the attribute key as a string, or "" if it is not set.
+func (r Record) String(key string) string {
+	v, ok := r.Attrs[key]
+	if !ok {
+		return ""
+	}
+	return v.String()
+}
+
+// Int returns the attribute key as an int, or 0 if it is not set or not an
+// integer.
+func (r Record) Int(key string) int {
+	v, ok := r.Attrs[key]
+	if !ok {
+		return 0
+	}
+	switch v.Kind() {
+	case slog.KindInt64:
+		return int(v.Int64())
+	case slog.KindUint64:
+		return int(v.Uint64())
+	}
+	return 0
+}
+
+// Duration returns the attribute key as a time.Duration, or 0 if it is not
+// set or not a duration.
+func (r Record) Duration(key string) time.Duration {
+	v, ok := r.Attrs[key]
+	if !ok || v.Kind() != slog.KindDuration {
+		return 0
+	}
+	return v.Duration()
+}
+
+// Err returns the attribute key as an error, or nil if it is not set or not
+// an error.
+func (r Record) Err(key string) error {
+	v, ok := r.Attrs[key]
+	if !ok || v.Kind() != slog.KindAny {
+		return nil
+	}
+	err, _ := v.Any().(error)
+	return err
+}
+
+// Handler is a slog.Handler that keeps every record in memory. Handlers
+// derived with WithAttrs and WithGroup share the same records. It is safe
+// for concurrent use.
+type Handler struct {
+	store  *store
+	level  slog.Leveler
+	attrs  []slog.Attr
+	prefix string
+}
+
+type store struct {
+	mu      sync.Mutex
+	records []Record
+}
+
+// NewHandler returns a Handler that records records at level and above. A
+// nil level records everything.
+func NewHandler(level slog.Leveler) *Handler {
+	if level == nil {
+		level = slog.LevelDebug
+	}
+	return &Handler{store: &store{}, level: level}
+}
+
+// New returns a logger that records everything, and its Handler.
+func New() (*slog.Logger, *Handler) {
+	h := NewHandler(nil)
+	return slog.New(h), h
+}
+
+func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *Handler) Handle(_ context.Context, r slog.Record) error {
+	rec := Record{
+		Time:    r.Time,
+		Level:   r.Level,
+		Message: r.Message,
+		Attrs:   make(map[string]slog.Value, len(h.attrs)+r.NumAttrs()),
+	}
+	for _, a := range h.attrs {
+		addAttr(rec.Attrs, "", a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		addAttr(rec.Attrs, h.prefix, a)
+		return true
+	})
+	h.store.mu.Lock()
+	defer h.store.mu.Unlock()
+	h.store.records = append(h.store.records, rec)
+	return nil
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = append([]slog.Attr(nil), h.attrs...)
+	for _, a := range attrs {
+		a.Key = h.prefix + a.Key
+		h2.attrs = append(h2.attrs, a)
+	}
+	return &h2
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
+
+// addAttr flattens a into attrs, resolving values and expanding groups.
+func addAttr(attrs map[string]slog.Value, prefix string, a slog.Attr) {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		groupPrefix := prefix
+		if a.Key != "" {
+			groupPrefix = prefix + a.Key + "."
+		}
+		for _, ga := range v.Group() {
+			addAttr(attrs, groupPrefix, ga)
+		}
+		return
+	}
+	if a.Key == "" {
+		return
+	}
+	attrs[prefix+a.Key] = v
+}
+
+// Records returns a copy of everything recorded so far, oldest first.
+func (h *Handler) Records() []Record {
+	h.store.mu.Lock()
+	defer h.store.mu.Unlock()
+	return append([]Record(nil), h.store.records...)
+}
+
+// Find returns the records whose message is msg.
+func (h *Handler) Find(msg string) []Record {
+	var found []Record
+	for _, r := range h.Records() {
+		if r.Message == msg {
+			found = append(found, r)
+		}
+	}
+	return found
+}
+
+// Messages returns the message of every record, oldest first, which makes
+// for a readable failure message.
+func (h *Handler) Messages() string {
+	var msgs []string
+	for _, r := range h.Records() {
+		msgs = append(msgs, r.Message)
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Reset discards everything recorded so far.
+func (h *Handler) Reset() {
+	h.store.mu.Lock()
+	defer h.store.mu.Unlock()
+	h.store.records = nil
+}
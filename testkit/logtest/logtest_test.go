@@ -0,0 +1,48 @@
+package logtest
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	logger, logs := New()
+	errBoom := errors.New("boom")
+
+	logger.With("bucket", "my-bucket").WithGroup("req").Error("Failed", "attempt", 2, "error", errBoom)
+	logger.Info("Done", slog.Group("retry", "attempts", 3, "delay", 250*time.Millisecond))
+
+	failed := logs.Find("Failed")
+	if len(failed) != 1 {
+		t.Fatalf("Find(Failed) = %v, want one record", failed)
+	}
+	r := failed[0]
+	if r.Level != slog.LevelError {
+		t.Errorf("Level = %v, want ERROR", r.Level)
+	}
+	if got := r.String("bucket"); got != "my-bucket" {
+		t.Errorf("bucket = %q, want my-bucket", got)
+	}
+	if got := r.Int("req.attempt"); got != 2 {
+		t.Errorf("req.attempt = %d, want 2", got)
+	}
+	if got := r.Err("req.error"); got != errBoom {
+		t.Errorf("req.error = %v, want %v", got, errBoom)
+	}
+	if got := logs.Find("Done")[0].Int("retry.attempts"); got != 3 {
+		t.Errorf("retry.attempts = %d, want 3", got)
+	}
+	if got := logs.Find("Done")[0].Duration("retry.delay"); got != 250*time.Millisecond {
+		t.Errorf("retry.delay = %v, want 250ms", got)
+	}
+	if got, want := logs.Messages(), "Failed\nDone"; got != want {
+		t.Errorf("Messages() = %q, want %q", got, want)
+	}
+
+	logs.Reset()
+	if len(logs.Records()) != 0 {
+		t.Errorf("Records() after Reset = %v, want none", logs.Records())
+	}
+}
@@ -0,0 +1,40 @@
+package s3fake
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/golangbot/testkit/faultinject"
+)
+
+// NewClient returns a client in region for ts, a TLS server running a
+// Handler. It is addressed path style, signs with fixed credentials and
+// sends its requests through rt, such as a faultinject.Transport wrapping
+// ts.Client().Transport, or straight to ts if rt is nil. optFns are applied
+// last.
+func NewClient(ts *httptest.Server, region string, rt http.RoundTripper, optFns ...func(*s3.Options)) *s3.Client {
+	if rt == nil {
+		rt = ts.Client().Transport
+	}
+	return s3.New(s3.Options{
+		Region:       region,
+		BaseEndpoint: aws.String(ts.URL),
+		HTTPClient:   &http.Client{Transport: rt},
+		UsePathStyle: true,
+		Credentials:  credentials.NewStaticCredentialsProvider("AKIDEXAMPLE", "SECRETEXAMPLE", ""),
+	}, optFns...)
+}
+
+// NewFaultyClient is NewClient with its PUT requests, such as CreateBucket,
+// sent through schedule first. The SDK's own retries are turned off, so
+// every request the returned transport counts is one the caller made.
+func NewFaultyClient(ts *httptest.Server, region string, schedule ...faultinject.Fault) (*s3.Client, *faultinject.Transport) {
+	transport := faultinject.New(ts.Client().Transport, schedule...)
+	transport.Match = faultinject.Method(http.MethodPut)
+	return NewClient(ts, region, transport, func(o *s3.Options) {
+		o.Retryer = aws.NopRetryer{}
+	}), transport
+}
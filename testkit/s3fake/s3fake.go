@@ -0,0 +1,532 @@
+// Package s3fake is an in-memory S3 server for tests. It speaks enough of the
+// S3 REST/XML protocol for bucket and object operations that an unmodified
+// *s3.Client can talk to it through httptest:
+//
+//	ts := httptest.NewTLSServer(s3fake.NewHandler())
+//	cfg, err := config.LoadDefaultConfig(ctx,
+//		config.WithBaseEndpoint(ts.URL),
+//		config.WithHTTPClient(ts.Client()),
+//	)
+//
+// Requests are expected in path style (https://host/bucket/key), which the
+// SDK uses for IP endpoints such as the one httptest listens on. Signatures
+// are not checked and every caller is treated as the same account.
+package s3fake
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRegion   = "us-east-1"
+	defaultMaxKeys  = 1000
+	nullVersionID   = "null"
+	ownerID         = "fake-owner"
+	ownerName       = "s3fake"
+	timestampFormat = "2006-01-02T15:04:05.000Z"
+)
+
+// Handler is an http.Handler that serves S3 requests from memory. The zero
+// value is not usable; create one with NewHandler.
+type Handler struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+type bucket struct {
+	region  string
+	created time.Time
+	tags    []tag
+	objects map[string]*object
+}
+
+type object struct {
+	data         []byte
+	etag         string
+	contentType  string
+	lastModified time.Time
+}
+
+// NewHandler returns an empty fake S3 server.
+func NewHandler() *Handler {
+	return &Handler{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// SetNow replaces the clock the fake stamps bucket creation and object
+// modification times with, so tests can make buckets that look old.
+func (h *Handler) SetNow(now func() time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.now = now
+}
+
+// Buckets returns the names of the buckets that currently exist, sorted.
+func (h *Handler) Buckets() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	names := make([]string, 0, len(h.buckets))
+	for name := range h.buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Object returns the contents of key in bucket, if it exists.
+func (h *Handler) Object(bucketName, key string) ([]byte, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	b, ok := h.buckets[bucketName]
+	if !ok {
+		return nil, false
+	}
+	obj, ok := b.objects[key]
+	if !ok {
+		return nil, false
+	}
+	return bytes.Clone(obj.data), true
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucketName, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+	// The SDK names the operation in x-id; it is not a subresource.
+	query.Del("x-id")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch {
+	case bucketName == "":
+		if r.Method != http.MethodGet {
+			writeError(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource.", "")
+			return
+		}
+		h.listBuckets(w, r)
+	case key == "":
+		h.serveBucket(w, r, bucketName, query)
+	default:
+		h.serveObject(w, r, bucketName, key, query)
+	}
+}
+
+func (h *Handler) serveBucket(w http.ResponseWriter, r *http.Request, name string, query map[string][]string) {
+	has := func(param string) bool { _, ok := query[param]; return ok }
+	switch {
+	case r.Method == http.MethodPut && len(query) == 0:
+		h.createBucket(w, r, name)
+		return
+	case r.Method == http.MethodHead:
+		h.headBucket(w, r, name)
+		return
+	}
+
+	b, ok := h.buckets[name]
+	if !ok {
+		writeNoSuchBucket(w, r, name)
+		return
+	}
+	switch {
+	case r.Method == http.MethodDelete && len(query) == 0:
+		h.deleteBucket(w, r, name, b)
+	case r.Method == http.MethodGet && has("versions"):
+		h.listObjectVersions(w, r, name, b)
+	case r.Method == http.MethodGet && has("uploads"):
+		writeXML(w, http.StatusOK, listMultipartUploadsResult{Bucket: name})
+	case has("tagging"):
+		h.serveTagging(w, r, name, b)
+	case r.Method == http.MethodGet && has("location"):
+		writeXML(w, http.StatusOK, locationConstraint{Region: locationFor(b.region)})
+	case r.Method == http.MethodGet && onlyListParams(query):
+		h.listObjects(w, r, name, b)
+	case r.Method == http.MethodPost && has("delete"):
+		h.deleteObjects(w, r, b)
+	default:
+		writeError(w, r, http.StatusNotImplemented, "NotImplemented", "A header or query you provided implies functionality that is not implemented.", name)
+	}
+}
+
+func (h *Handler) serveObject(w http.ResponseWriter, r *http.Request, bucketName, key string, query map[string][]string) {
+	b, ok := h.buckets[bucketName]
+	if !ok {
+		writeNoSuchBucket(w, r, bucketName)
+		return
+	}
+	if len(query) > 0 {
+		writeError(w, r, http.StatusNotImplemented, "NotImplemented", "A header or query you provided implies functionality that is not implemented.", bucketName)
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		h.putObject(w, r, b, key)
+	case http.MethodGet, http.MethodHead:
+		obj, ok := b.objects[key]
+		if !ok {
+			writeError(w, r, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.", bucketName)
+			return
+		}
+		w.Header().Set("Content-Type", obj.contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(obj.data)))
+		w.Header().Set("ETag", obj.etag)
+		w.Header().Set("Last-Modified", obj.lastModified.UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(obj.data)
+		}
+	case http.MethodDelete:
+		delete(b.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource.", bucketName)
+	}
+}
+
+func (h *Handler) createBucket(w http.ResponseWriter, r *http.Request, name string) {
+	if _, ok := h.buckets[name]; ok {
+		writeError(w, r, http.StatusConflict, "BucketAlreadyOwnedByYou",
+			"Your previous request to create the named bucket succeeded and you already own it.", name)
+		return
+	}
+	if len(name) < 3 || len(name) > 63 {
+		writeError(w, r, http.StatusBadRequest, "InvalidBucketName", "The specified bucket is not valid.", name)
+		return
+	}
+	var config createBucketConfiguration
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "IncompleteBody", err.Error(), name)
+		return
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := xml.Unmarshal(body, &config); err != nil {
+			writeError(w, r, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed.", name)
+			return
+		}
+	}
+	region := config.LocationConstraint
+	if region == "" {
+		region = defaultRegion
+	}
+	h.buckets[name] = &bucket{region: region, created: h.now(), objects: make(map[string]*object)}
+	w.Header().Set("Location", "/"+name)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) headBucket(w http.ResponseWriter, r *http.Request, name string) {
+	b, ok := h.buckets[name]
+	if !ok {
+		writeNoSuchBucket(w, r, name)
+		return
+	}
+	w.Header().Set("x-amz-bucket-region", b.region)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) deleteBucket(w http.ResponseWriter, r *http.Request, name string, b *bucket) {
+	if len(b.objects) > 0 {
+		writeError(w, r, http.StatusConflict, "BucketNotEmpty", "The bucket you tried to delete is not empty.", name)
+		return
+	}
+	delete(h.buckets, name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listBuckets serves ListBuckets in a single page, honouring prefix.
+func (h *Handler) listBuckets(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	result := listAllMyBucketsResult{Owner: owner{ID: ownerID, DisplayName: ownerName}, Prefix: prefix}
+	names := make([]string, 0, len(h.buckets))
+	for name := range h.buckets {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b := h.buckets[name]
+		result.Buckets = append(result.Buckets, bucketEntry{
+			Name:         name,
+			CreationDate: b.created.UTC().Format(timestampFormat),
+			BucketRegion: b.region,
+		})
+	}
+	writeXML(w, http.StatusOK, result)
+}
+
+// serveTagging serves PutBucketTagging, GetBucketTagging and
+// DeleteBucketTagging. A bucket without tags has no tag set at all, so GET
+// fails with NoSuchTagSet, as it does on S3.
+func (h *Handler) serveTagging(w http.ResponseWriter, r *http.Request, name string, b *bucket) {
+	switch r.Method {
+	case http.MethodPut:
+		var tagging tagging
+		if err := xml.NewDecoder(r.Body).Decode(&tagging); err != nil {
+			writeError(w, r, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed.", name)
+			return
+		}
+		b.tags = tagging.TagSet
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodGet:
+		if len(b.tags) == 0 {
+			writeError(w, r, http.StatusNotFound, "NoSuchTagSet", "The TagSet does not exist.", name)
+			return
+		}
+		writeXML(w, http.StatusOK, tagging{TagSet: b.tags})
+	case http.MethodDelete:
+		b.tags = nil
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource.", name)
+	}
+}
+
+// listObjects serves ListObjectsV2 and, for requests without list-type, the
+// original ListObjects. Both page by key; the continuation token is simply
+// the last key returned.
+func (h *Handler) listObjects(w http.ResponseWriter, r *http.Request, name string, b *bucket) {
+	query := r.URL.Query()
+	maxKeys, err := maxKeysParam(query.Get("max-keys"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "InvalidArgument", err.Error(), name)
+		return
+	}
+	prefix := query.Get("prefix")
+	after := query.Get("marker")
+	v2 := query.Get("list-type") == "2"
+	if v2 {
+		after = max(query.Get("start-after"), query.Get("continuation-token"))
+	}
+
+	result := listBucketResult{Name: name, Prefix: prefix, MaxKeys: maxKeys}
+	if v2 {
+		result.ContinuationToken = query.Get("continuation-token")
+		result.StartAfter = query.Get("start-after")
+	} else {
+		result.Marker = &after
+	}
+	for _, key := range b.keys(prefix, after) {
+		if len(result.Contents) == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		obj := b.objects[key]
+		result.Contents = append(result.Contents, objectEntry{
+			Key:          key,
+			LastModified: obj.lastModified.UTC().Format(timestampFormat),
+			ETag:         obj.etag,
+			Size:         len(obj.data),
+			StorageClass: "STANDARD",
+		})
+	}
+	if v2 {
+		result.KeyCount = len(result.Contents)
+		if result.IsTruncated {
+			result.NextContinuationToken = result.Contents[len(result.Contents)-1].Key
+		}
+	} else if result.IsTruncated {
+		result.NextMarker = result.Contents[len(result.Contents)-1].Key
+	}
+	writeXML(w, http.StatusOK, result)
+}
+
+// listObjectVersions reports each object as its single "null" version, which
+// is what S3 returns for a bucket that has never had versioning enabled.
+func (h *Handler) listObjectVersions(w http.ResponseWriter, r *http.Request, name string, b *bucket) {
+	query := r.URL.Query()
+	maxKeys, err := maxKeysParam(query.Get("max-keys"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "InvalidArgument", err.Error(), name)
+		return
+	}
+	prefix := query.Get("prefix")
+	result := listVersionsResult{Name: name, Prefix: prefix, KeyMarker: query.Get("key-marker"), MaxKeys: maxKeys}
+	for _, key := range b.keys(prefix, result.KeyMarker) {
+		if len(result.Versions) == maxKeys {
+			result.IsTruncated = true
+			result.NextKeyMarker = result.Versions[len(result.Versions)-1].Key
+			result.NextVersionIDMarker = nullVersionID
+			break
+		}
+		obj := b.objects[key]
+		result.Versions = append(result.Versions, versionEntry{
+			Key:          key,
+			VersionID:    nullVersionID,
+			IsLatest:     true,
+			LastModified: obj.lastModified.UTC().Format(timestampFormat),
+			ETag:         obj.etag,
+			Size:         len(obj.data),
+			StorageClass: "STANDARD",
+		})
+	}
+	writeXML(w, http.StatusOK, result)
+}
+
+func (h *Handler) deleteObjects(w http.ResponseWriter, r *http.Request, b *bucket) {
+	var req deleteRequest
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed.", "")
+		return
+	}
+	var result deleteResult
+	for _, obj := range req.Objects {
+		// Only the null version exists, so deleting it, or deleting with no
+		// version at all, removes the object.
+		if obj.VersionID != "" && obj.VersionID != nullVersionID {
+			result.Errors = append(result.Errors, deleteError{
+				Key: obj.Key, VersionID: obj.VersionID, Code: "NoSuchVersion",
+				Message: "The specified version does not exist.",
+			})
+			continue
+		}
+		delete(b.objects, obj.Key)
+		if !req.Quiet {
+			result.Deleted = append(result.Deleted, deletedEntry{Key: obj.Key, VersionID: obj.VersionID})
+		}
+	}
+	writeXML(w, http.StatusOK, result)
+}
+
+func (h *Handler) putObject(w http.ResponseWriter, r *http.Request, b *bucket, key string) {
+	data, err := readPayload(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "IncompleteBody", err.Error(), "")
+		return
+	}
+	sum := md5.Sum(data)
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "binary/octet-stream"
+	}
+	obj := &object{
+		data:         data,
+		etag:         `"` + hex.EncodeToString(sum[:]) + `"`,
+		contentType:  contentType,
+		lastModified: h.now(),
+	}
+	b.objects[key] = obj
+	w.Header().Set("ETag", obj.etag)
+	w.WriteHeader(http.StatusOK)
+}
+
+// keys returns the bucket's keys that start with prefix and sort after
+// after, in order.
+func (b *bucket) keys(prefix, after string) []string {
+	var keys []string
+	for key := range b.objects {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// readPayload returns the object data in r, decoding the aws-chunked framing
+// the SDK uses when it sends a trailing checksum.
+func readPayload(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+	var data []byte
+	br := bufio.NewReader(r.Body)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("reading chunk header: %w", err)
+		}
+		sizeField, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeField, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad chunk size %q", sizeField)
+		}
+		if size == 0 {
+			// What follows are the trailing headers, which are not checked.
+			io.Copy(io.Discard, br)
+			return data, nil
+		}
+		chunk := make([]byte, size+2)
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return nil, fmt.Errorf("reading chunk: %w", err)
+		}
+		data = append(data, chunk[:size]...)
+	}
+}
+
+// listParams are the query parameters of ListObjects and ListObjectsV2. A
+// GET on a bucket with anything else names a subresource.
+var listParams = map[string]bool{
+	"list-type": true, "prefix": true, "marker": true, "max-keys": true,
+	"start-after": true, "continuation-token": true, "encoding-type": true, "fetch-owner": true,
+}
+
+func onlyListParams(query map[string][]string) bool {
+	for param := range query {
+		if !listParams[param] {
+			return false
+		}
+	}
+	return true
+}
+
+func maxKeysParam(s string) (int, error) {
+	if s == "" {
+		return defaultMaxKeys, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("max-keys must be a non-negative integer")
+	}
+	return min(n, defaultMaxKeys), nil
+}
+
+// locationFor returns the LocationConstraint S3 reports for region, which is
+// empty for us-east-1.
+func locationFor(region string) string {
+	if region == defaultRegion {
+		return ""
+	}
+	return region
+}
+
+func writeNoSuchBucket(w http.ResponseWriter, r *http.Request, name string) {
+	writeError(w, r, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist.", name)
+}
+
+// writeError sends an S3 error document. HEAD responses carry no body, so
+// clients only see the status code, as with real S3.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message, bucketName string) {
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+	writeXML(w, status, errorResponse{Code: code, Message: message, BucketName: bucketName, Resource: r.URL.Path})
+}
+
+func writeXML(w http.ResponseWriter, status int, v any) {
+	body, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	io.WriteString(w, xml.Header)
+	w.Write(body)
+}
@@ -0,0 +1,243 @@
+package s3fake
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/golangbot/testkit/faultinject"
+)
+
+func newTestClient(t *testing.T) (*s3.Client, *Handler) {
+	t.Helper()
+	fake := NewHandler()
+	ts := httptest.NewTLSServer(fake)
+	t.Cleanup(ts.Close)
+	return NewClient(ts, "eu-west-2", nil), fake
+}
+
+func errorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return ""
+}
+
+func TestBucketLifecycle(t *testing.T) {
+	client, fake := newTestClient(t)
+	ctx := context.Background()
+	bucket := aws.String("gopherconuk-2025-my-new-bucket")
+
+	var notFound *types.NotFound
+	if _, err := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: bucket}); !errors.As(err, &notFound) {
+		t.Fatalf("HeadBucket() before create error = %v, want NotFound", err)
+	}
+
+	create := &s3.CreateBucketInput{
+		Bucket: bucket,
+		CreateBucketConfiguration: &types.CreateBucketConfiguration{
+			LocationConstraint: types.BucketLocationConstraintEuWest2,
+		},
+	}
+	if _, err := client.CreateBucket(ctx, create); err != nil {
+		t.Fatalf("CreateBucket() error = %v", err)
+	}
+	var owned *types.BucketAlreadyOwnedByYou
+	if _, err := client.CreateBucket(ctx, create); !errors.As(err, &owned) {
+		t.Errorf("second CreateBucket() error = %v, want BucketAlreadyOwnedByYou", err)
+	}
+
+	head, err := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: bucket})
+	if err != nil {
+		t.Fatalf("HeadBucket() error = %v", err)
+	}
+	if got := aws.ToString(head.BucketRegion); got != "eu-west-2" {
+		t.Errorf("HeadBucket() region = %q, want eu-west-2", got)
+	}
+
+	list, err := client.ListBuckets(ctx, &s3.ListBucketsInput{})
+	if err != nil {
+		t.Fatalf("ListBuckets() error = %v", err)
+	}
+	if len(list.Buckets) != 1 || aws.ToString(list.Buckets[0].Name) != *bucket {
+		t.Errorf("ListBuckets() = %v, want [%s]", list.Buckets, *bucket)
+	}
+
+	if _, err := client.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: bucket}); err != nil {
+		t.Fatalf("DeleteBucket() error = %v", err)
+	}
+	if got := fake.Buckets(); len(got) != 0 {
+		t.Errorf("Buckets() after delete = %v, want none", got)
+	}
+	if _, err := client.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: bucket}); errorCode(err) != "NoSuchBucket" {
+		t.Errorf("DeleteBucket() of missing bucket error = %v, want NoSuchBucket", err)
+	}
+}
+
+func TestNewFaultyClient(t *testing.T) {
+	ts := httptest.NewTLSServer(NewHandler())
+	defer ts.Close()
+	client, transport := NewFaultyClient(ts, "eu-west-2", faultinject.S3Error(http.StatusServiceUnavailable, "SlowDown"))
+	ctx := context.Background()
+	bucket := aws.String("gopherconuk-2025-my-new-bucket")
+
+	if _, err := client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: bucket}); errorCode(err) != "SlowDown" {
+		t.Fatalf("first CreateBucket() error = %v, want SlowDown without an SDK retry", err)
+	}
+	if _, err := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: bucket}); err == nil {
+		t.Errorf("HeadBucket() after the injected fault succeeded, want the bucket missing")
+	}
+	if _, err := client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: bucket}); err != nil {
+		t.Fatalf("second CreateBucket() error = %v", err)
+	}
+	if got := transport.Calls(); got != 2 {
+		t.Errorf("transport saw %d PUT requests, want 2", got)
+	}
+}
+
+func TestObjects(t *testing.T) {
+	client, fake := newTestClient(t)
+	ctx := context.Background()
+	bucket := aws.String("gopherconuk-2025-my-new-bucket")
+
+	if _, err := client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: bucket, Key: aws.String("a"), Body: strings.NewReader("x"),
+	}); errorCode(err) != "NoSuchBucket" {
+		t.Fatalf("PutObject() into missing bucket error = %v, want NoSuchBucket", err)
+	}
+
+	if _, err := client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: bucket}); err != nil {
+		t.Fatalf("CreateBucket() error = %v", err)
+	}
+	for _, key := range []string{"logs/1", "logs/2", "data/1"} {
+		if _, err := client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket: bucket, Key: aws.String(key), Body: strings.NewReader("contents of " + key),
+		}); err != nil {
+			t.Fatalf("PutObject(%s) error = %v", key, err)
+		}
+	}
+	if got, _ := fake.Object(*bucket, "logs/1"); string(got) != "contents of logs/1" {
+		t.Errorf("stored object = %q, want %q", got, "contents of logs/1")
+	}
+
+	get, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: bucket, Key: aws.String("data/1")})
+	if err != nil {
+		t.Fatalf("GetObject() error = %v", err)
+	}
+	body, _ := io.ReadAll(get.Body)
+	get.Body.Close()
+	if string(body) != "contents of data/1" {
+		t.Errorf("GetObject() body = %q, want %q", body, "contents of data/1")
+	}
+	var noSuchKey *types.NoSuchKey
+	if _, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: bucket, Key: aws.String("missing")}); !errors.As(err, &noSuchKey) {
+		t.Errorf("GetObject() of missing key error = %v, want NoSuchKey", err)
+	}
+
+	var keys []string
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: bucket, Prefix: aws.String("logs/"), MaxKeys: aws.Int32(1),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			t.Fatalf("ListObjectsV2() error = %v", err)
+		}
+		for _, obj := range page.Contents {
+			keys = append(keys, aws.ToString(obj.Key))
+		}
+	}
+	if want := []string{"logs/1", "logs/2"}; !slices.Equal(keys, want) {
+		t.Errorf("ListObjectsV2() keys = %v, want %v", keys, want)
+	}
+
+	if _, err := client.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: bucket}); errorCode(err) != "BucketNotEmpty" {
+		t.Errorf("DeleteBucket() of full bucket error = %v, want BucketNotEmpty", err)
+	}
+
+	deleted, err := client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+		Bucket: bucket,
+		Delete: &types.Delete{Objects: []types.ObjectIdentifier{
+			{Key: aws.String("logs/1")}, {Key: aws.String("logs/2")},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("DeleteObjects() error = %v", err)
+	}
+	if len(deleted.Deleted) != 2 || len(deleted.Errors) != 0 {
+		t.Errorf("DeleteObjects() deleted %d, errors %v, want 2 and none", len(deleted.Deleted), deleted.Errors)
+	}
+	if _, err := client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: bucket, Key: aws.String("data/1")}); err != nil {
+		t.Fatalf("DeleteObject() error = %v", err)
+	}
+	if _, err := client.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: bucket}); err != nil {
+		t.Errorf("DeleteBucket() of emptied bucket error = %v", err)
+	}
+}
+
+func TestBucketTagging(t *testing.T) {
+	client, _ := newTestClient(t)
+	ctx := context.Background()
+	bucket := aws.String("gopherconuk-2025-my-new-bucket")
+	if _, err := client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: bucket}); err != nil {
+		t.Fatalf("CreateBucket() error = %v", err)
+	}
+
+	if _, err := client.GetBucketTagging(ctx, &s3.GetBucketTaggingInput{Bucket: bucket}); errorCode(err) != "NoSuchTagSet" {
+		t.Errorf("GetBucketTagging() before put error = %v, want NoSuchTagSet", err)
+	}
+	tags := []types.Tag{{Key: aws.String("created-by"), Value: aws.String("run-1234")}}
+	if _, err := client.PutBucketTagging(ctx, &s3.PutBucketTaggingInput{
+		Bucket:  bucket,
+		Tagging: &types.Tagging{TagSet: tags},
+	}); err != nil {
+		t.Fatalf("PutBucketTagging() error = %v", err)
+	}
+	got, err := client.GetBucketTagging(ctx, &s3.GetBucketTaggingInput{Bucket: bucket})
+	if err != nil {
+		t.Fatalf("GetBucketTagging() error = %v", err)
+	}
+	if len(got.TagSet) != 1 || aws.ToString(got.TagSet[0].Key) != "created-by" || aws.ToString(got.TagSet[0].Value) != "run-1234" {
+		t.Errorf("GetBucketTagging() = %v, want created-by=run-1234", got.TagSet)
+	}
+	if _, err := client.DeleteBucketTagging(ctx, &s3.DeleteBucketTaggingInput{Bucket: bucket}); err != nil {
+		t.Fatalf("DeleteBucketTagging() error = %v", err)
+	}
+	if _, err := client.GetBucketTagging(ctx, &s3.GetBucketTaggingInput{Bucket: bucket}); errorCode(err) != "NoSuchTagSet" {
+		t.Errorf("GetBucketTagging() after delete error = %v, want NoSuchTagSet", err)
+	}
+}
+
+func TestListBucketsPrefix(t *testing.T) {
+	client, _ := newTestClient(t)
+	ctx := context.Background()
+	for _, name := range []string{"gopherconuk-2025-a", "gopherconuk-2025-b", "other-bucket"} {
+		if _, err := client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String(name)}); err != nil {
+			t.Fatalf("CreateBucket(%s) error = %v", name, err)
+		}
+	}
+	list, err := client.ListBuckets(ctx, &s3.ListBucketsInput{Prefix: aws.String("gopherconuk-2025-")})
+	if err != nil {
+		t.Fatalf("ListBuckets() error = %v", err)
+	}
+	var names []string
+	for _, b := range list.Buckets {
+		names = append(names, aws.ToString(b.Name))
+		if got := aws.ToString(b.BucketRegion); got != "us-east-1" {
+			t.Errorf("ListBuckets() region of %s = %q, want us-east-1", aws.ToString(b.Name), got)
+		}
+	}
+	if want := []string{"gopherconuk-2025-a", "gopherconuk-2025-b"}; !slices.Equal(names, want) {
+		t.Errorf("ListBuckets() = %v, want %v", names, want)
+	}
+}
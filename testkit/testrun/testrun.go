@@ -0,0 +1,32 @@
+// Package testrun names what tests create on real or shared backends, so
+// concurrent runs do not collide and leftovers can be traced back to the CI
+// run that made them.
+package testrun
+
+import (
+	"os"
+	"testing"
+)
+
+// BucketPrefix starts the name of every bucket BucketName returns.
+const BucketPrefix = "gopherconuk-2025"
+
+// ID identifies the test run: GITHUB_RUN_ID in CI and "local" otherwise.
+func ID() string {
+	if id := os.Getenv("GITHUB_RUN_ID"); id != "" {
+		return id
+	}
+	return "local"
+}
+
+// BucketName returns a new bucket name for a test against a real or shared
+// backend. newName builds it from BucketPrefix and GITHUB_RUN_ID, which is
+// empty outside CI, and t fails if it cannot.
+func BucketName(t testing.TB, newName func(prefix, runID string) (string, error)) string {
+	t.Helper()
+	name, err := newName(BucketPrefix, os.Getenv("GITHUB_RUN_ID"))
+	if err != nil {
+		t.Fatalf("new bucket name: %v", err)
+	}
+	return name
+}
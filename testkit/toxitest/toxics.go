@@ -0,0 +1,94 @@
+package toxitest
+
+import (
+	"maps"
+	"time"
+
+	toxiproxy "github.com/Shopify/toxiproxy/client"
+)
+
+// Toxic describes a toxic to add with Proxy.AddToxic. Build one with the
+// functions below rather than by hand, so attribute names and units are
+// right; the methods return modified copies.
+type Toxic struct {
+	Name       string
+	Type       string
+	Stream     string
+	Toxicity   float32
+	Attributes toxiproxy.Attributes
+}
+
+func newToxic(typeName string, attrs toxiproxy.Attributes) Toxic {
+	return Toxic{Type: typeName, Stream: "downstream", Toxicity: 1, Attributes: attrs}
+}
+
+// Latency delays data by d.
+func Latency(d time.Duration) Toxic {
+	return newToxic("latency", toxiproxy.Attributes{"latency": d.Milliseconds()})
+}
+
+// Bandwidth limits throughput to kbps kilobytes per second.
+func Bandwidth(kbps int) Toxic {
+	return newToxic("bandwidth", toxiproxy.Attributes{"rate": kbps})
+}
+
+// Slicer splits data into pieces of averageSize bytes, give or take
+// variation, with delay between them.
+func Slicer(averageSize, variation int, delay time.Duration) Toxic {
+	return newToxic("slicer", toxiproxy.Attributes{
+		"average_size":   averageSize,
+		"size_variation": variation,
+		"delay":          delay.Microseconds(),
+	})
+}
+
+// Timeout drops all data and closes the connection after d. With d of zero
+// the connection stays open, silently, until the toxic is removed.
+func Timeout(d time.Duration) Toxic {
+	return newToxic("timeout", toxiproxy.Attributes{"timeout": d.Milliseconds()})
+}
+
+// ResetPeer resets the connection d after data is first seen.
+func ResetPeer(d time.Duration) Toxic {
+	return newToxic("reset_peer", toxiproxy.Attributes{"timeout": d.Milliseconds()})
+}
+
+// LimitData closes the connection once n bytes have passed.
+func LimitData(n int64) Toxic {
+	return newToxic("limit_data", toxiproxy.Attributes{"bytes": n})
+}
+
+// Upstream applies the toxic to data sent from the client to the upstream.
+func (t Toxic) Upstream() Toxic {
+	t.Stream = "upstream"
+	return t
+}
+
+// Downstream applies the toxic to data sent back to the client, which is
+// the default.
+func (t Toxic) Downstream() Toxic {
+	t.Stream = "downstream"
+	return t
+}
+
+// Named sets the toxic's name. By default Toxiproxy names it
+// <type>_<stream>.
+func (t Toxic) Named(name string) Toxic {
+	t.Name = name
+	return t
+}
+
+// WithJitter adds up to d of random variation to a Latency toxic.
+func (t Toxic) WithJitter(d time.Duration) Toxic {
+	attrs := maps.Clone(t.Attributes)
+	attrs["jitter"] = d.Milliseconds()
+	t.Attributes = attrs
+	return t
+}
+
+// WithToxicity sets the chance, from 0 to 1, that the toxic applies to a
+// connection.
+func (t Toxic) WithToxicity(p float32) Toxic {
+	t.Toxicity = p
+	return t
+}
@@ -0,0 +1,175 @@
+// Package toxitest gives each test its own Toxiproxy proxy. A proxy is
+// created under a unique name on a free port and deleted again when the test
+// finishes, so a failed run cannot leave a poisoned proxy behind for the
+// next one.
+//
+//	proxy := toxitest.New(t, "localhost.localstack.cloud:4566")
+//	proxy.AddToxic(toxitest.Latency(30 * time.Second).Upstream())
+//
+// Point a client at proxy.Listen with a redirecting transport, such as the
+// demos' BackendConfig with BackendProxy, so it keeps addressing the real
+// hosts.
+//
+// Proxies are created on the Toxiproxy daemon named by TOXIPROXY_ADDR, for
+// example "localhost:8474". If it is not set, each fixture starts an
+// embedded chaosproxy server instead, so no daemon is needed.
+package toxitest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	toxiproxy "github.com/Shopify/toxiproxy/client"
+	"github.com/golangbot/testkit/chaosproxy"
+	"github.com/golangbot/testkit/clocktest"
+)
+
+// AddrEnv names the environment variable holding the address of a Toxiproxy
+// daemon to use instead of the embedded server.
+const AddrEnv = "TOXIPROXY_ADDR"
+
+// Proxy is a Toxiproxy proxy owned by one test.
+type Proxy struct {
+	*toxiproxy.Proxy
+	// Client talks to the Toxiproxy API the proxy was created on.
+	Client *toxiproxy.Client
+
+	t testing.TB
+}
+
+// Option configures New.
+type Option func(*Proxy)
+
+// WithListen sets the address the proxy listens on. The default,
+// "127.0.0.1:0", picks a free port.
+func WithListen(addr string) Option {
+	return func(p *Proxy) {
+		p.Listen = addr
+	}
+}
+
+// New creates a proxy in front of upstream and registers a cleanup that
+// deletes it. It fails the test if the proxy cannot be created.
+func New(t testing.TB, upstream string, opts ...Option) *Proxy {
+	t.Helper()
+	if _, _, err := net.SplitHostPort(upstream); err != nil {
+		t.Fatalf("toxitest: bad upstream %q: %v", upstream, err)
+	}
+	p := &Proxy{
+		Proxy: &toxiproxy.Proxy{
+			Name:     uniqueName(t),
+			Listen:   "127.0.0.1:0",
+			Upstream: upstream,
+			Enabled:  true,
+		},
+		t: t,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	p.Client = newClient(t)
+
+	created, err := p.Client.CreateProxy(p.Name, p.Listen, p.Upstream)
+	if err != nil {
+		t.Fatalf("toxitest: failed to create proxy %s: %v", p.Name, err)
+	}
+	p.Proxy = created
+	t.Cleanup(func() {
+		if err := p.Delete(); err != nil {
+			t.Errorf("toxitest: failed to delete proxy %s: %v", p.Name, err)
+		}
+	})
+	return p
+}
+
+func newClient(t testing.TB) *toxiproxy.Client {
+	if addr := os.Getenv(AddrEnv); addr != "" {
+		return toxiproxy.NewClient(addr)
+	}
+	srv, err := chaosproxy.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("toxitest: failed to start embedded proxy: %v", err)
+	}
+	// Cleanups run last-in first-out, so the server outlives the proxy.
+	t.Cleanup(func() { srv.Close() })
+	return toxiproxy.NewClient(srv.Addr())
+}
+
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// uniqueName derives a proxy name from the test name plus a random suffix,
+// so parallel tests and repeated runs never share a proxy.
+func uniqueName(t testing.TB) string {
+	name := strings.Trim(unsafeNameChars.ReplaceAllString(t.Name(), "_"), "_")
+	if len(name) > 40 {
+		name = name[:40]
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return name + "_" + hex.EncodeToString(suffix)
+}
+
+// AddToxic adds toxic to the proxy and returns a function that removes it
+// again. The toxic is also removed when the proxy is deleted.
+func (p *Proxy) AddToxic(toxic Toxic) (remove func()) {
+	p.t.Helper()
+	added, err := p.Proxy.AddToxic(toxic.Name, toxic.Type, toxic.Stream, toxic.Toxicity, toxic.Attributes)
+	if err != nil {
+		p.t.Fatalf("toxitest: failed to add %s toxic to %s: %v", toxic.Type, p.Name, err)
+	}
+	return func() {
+		if err := p.RemoveToxic(added.Name); err != nil {
+			p.t.Errorf("toxitest: failed to remove toxic %s from %s: %v", added.Name, p.Name, err)
+		}
+	}
+}
+
+// RemoveToxicAfter removes the named toxic once d has passed. The returned
+// channel receives the result, so a test can check it before finishing.
+func (p *Proxy) RemoveToxicAfter(name string, d time.Duration) <-chan error {
+	result := make(chan error, 1)
+	time.AfterFunc(d, func() {
+		result <- p.RemoveToxic(name)
+	})
+	return result
+}
+
+// RetryHooks let DrivePastLatency follow the attempts of the code it drives:
+// Failed is called when an attempt fails and Retrying with the delay before
+// the next one.
+type RetryHooks struct {
+	Failed   func(attempt int)
+	Retrying func(delay time.Duration)
+}
+
+// DrivePastLatency runs create on a fake clock while a latency toxic holds
+// up the proxy, so the first attempt hangs until its timeout. The clock is
+// moved straight to that timeout, the toxic is removed as the attempt
+// fails, and the clock is then moved past each backoff so the retries go
+// through, all without waiting in real time. create must wait on the clock
+// it is given and report its attempts through hooks. The test fails if
+// create has not returned after a minute, however many attempts it took.
+func (p *Proxy) DrivePastLatency(timeout time.Duration, create func(clock *clocktest.Fake, hooks RetryHooks) error) error {
+	p.t.Helper()
+	clock := clocktest.New(time.Now())
+	removeToxic := p.AddToxic(Latency(30 * time.Second).Upstream())
+	advance := make(chan time.Duration, 16)
+	advance <- timeout
+	hooks := RetryHooks{
+		Failed: func(attempt int) {
+			if attempt == 1 {
+				removeToxic()
+			}
+		},
+		Retrying: func(delay time.Duration) { advance <- delay },
+	}
+	return clock.Drive(p.t, time.Minute, advance, func() error {
+		return create(clock, hooks)
+	})
+}
@@ -0,0 +1,84 @@
+package toxitest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	toxiproxy "github.com/Shopify/toxiproxy/client"
+	"github.com/golangbot/testkit/chaosproxy"
+	"github.com/golangbot/testkit/clocktest"
+)
+
+func TestNewCleansUp(t *testing.T) {
+	srv, err := chaosproxy.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("chaosproxy.Start() error = %v", err)
+	}
+	defer srv.Close()
+	t.Setenv(AddrEnv, srv.Addr())
+	client := toxiproxy.NewClient(srv.Addr())
+
+	var names []string
+	for i := 0; i < 2; i++ {
+		t.Run("proxy", func(t *testing.T) {
+			proxy := New(t, "127.0.0.1:1")
+			proxy.AddToxic(Latency(time.Second).WithJitter(100 * time.Millisecond).Upstream())
+			names = append(names, proxy.Name)
+
+			toxics, err := proxy.Toxics()
+			if err != nil {
+				t.Fatalf("Toxics() error = %v", err)
+			}
+			if len(toxics) != 1 || toxics[0].Stream != "upstream" || toxics[0].Attributes["jitter"] != 100.0 {
+				t.Errorf("Toxics() = %+v, want one upstream latency toxic with 100ms jitter", toxics)
+			}
+		})
+	}
+
+	if names[0] == names[1] {
+		t.Errorf("two fixtures got the same proxy name %s", names[0])
+	}
+	proxies, err := client.Proxies()
+	if err != nil {
+		t.Fatalf("Proxies() error = %v", err)
+	}
+	if len(proxies) != 0 {
+		t.Errorf("Proxies() after the tests = %v, want none left behind", proxies)
+	}
+}
+
+func TestDrivePastLatency(t *testing.T) {
+	proxy := New(t, "127.0.0.1:1")
+
+	// Each attempt times out while the toxic is in place, as a request
+	// through it would.
+	attempts := 0
+	err := proxy.DrivePastLatency(5*time.Second, func(clock *clocktest.Fake, hooks RetryHooks) error {
+		sleep := func(d time.Duration) {
+			done := make(chan struct{})
+			clock.AfterFunc(d, func() { close(done) })
+			<-done
+		}
+		for attempts = 1; attempts <= 3; attempts++ {
+			toxics, err := proxy.Toxics()
+			if err != nil {
+				return err
+			}
+			if len(toxics) == 0 {
+				return nil
+			}
+			sleep(5 * time.Second)
+			hooks.Failed(attempts)
+			hooks.Retrying(time.Second)
+			sleep(time.Second)
+		}
+		return errors.New("the latency toxic was never removed")
+	})
+	if err != nil {
+		t.Fatalf("DrivePastLatency() error = %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("create took %d attempts, want 2", attempts)
+	}
+}